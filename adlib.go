@@ -1,16 +1,31 @@
 package generalprobe
 
+import "context"
+
 // AdLibScene is a scene of free style test.
 type AdLibScene struct {
-	callback AdLibCallback
+	callback AdLibCallbackE
 	baseScene
 }
 
 // AdLibCallback is a callback type for AdLibScene
 type AdLibCallback func()
 
+// AdLibCallbackE is a callback type for AdLibE. The scene fails if it
+// returns error.
+type AdLibCallbackE func() error
+
 // AdLib creates a scene of AdLib
 func AdLib(callback AdLibCallback) *AdLibScene {
+	return AdLibE(func() error {
+		callback()
+		return nil
+	})
+}
+
+// AdLibE creates a scene of AdLib with callback that can fail the scene by
+// returning error.
+func AdLibE(callback AdLibCallbackE) *AdLibScene {
 	scene := AdLibScene{
 		callback: callback,
 	}
@@ -22,7 +37,6 @@ func (x *AdLibScene) string() string {
 	return "AdLib"
 }
 
-func (x *AdLibScene) play() error {
-	x.callback()
-	return nil
+func (x *AdLibScene) play(ctx context.Context) error {
+	return x.callback()
 }
@@ -0,0 +1,90 @@
+package generalprobe_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/guregu/dynamo"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gp "github.com/m-mizutani/generalprobe"
+)
+
+func TestCallbackE(t *testing.T) {
+	t.Run("dynamodb record mismatch fails immediately", func(t *testing.T) {
+		backend, probe := newFakeStack(t)
+		require.NoError(t, backend.PutItem(probe.LookupID("ResultStore"), map[string]interface{}{
+			"result_id": "r1", "status": "failed",
+		}))
+
+		n := 0
+		start := time.Now()
+		err := probe.Play([]gp.Scene{
+			gp.GetDynamoRecordE(gp.LogicalID("ResultStore"), func(table dynamo.Table) (bool, error) {
+				n++
+				var item struct {
+					Status string `dynamo:"status"`
+				}
+				if err := table.Get("result_id", "r1").One(&item); err != nil {
+					return false, nil
+				}
+				if item.Status != "done" {
+					return false, fmt.Errorf("status is %s", item.Status)
+				}
+				return true, nil
+			}).Wait(gp.WaitPolicy{Interval: time.Second, MaxAttempts: 20}),
+		})
+
+		require.Error(t, err)
+		assert.False(t, errors.Is(err, gp.ErrPollingTimeout))
+		assert.Contains(t, err.Error(), "status is failed")
+		assert.Equal(t, 1, n)
+		assert.True(t, time.Since(start) < time.Second)
+	})
+
+	t.Run("retry until success", func(t *testing.T) {
+		_, probe := newFakeStack(t)
+
+		n := 0
+		err := probe.Play([]gp.Scene{
+			gp.GetDynamoRecordE(gp.LogicalID("ResultStore"), func(table dynamo.Table) (bool, error) {
+				n++
+				return n == 3, nil
+			}).Wait(gp.WaitPolicy{Interval: time.Millisecond, MaxAttempts: 5}),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 3, n)
+	})
+
+	t.Run("kinesis, logs, lambda and adlib", func(t *testing.T) {
+		rejected := errors.New("rejected")
+		testCases := map[string]gp.Scene{
+			"kinesis": gp.GetKinesisStreamRecordE(gp.LogicalID("ResultStream"), func(data []byte) (bool, error) {
+				return false, rejected
+			}),
+			"logs": gp.GetLambdaLogsE(gp.LogicalID("TestHandler"), func(log gp.CloudWatchLog) (bool, error) {
+				return false, rejected
+			}),
+			"lambda": gp.InvokeLambdaE(gp.LogicalID("TestHandler"), func(response []byte) error {
+				return rejected
+			}).SnsEvent(map[string]string{"id": "x"}),
+			"adlib": gp.AdLibE(func() error { return rejected }),
+		}
+
+		for title, scene := range testCases {
+			t.Run(title, func(t *testing.T) {
+				_, probe := newFakeStack(t)
+				err := probe.Play([]gp.Scene{
+					gp.PutKinesisStreamRecord(gp.LogicalID("ResultStream"), []byte("x")),
+					gp.InvokeLambda(gp.LogicalID("TestHandler"), nil).SnsEvent(map[string]string{"id": "x"}),
+					scene,
+				})
+				assert.True(t, errors.Is(err, rejected))
+				assert.False(t, errors.Is(err, gp.ErrPollingTimeout))
+			})
+		}
+	})
+}
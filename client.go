@@ -0,0 +1,137 @@
+package generalprobe
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/aws/aws-sdk-go/service/kinesis/kinesisiface"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/pkg/errors"
+)
+
+// Clients is a set of AWS service clients used by scenes. A nil field is
+// filled with a client created from AWS session of Generalprobe.
+type Clients struct {
+	CloudFormation cloudformationiface.CloudFormationAPI
+	Lambda         lambdaiface.LambdaAPI
+	SNS            snsiface.SNSAPI
+	Kinesis        kinesisiface.KinesisAPI
+	DynamoDB       dynamodbiface.DynamoDBAPI
+	CloudWatchLogs cloudwatchlogsiface.CloudWatchLogsAPI
+	S3             s3iface.S3API
+}
+
+func (x *Clients) complete() bool {
+	return x.CloudFormation != nil && x.Lambda != nil && x.SNS != nil &&
+		x.Kinesis != nil && x.DynamoDB != nil && x.CloudWatchLogs != nil &&
+		x.S3 != nil
+}
+
+func (x *Clients) fill(ssn *session.Session) {
+	if x.CloudFormation == nil {
+		x.CloudFormation = cloudformation.New(ssn)
+	}
+	if x.Lambda == nil {
+		x.Lambda = lambda.New(ssn)
+	}
+	if x.SNS == nil {
+		x.SNS = sns.New(ssn)
+	}
+	if x.Kinesis == nil {
+		x.Kinesis = kinesis.New(ssn)
+	}
+	if x.DynamoDB == nil {
+		x.DynamoDB = dynamodb.New(ssn)
+	}
+	if x.CloudWatchLogs == nil {
+		x.CloudWatchLogs = cloudwatchlogs.New(ssn)
+	}
+	if x.S3 == nil {
+		x.S3 = s3.New(ssn)
+	}
+}
+
+// Option is a functional option of New.
+type Option func(gp *Generalprobe)
+
+// WithAWSConfig merges cfg into AWS config to create clients. Region of
+// New is used if cfg.Region is not set.
+func WithAWSConfig(cfg *aws.Config) Option {
+	return func(gp *Generalprobe) {
+		gp.awsConfig.MergeIn(cfg)
+	}
+}
+
+// WithEndpointResolver sets endpoint resolver of AWS clients. It can be used
+// to send requests to local emulator such as LocalStack.
+func WithEndpointResolver(resolver endpoints.Resolver) Option {
+	return func(gp *Generalprobe) {
+		gp.awsConfig.EndpointResolver = resolver
+	}
+}
+
+// WithRunID sets run ID instead of generated UUID.
+func WithRunID(runID string) Option {
+	return func(gp *Generalprobe) {
+		gp.runID = runID
+	}
+}
+
+// WithClients injects AWS service clients. Only non-nil fields of clients
+// replace default clients.
+func WithClients(clients Clients) Option {
+	return func(gp *Generalprobe) {
+		if clients.CloudFormation != nil {
+			gp.clients.CloudFormation = clients.CloudFormation
+		}
+		if clients.Lambda != nil {
+			gp.clients.Lambda = clients.Lambda
+		}
+		if clients.SNS != nil {
+			gp.clients.SNS = clients.SNS
+		}
+		if clients.Kinesis != nil {
+			gp.clients.Kinesis = clients.Kinesis
+		}
+		if clients.DynamoDB != nil {
+			gp.clients.DynamoDB = clients.DynamoDB
+		}
+		if clients.CloudWatchLogs != nil {
+			gp.clients.CloudWatchLogs = clients.CloudWatchLogs
+		}
+		if clients.S3 != nil {
+			gp.clients.S3 = clients.S3
+		}
+	}
+}
+
+func (x *Generalprobe) setupClients() error {
+	if x.clients.complete() {
+		return nil
+	}
+
+	if x.awsConfig.Region == nil {
+		x.awsConfig.Region = aws.String(x.awsRegion)
+	}
+
+	ssn, err := session.NewSession(x.awsConfig)
+	if err != nil {
+		return errors.Wrap(err, "Fail to create AWS session")
+	}
+
+	x.awsSession = ssn
+	x.clients.fill(ssn)
+	return nil
+}
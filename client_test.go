@@ -0,0 +1,59 @@
+package generalprobe_test
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gp "github.com/m-mizutani/generalprobe"
+	"github.com/m-mizutani/generalprobe/fake"
+)
+
+type countingLambda struct {
+	lambdaiface.LambdaAPI
+	invoked int
+}
+
+func (x *countingLambda) InvokeWithContext(ctx aws.Context, input *lambda.InvokeInput, opts ...request.Option) (*lambda.InvokeOutput, error) {
+	x.invoked++
+	return x.LambdaAPI.InvokeWithContext(ctx, input, opts...)
+}
+
+func TestOptions(t *testing.T) {
+	t.Run("WithClients replaces only non-nil clients", func(t *testing.T) {
+		backend, _ := newFakeStack(t)
+		client := &countingLambda{LambdaAPI: backend.Clients().Lambda}
+
+		probe, err := gp.New(fakeRegion, fakeStackName,
+			gp.WithClients(backend.Clients()),
+			gp.WithClients(gp.Clients{Lambda: client}))
+		require.NoError(t, err)
+
+		require.NoError(t, probe.Play([]gp.Scene{
+			gp.InvokeLambda(gp.LogicalID("TestHandler"), nil).SnsEvent(map[string]string{"id": "x"}),
+			gp.PublishSnsMessage(gp.LogicalID("Trigger"), []byte(`{"id":"y"}`)),
+		}))
+		assert.Equal(t, 1, client.invoked)
+	})
+
+	t.Run("WithAWSConfig for missing clients", func(t *testing.T) {
+		backend := fake.New(fakeRegion, fakeAccount, fakeStackName)
+		backend.AddFunction("TestHandler", nil)
+
+		cfg := aws.NewConfig().WithEndpoint("http://127.0.0.1:1").WithMaxRetries(0).
+			WithCredentials(credentials.NewStaticCredentials("key", "secret", ""))
+		probe, err := gp.New(fakeRegion, fakeStackName, gp.WithAWSConfig(cfg),
+			gp.WithClients(gp.Clients{CloudFormation: backend.Clients().CloudFormation}))
+		require.NoError(t, err)
+
+		err = probe.Play([]gp.Scene{gp.InvokeLambda(gp.LogicalID("TestHandler"), nil).Event("{}")})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "127.0.0.1:1")
+	})
+}
@@ -0,0 +1,150 @@
+// Command generalprobe plays declarative playbooks against a deployed
+// CloudFormation stack.
+//
+//	generalprobe run --region ap-northeast-1 --stack my-stack playbook.yml
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	gp "github.com/m-mizutani/generalprobe"
+)
+
+const (
+	exitOK    = 0
+	exitFail  = 1
+	exitUsage = 2
+)
+
+// newProbe creates Generalprobe for each playbook. Tests replace it to use
+// fake clients.
+var newProbe = gp.New
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, `Usage: generalprobe <command> [options]
+
+Commands:
+  run    Play declarative playbooks against a CloudFormation stack
+`)
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return exitUsage
+	}
+
+	switch args[0] {
+	case "run":
+		return runPlaybooks(args[1:], stdout, stderr)
+	case "help", "-h", "--help":
+		usage(stdout)
+		return exitOK
+	}
+
+	fmt.Fprintf(stderr, "Unknown command: %s\n", args[0])
+	usage(stderr)
+	return exitUsage
+}
+
+func runPlaybooks(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: generalprobe run --region <region> --stack <stack> <playbook>...\n\nOptions (must be put before playbooks):\n")
+		flags.PrintDefaults()
+	}
+
+	region := flags.String("region", os.Getenv("AWS_REGION"), "AWS region of the stack")
+	stackName := flags.String("stack", "", "CloudFormation stack name")
+	timeout := flags.Duration("timeout", 0, "deadline of each playbook (e.g. 5m), 0 means no deadline")
+	quiet := flags.Bool("quiet", false, "do not print progress of scenes")
+	diagnostics := flags.String("diagnostics", "", "directory to write diagnostics of failed playbooks")
+
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if *region == "" || *stackName == "" || flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	// flag package stops parsing at the first playbook, so options after
+	// playbooks would be regarded as playbooks.
+	for _, arg := range flags.Args() {
+		if strings.HasPrefix(arg, "-") {
+			fmt.Fprintf(stderr, "Option must be put before playbooks: %s\n", arg)
+			flags.Usage()
+			return exitUsage
+		}
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	options := []gp.Option{gp.WithLogger(newLogger(stderr, *quiet))}
+	if *diagnostics != "" {
+		options = append(options, gp.WithDiagnostics(*diagnostics))
+	}
+
+	failed := 0
+	for _, path := range flags.Args() {
+		start := time.Now()
+		if err := playFile(ctx, path, *region, *stackName, *timeout, options...); err != nil {
+			fmt.Fprintf(stdout, "FAIL %s (%s)\n  %v\n", path, time.Since(start).Round(time.Millisecond), err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(stdout, "PASS %s (%s)\n", path, time.Since(start).Round(time.Millisecond))
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(stdout, "%d of %d playbook(s) failed\n", failed, flags.NArg())
+		return exitFail
+	}
+	return exitOK
+}
+
+// newLogger returns logger that writes progress of scenes to w.
+// GENERALPROBE_LOG_LEVEL overrides the level as well as the library.
+func newLogger(w io.Writer, quiet bool) *logrus.Logger {
+	l := logrus.New()
+	l.SetOutput(w)
+	l.SetLevel(logrus.InfoLevel)
+	if quiet {
+		l.SetLevel(logrus.WarnLevel)
+	}
+	if level, err := logrus.ParseLevel(os.Getenv("GENERALPROBE_LOG_LEVEL")); err == nil {
+		l.SetLevel(level)
+	}
+	return l
+}
+
+func playFile(ctx context.Context, path, region, stackName string, timeout time.Duration, options ...gp.Option) error {
+	playbook, err := gp.LoadPlaybook(path)
+	if err != nil {
+		return err
+	}
+
+	probe, err := newProbe(region, stackName, options...)
+	if err != nil {
+		return err
+	}
+	probe.SetTimeout(timeout)
+
+	return probe.PlayContext(ctx, playbook)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gp "github.com/m-mizutani/generalprobe"
+	"github.com/m-mizutani/generalprobe/fake"
+)
+
+func TestRunUsage(t *testing.T) {
+	testCases := map[string][]string{
+		"no command":      {},
+		"unknown command": {"walk"},
+		"no stack":        {"run", "--region", "ap-northeast-1", "playbook.yml"},
+		"no playbook":     {"run", "--region", "ap-northeast-1", "--stack", "my-stack"},
+		"unknown option":  {"run", "--no-such-option"},
+		"option after playbook": {"run", "--region", "ap-northeast-1", "--stack", "my-stack",
+			"playbook.yml", "--quiet"},
+	}
+
+	for title, args := range testCases {
+		t.Run(title, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			assert.Equal(t, exitUsage, run(args, &stdout, &stderr))
+			assert.NotEmpty(t, stderr.String())
+		})
+	}
+}
+
+func TestRunInvalidPlaybook(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"run", "--quiet", "--region", "ap-northeast-1", "--stack", "my-stack",
+		"no-such-playbook.yml"}, &stdout, &stderr)
+
+	assert.Equal(t, exitFail, code)
+	assert.Contains(t, stdout.String(), "FAIL no-such-playbook.yml")
+}
+
+// useFakeStack replaces newProbe to play playbooks against a fake stack that
+// has Echo function.
+func useFakeStack(t *testing.T) {
+	backend := fake.New("ap-northeast-1", "123456789012", "my-stack")
+	backend.AddFunction("Echo", func(ctx context.Context, payload []byte) ([]byte, error) {
+		return payload, nil
+	})
+
+	orig := newProbe
+	newProbe = func(region, stackName string, options ...gp.Option) (*gp.Generalprobe, error) {
+		return gp.New(region, stackName, append(options, gp.WithClients(backend.Clients()))...)
+	}
+	t.Cleanup(func() { newProbe = orig })
+}
+
+func writePlaybook(t *testing.T, status string) string {
+	path := filepath.Join(t.TempDir(), "playbook.yml")
+	body := `
+scenes:
+  - type: invoke_lambda
+    target: { logical_id: Echo }
+    event: { status: ` + status + ` }
+    expect:
+      json: { status: ok }
+  - type: pause
+    seconds: 0
+`
+	require.NoError(t, ioutil.WriteFile(path, []byte(body), 0644))
+	return path
+}
+
+func TestRunPlaybook(t *testing.T) {
+	useFakeStack(t)
+
+	t.Run("pass", func(t *testing.T) {
+		path := writePlaybook(t, "ok")
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"run", "--region", "ap-northeast-1", "--stack", "my-stack", path}, &stdout, &stderr)
+
+		assert.Equal(t, exitOK, code)
+		assert.Contains(t, stdout.String(), "PASS "+path)
+		assert.Contains(t, stderr.String(), "Step (1/2): Invoke Lambda")
+		assert.Contains(t, stderr.String(), "Step (2/2): Pausing 0 seconds")
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		passed, failed := writePlaybook(t, "ok"), writePlaybook(t, "ng")
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"run", "--quiet", "--region", "ap-northeast-1", "--stack", "my-stack",
+			passed, failed}, &stdout, &stderr)
+
+		assert.Equal(t, exitFail, code)
+		assert.Contains(t, stdout.String(), "PASS "+passed)
+		assert.Contains(t, stdout.String(), "FAIL "+failed)
+		assert.Contains(t, stdout.String(), "1 of 2 playbook(s) failed")
+		assert.NotContains(t, stderr.String(), "Step (1/2)")
+	})
+}
@@ -0,0 +1,204 @@
+package generalprobe
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+type stepKey struct{}
+type repeatKey struct{}
+
+// step is position of the playing scene in the playbook. Path of a nested
+// scene is joined by dot such as "2.3".
+type step struct {
+	label    string
+	path     string
+	index    int
+	total    int
+	teardown bool
+}
+
+func withStep(ctx context.Context, s step) context.Context {
+	return context.WithValue(ctx, stepKey{}, s)
+}
+
+func currentStep(ctx context.Context) step {
+	if s, ok := ctx.Value(stepKey{}).(step); ok {
+		return s
+	}
+	return step{label: "Step"}
+}
+
+func withRepeatIndex(ctx context.Context, index int) context.Context {
+	return context.WithValue(ctx, repeatKey{}, index)
+}
+
+// repeatIndex returns iteration index of the innermost Repeat.
+func repeatIndex(ctx context.Context) (int, bool) {
+	index, ok := ctx.Value(repeatKey{}).(int)
+	return index, ok
+}
+
+// playChild plays a child scene of composite scene as a nested step.
+func (x *baseScene) playChild(ctx context.Context, path []int, scene Scene) error {
+	parent := currentStep(ctx)
+	s := parent
+	for _, idx := range path {
+		if s.path != "" {
+			s.path += "."
+		}
+		s.path += strconv.Itoa(idx + 1)
+	}
+	s.index = path[len(path)-1]
+
+	scene.setGeneralprobe(x.gp)
+	x.log().Infof("%s (%s/%d): %s (%s)\n", s.label, s.path, s.total, scene.string(), reflect.TypeOf(scene))
+
+	ctx, finish := x.gp.recordScene(ctx, s, scene)
+
+	sceneErr := &SceneError{
+		Step:     path[len(path)-1] + 1,
+		Path:     s.path,
+		Total:    s.total,
+		Scene:    scene.string(),
+		Teardown: s.teardown,
+	}
+
+	if err := ctx.Err(); err != nil {
+		finish(err)
+		sceneErr.Err, sceneErr.ctxErr = err, err
+		return sceneErr
+	}
+
+	if err := x.gp.runScene(withStep(ctx, s), scene, finish); err != nil {
+		sceneErr.Err, sceneErr.ctxErr = err, ctx.Err()
+		return sceneErr
+	}
+
+	return nil
+}
+
+// SequenceScene is a named block of scenes.
+type SequenceScene struct {
+	name   string
+	scenes []Scene
+	baseScene
+}
+
+// Sequence creates a scene that plays scenes sequentially as a named block.
+// It can be used to share a series of scenes among playbooks.
+func Sequence(name string, scenes ...Scene) *SequenceScene {
+	return &SequenceScene{name: name, scenes: scenes}
+}
+
+// String returns text explanation of the scene
+func (x *SequenceScene) string() string {
+	return fmt.Sprintf("Sequence %s (%d scenes)", x.name, len(x.scenes))
+}
+
+func (x *SequenceScene) play(ctx context.Context) error {
+	for idx, scene := range x.scenes {
+		if err := x.playChild(ctx, []int{idx}, scene); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RepeatScene is a block of scenes played several times.
+type RepeatScene struct {
+	count  int
+	scenes []Scene
+	baseScene
+}
+
+// Repeat creates a scene that plays scenes count times. 0-origin index of
+// the iteration is available as {{ .index }} in templates of the scenes.
+// Step of the scenes in logs is shown as "parent.iteration.index".
+func Repeat(count int, scenes ...Scene) *RepeatScene {
+	return &RepeatScene{count: count, scenes: scenes}
+}
+
+// String returns text explanation of the scene
+func (x *RepeatScene) string() string {
+	return fmt.Sprintf("Repeat %d times (%d scenes)", x.count, len(x.scenes))
+}
+
+func (x *RepeatScene) play(ctx context.Context) error {
+	for i := 0; i < x.count; i++ {
+		iterCtx := withRepeatIndex(ctx, i)
+		for idx, scene := range x.scenes {
+			if err := x.playChild(iterCtx, []int{i, idx}, scene); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// IfPredicate is a condition of If. It can refer variables captured by
+// previous scenes.
+type IfPredicate func(vars *Vars) bool
+
+// IfScene is a scene that branches by condition.
+type IfScene struct {
+	predicate IfPredicate
+	condition string
+	then      Scene
+	els       Scene
+	baseScene
+}
+
+// If creates a scene that plays then if predicate returns true, otherwise
+// plays els. els can be nil. Use Sequence to play multiple scenes in
+// a branch.
+func If(predicate IfPredicate, then, els Scene) *IfScene {
+	return &IfScene{predicate: predicate, then: then, els: els}
+}
+
+// String returns text explanation of the scene
+func (x *IfScene) string() string {
+	if x.condition != "" {
+		return fmt.Sprintf("If %s", x.condition)
+	}
+	return "If"
+}
+
+func (x *IfScene) play(ctx context.Context) error {
+	ok, err := x.evaluate(ctx)
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		x.log().WithField("scene", x.string()).Debug("Condition is true")
+		return x.playChild(ctx, []int{0}, x.then)
+	}
+
+	x.log().WithField("scene", x.string()).Debug("Condition is false")
+	if x.els == nil {
+		return nil
+	}
+	return x.playChild(ctx, []int{0}, x.els)
+}
+
+// evaluate returns result of predicate, or condition template. Rendered
+// condition is false if it is empty, "false" or "0".
+func (x *IfScene) evaluate(ctx context.Context) (bool, error) {
+	if x.predicate != nil {
+		return x.predicate(x.vars()), nil
+	}
+
+	result, err := x.render(ctx, x.condition)
+	if err != nil {
+		return false, err
+	}
+	switch strings.TrimSpace(result) {
+	case "", "false", "0":
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,109 @@
+package generalprobe_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gp "github.com/m-mizutani/generalprobe"
+)
+
+func TestSequenceAndRepeat(t *testing.T) {
+	backend, probe := newFakeStack(t)
+
+	var messageIDs []string
+	publish := gp.Sequence("publish",
+		gp.PublishSnsData(gp.LogicalID("Trigger"), map[string]string{"id": "{{ runID }}-{{ .index }}"}).
+			Template().Capture("message_id"),
+		gp.AdLib(func() { messageIDs = append(messageIDs, probe.Vars().String("message_id")) }),
+	)
+
+	require.NoError(t, probe.Play([]gp.Scene{gp.Repeat(3, publish)}))
+	assert.Equal(t, 3, backend.TableItems(probe.LookupID("ResultStore")))
+	assert.Equal(t, 3, len(messageIDs))
+}
+
+func TestNestedSceneError(t *testing.T) {
+	_, probe := newFakeStack(t)
+
+	n := 0
+	err := probe.Play([]gp.Scene{
+		gp.AdLib(func() { n++ }),
+		gp.Sequence("outer",
+			gp.AdLib(func() { n++ }),
+			gp.Sequence("inner",
+				gp.PutKinesisStreamRecord(gp.LogicalID("NoSuchStream"), []byte("x")),
+			),
+			gp.AdLib(func() { n++ }),
+		),
+	})
+	require.Error(t, err)
+	assert.Equal(t, 2, n)
+	assert.True(t, errors.Is(err, gp.ErrResourceNotFound))
+	assert.Contains(t, err.Error(), "step (2.2.1/2)")
+
+	var sceneErr *gp.SceneError
+	require.True(t, errors.As(err, &sceneErr))
+	assert.Equal(t, 2, sceneErr.Step)
+	assert.Equal(t, "", sceneErr.Path)
+}
+
+func TestIf(t *testing.T) {
+	_, probe := newFakeStack(t)
+	probe.Vars().Set("status", "done")
+
+	var played []string
+	isDone := func(vars *gp.Vars) bool { return vars.String("status") == "done" }
+	record := func(name string) gp.Scene {
+		return gp.AdLib(func() { played = append(played, name) })
+	}
+
+	require.NoError(t, probe.Play([]gp.Scene{
+		gp.If(isDone, record("then"), record("else")),
+		gp.AdLib(func() { probe.Vars().Set("status", "running") }),
+		gp.If(isDone, record("then"), record("else")),
+		gp.If(isDone, record("then"), nil),
+	}))
+	assert.Equal(t, []string{"then", "else"}, played)
+}
+
+func TestCompositePlaybook(t *testing.T) {
+	backend, probe := newFakeStack(t)
+
+	playbook, err := gp.LoadPlaybook(writePlaybook(t, `
+scenes:
+  - type: sequence
+    name: publish
+    scenes:
+      - type: repeat
+        count: 2
+        scenes:
+          - type: publish_sns
+            target: { logical_id: Trigger }
+            message: { id: "{{ runID }}-{{ .index }}" }
+          - type: get_dynamo_record
+            target: { logical_id: ResultStore }
+            hash_key: { name: result_id, value: "{{ runID }}-{{ .index }}" }
+            expect:
+              json: { result_id: "{{ runID }}-{{ .index }}" }
+  - type: if
+    condition: '{{ eq runID "no-such-run" }}'
+    then:
+      - type: put_kinesis
+        target: { logical_id: NoSuchStream }
+        message: x
+    else:
+      - type: put_kinesis
+        target: { logical_id: ResultStream }
+        message: "{{ runID }}"
+`))
+	require.NoError(t, err)
+	require.NoError(t, probe.Play(playbook))
+	assert.Equal(t, 2, backend.TableItems(probe.LookupID("ResultStore")))
+	assert.Equal(t, [][]byte{[]byte(probe.RunID())}, backend.StreamRecords(probe.LookupID("ResultStream")))
+
+	_, err = gp.LoadPlaybook(writePlaybook(t, "scenes:\n  - type: repeat\n    scenes: [{ type: pause }]\n"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,70 @@
+package generalprobe
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/guregu/dynamo"
+	"github.com/pkg/errors"
+)
+
+// DeleteDynamoRecordScene is a scene to delete a DynamoDB item. It is
+// expected to be used in Teardown to clean up records created by the test.
+type DeleteDynamoRecordScene struct {
+	target   Target
+	hashKey  dynamoKey
+	rangeKey *dynamoKey
+	baseScene
+}
+
+// DeleteDynamoRecord creates a scene to delete an item specified by hash key.
+// hashValue can be a template string such as "{{ runID }}".
+func DeleteDynamoRecord(target Target, hashKey string, hashValue interface{}) *DeleteDynamoRecordScene {
+	scene := DeleteDynamoRecordScene{
+		target:  target,
+		hashKey: dynamoKey{name: hashKey, value: hashValue},
+	}
+	return &scene
+}
+
+// Range sets range key of the item to be deleted.
+func (x *DeleteDynamoRecordScene) Range(rangeKey string, rangeValue interface{}) *DeleteDynamoRecordScene {
+	x.rangeKey = &dynamoKey{name: rangeKey, value: rangeValue}
+	return x
+}
+
+// String returns text explanation of the scene
+func (x *DeleteDynamoRecordScene) string() string {
+	return fmt.Sprintf("Delete DynamoDB record %s=%v of %s",
+		x.hashKey.name, x.hashKey.value, targetString(x.target, x.gp))
+}
+
+func (x *DeleteDynamoRecordScene) sceneTarget() Target { return x.target }
+
+func (x *DeleteDynamoRecordScene) play(ctx context.Context) error {
+	tableName, err := x.target.name(x.gp)
+	if err != nil {
+		return err
+	}
+
+	hashValue, err := x.gp.renderValue(ctx, x.hashKey.value)
+	if err != nil {
+		return err
+	}
+
+	table := dynamo.NewFromIface(x.clients().DynamoDB).Table(tableName)
+	query := table.Delete(x.hashKey.name, hashValue)
+	if x.rangeKey != nil {
+		rangeValue, err := x.gp.renderValue(ctx, x.rangeKey.value)
+		if err != nil {
+			return err
+		}
+		query = query.Range(x.rangeKey.name, rangeValue)
+	}
+
+	if err := query.RunWithContext(ctx); err != nil {
+		return errors.Wrapf(err, "Fail to delete DynamoDB record from %s", tableName)
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package generalprobe
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+)
+
+// DeleteS3ObjectsScene is a scene to delete S3 objects. It is expected to be
+// used in Teardown to clean up artifacts (e.g. records of Kinesis delivered
+// by Firehose) created by the test.
+type DeleteS3ObjectsScene struct {
+	target Target
+	prefix string
+	baseScene
+}
+
+// DeleteS3Objects creates a scene to delete all objects that have prefix
+// in the bucket. prefix can be a template string such as "logs/{{ runID }}/".
+// Empty prefix is not allowed to avoid deleting all objects by mistake.
+func DeleteS3Objects(target Target, prefix string) *DeleteS3ObjectsScene {
+	scene := DeleteS3ObjectsScene{
+		target: target,
+		prefix: prefix,
+	}
+	return &scene
+}
+
+// String returns text explanation of the scene
+func (x *DeleteS3ObjectsScene) string() string {
+	return fmt.Sprintf("Delete S3 objects %s* of %s", x.prefix, targetString(x.target, x.gp))
+}
+
+func (x *DeleteS3ObjectsScene) sceneTarget() Target { return x.target }
+
+func (x *DeleteS3ObjectsScene) play(ctx context.Context) error {
+	bucketName, err := x.target.name(x.gp)
+	if err != nil {
+		return err
+	}
+
+	prefix, err := x.render(ctx, x.prefix)
+	if err != nil {
+		return err
+	}
+	if prefix == "" {
+		return errors.New("Prefix of S3 objects to be deleted is empty")
+	}
+
+	client := x.clients().S3
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucketName),
+		Prefix: aws.String(prefix),
+	}
+
+	for {
+		resp, err := client.ListObjectsV2WithContext(ctx, input)
+		if err != nil {
+			return errors.Wrapf(err, "Fail to list S3 objects in %s", bucketName)
+		}
+
+		if len(resp.Contents) > 0 {
+			var objects []*s3.ObjectIdentifier
+			for _, obj := range resp.Contents {
+				objects = append(objects, &s3.ObjectIdentifier{Key: obj.Key})
+			}
+
+			x.log().WithField("objects", len(objects)).Debug("Deleting S3 objects")
+			out, err := client.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+				Bucket: aws.String(bucketName),
+				Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+			})
+			if err != nil {
+				return errors.Wrapf(err, "Fail to delete S3 objects in %s", bucketName)
+			}
+			if len(out.Errors) > 0 {
+				return fmt.Errorf("Fail to delete %d S3 objects in %s: %s",
+					len(out.Errors), bucketName, aws.StringValue(out.Errors[0].Message))
+			}
+		}
+
+		if !aws.BoolValue(resp.IsTruncated) {
+			return nil
+		}
+		input.ContinuationToken = resp.NextContinuationToken
+	}
+}
@@ -0,0 +1,267 @@
+package generalprobe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxDiagnosticPayloads is number of the last payloads kept for
+	// diagnostics.
+	maxDiagnosticPayloads = 20
+	// maxDiagnosticLogs is number of the last log messages kept for each
+	// Lambda function.
+	maxDiagnosticLogs = 50
+	// diagnosticLogPattern is filter pattern of CloudWatch Logs to read only
+	// error and REPORT lines. Terms of filter pattern are case sensitive.
+	diagnosticLogPattern = `?ERROR ?Error ?error ?errorMessage ?Exception ?exception ?FATAL ?fatal ?panic ?REPORT ?"Task timed out"`
+	// diagnosticsTimeout is deadline to collect diagnostics. It is not
+	// affected by cancel of the run.
+	diagnosticsTimeout = 30 * time.Second
+)
+
+// Diagnostics is a bundle of information collected on failure of a run to
+// investigate the cause without AWS console.
+type Diagnostics struct {
+	CollectedAt       time.Time `json:"collected_at"`
+	StackName         string    `json:"stack_name"`
+	StackStatus       string    `json:"stack_status"`
+	StackStatusReason string    `json:"stack_status_reason,omitempty"`
+	// LambdaLogs are error and REPORT lines of Lambda functions in the
+	// stack since StartTime of Generalprobe.
+	LambdaLogs []*LambdaDiagnostics `json:"lambda_logs"`
+	// Payloads are the last payloads sent by PublishSnsMessage,
+	// PutKinesisStreamRecord and InvokeLambda scenes.
+	Payloads []*SentPayload `json:"payloads"`
+	// Errors are failures of collecting diagnostics.
+	Errors []string `json:"errors,omitempty"`
+	// Dir is directory that diagnostics are written to. It is empty if
+	// diagnostics are only attached to error.
+	Dir string `json:"-"`
+}
+
+// LambdaDiagnostics is a part of Diagnostics for a Lambda function.
+type LambdaDiagnostics struct {
+	LogicalID    string   `json:"logical_id"`
+	FunctionName string   `json:"function_name"`
+	Messages     []string `json:"messages"`
+}
+
+// SentPayload is a payload sent to a resource by a scene.
+type SentPayload struct {
+	Step    string    `json:"step"`
+	Scene   string    `json:"scene"`
+	Target  string    `json:"target"`
+	Time    time.Time `json:"time"`
+	Payload string    `json:"payload"`
+}
+
+// DiagnosticsError is returned by Play instead of the original error if
+// diagnostics are enabled by WithDiagnostics. Err can be also checked by
+// errors.Is and errors.As through the error.
+type DiagnosticsError struct {
+	Err         error
+	Diagnostics *Diagnostics
+}
+
+func (x *DiagnosticsError) Error() string {
+	if x.Diagnostics.Dir != "" {
+		return fmt.Sprintf("%v (diagnostics: %s)", x.Err, x.Diagnostics.Dir)
+	}
+	return x.Err.Error()
+}
+
+// Unwrap returns the original error of the run.
+func (x *DiagnosticsError) Unwrap() error { return x.Err }
+
+// WithDiagnostics enables collecting Diagnostics when a run fails. The
+// diagnostics are attached to the returned error as *DiagnosticsError, and
+// also written to dir/<RunID> unless dir is empty.
+func WithDiagnostics(dir string) Option {
+	return func(gp *Generalprobe) {
+		gp.diagnostics = true
+		gp.diagnosticsDir = dir
+	}
+}
+
+// recordPayload keeps a payload sent by a scene for diagnostics.
+func (x *Generalprobe) recordPayload(ctx context.Context, target Target, payload []byte) {
+	p := &SentPayload{
+		Target:  targetString(target, x),
+		Time:    time.Now().UTC(),
+		Payload: string(payload),
+	}
+	if r := sceneReport(ctx); r != nil {
+		p.Step, p.Scene = r.Step, r.Name
+	}
+
+	x.payloadMutex.Lock()
+	defer x.payloadMutex.Unlock()
+	x.payloads = append(x.payloads, p)
+	if len(x.payloads) > maxDiagnosticPayloads {
+		x.payloads = x.payloads[len(x.payloads)-maxDiagnosticPayloads:]
+	}
+}
+
+// diagnose collects diagnostics for err and returns *DiagnosticsError if
+// diagnostics are enabled.
+func (x *Generalprobe) diagnose(ctx context.Context, err error) error {
+	if err == nil || !x.diagnostics {
+		return err
+	}
+
+	dctx, cancel := context.WithTimeout(detachedContext{parent: ctx}, diagnosticsTimeout)
+	defer cancel()
+
+	diag := x.collectDiagnostics(dctx)
+	if x.diagnosticsDir != "" {
+		dir := filepath.Join(x.diagnosticsDir, x.runID)
+		if werr := diag.write(dir); werr != nil {
+			x.logger.WithError(werr).Error("Fail to write diagnostics")
+		} else {
+			diag.Dir = dir
+			x.logger.WithField("dir", dir).Info("Wrote diagnostics")
+		}
+	}
+
+	return &DiagnosticsError{Err: err, Diagnostics: diag}
+}
+
+func (x *Generalprobe) collectDiagnostics(ctx context.Context) *Diagnostics {
+	diag := &Diagnostics{
+		CollectedAt: time.Now().UTC(),
+		StackName:   x.stackName,
+	}
+
+	resp, err := x.clients.CloudFormation.DescribeStacksWithContext(ctx, &cloudformation.DescribeStacksInput{
+		StackName: aws.String(x.stackName),
+	})
+	if err != nil {
+		diag.Errors = append(diag.Errors, errors.Wrap(err, "Fail to get stack status").Error())
+	} else {
+		for _, stack := range resp.Stacks {
+			if aws.StringValue(stack.StackName) == x.stackName {
+				diag.StackStatus = aws.StringValue(stack.StackStatus)
+				diag.StackStatusReason = aws.StringValue(stack.StackStatusReason)
+			}
+		}
+	}
+
+	for _, resource := range x.resources {
+		if aws.StringValue(resource.ResourceType) != "AWS::Lambda::Function" {
+			continue
+		}
+
+		logs := &LambdaDiagnostics{
+			LogicalID:    aws.StringValue(resource.LogicalResourceId),
+			FunctionName: aws.StringValue(resource.PhysicalResourceId),
+		}
+		msgs, err := x.diagnosticLambdaLogs(ctx, logs.FunctionName)
+		if err != nil {
+			diag.Errors = append(diag.Errors, err.Error())
+		}
+		logs.Messages = msgs
+		diag.LambdaLogs = append(diag.LambdaLogs, logs)
+	}
+
+	x.payloadMutex.Lock()
+	diag.Payloads = append(diag.Payloads, x.payloads...)
+	x.payloadMutex.Unlock()
+
+	return diag
+}
+
+// isDiagnosticLog returns true if msg is REPORT line or seems error.
+func isDiagnosticLog(msg string) bool {
+	if strings.HasPrefix(msg, "REPORT ") {
+		return true
+	}
+	lower := strings.ToLower(msg)
+	for _, keyword := range []string{"error", "exception", "panic", "timed out", "fatal"} {
+		if strings.Contains(lower, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+func (x *Generalprobe) diagnosticLambdaLogs(ctx context.Context, functionName string) ([]string, error) {
+	input := cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName:  aws.String(fmt.Sprintf("/aws/lambda/%s", functionName)),
+		StartTime:     toMilliSec(x.StartTime.Add(time.Minute * -1)),
+		FilterPattern: aws.String(diagnosticLogPattern),
+	}
+
+	// Events are returned from the oldest, so all pages are read to keep
+	// the last messages. diagnosticsTimeout limits time to read them.
+	var msgs []string
+	for {
+		resp, err := x.clients.CloudWatchLogs.FilterLogEventsWithContext(ctx, &input)
+		if err != nil {
+			return lastDiagnosticLogs(msgs), errors.Wrapf(err, "Fail to get logs of %s", functionName)
+		}
+
+		for _, event := range resp.Events {
+			if msg := aws.StringValue(event.Message); isDiagnosticLog(msg) {
+				msgs = append(msgs, strings.TrimRight(msg, "\n"))
+			}
+		}
+		if len(msgs) > 2*maxDiagnosticLogs {
+			msgs = lastDiagnosticLogs(msgs)
+		}
+
+		if resp.NextToken == nil {
+			break
+		}
+		input.NextToken = resp.NextToken
+	}
+
+	return lastDiagnosticLogs(msgs), nil
+}
+
+func lastDiagnosticLogs(msgs []string) []string {
+	if len(msgs) > maxDiagnosticLogs {
+		return append([]string{}, msgs[len(msgs)-maxDiagnosticLogs:]...)
+	}
+	return msgs
+}
+
+// write saves diagnostics.json and <LogicalID>.log of Lambda functions
+// to dir.
+func (x *Diagnostics) write(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "Fail to create diagnostics directory: %s", dir)
+	}
+
+	raw, err := json.MarshalIndent(x, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Fail to marshal diagnostics")
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "diagnostics.json"), raw, 0644); err != nil {
+		return errors.Wrapf(err, "Fail to write diagnostics to %s", dir)
+	}
+
+	for _, logs := range x.LambdaLogs {
+		if len(logs.Messages) == 0 {
+			continue
+		}
+		path := filepath.Join(dir, logs.LogicalID+".log")
+		body := strings.Join(logs.Messages, "\n") + "\n"
+		if err := ioutil.WriteFile(path, []byte(body), 0644); err != nil {
+			return errors.Wrapf(err, "Fail to write Lambda logs to %s", path)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package generalprobe_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gp "github.com/m-mizutani/generalprobe"
+)
+
+func TestDiagnostics(t *testing.T) {
+	dir := t.TempDir()
+	_, probe := newFakeStack(t, gp.WithDiagnostics(dir))
+
+	err := probe.Play([]gp.Scene{
+		gp.InvokeLambda(gp.LogicalID("TestHandler"), nil).SnsEvent("not JSON").ExpectFunctionError(),
+		gp.PutKinesisStreamRecord(gp.LogicalID("ResultStream"), []byte(`{"seq":1}`)),
+		gp.GetDynamoRecord(gp.LogicalID("ResultStore"), nil).Key("result_id", "r1").
+			Wait(gp.WaitPolicy{Interval: time.Millisecond, MaxAttempts: 2}),
+	})
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, gp.ErrPollingTimeout))
+
+	var diagErr *gp.DiagnosticsError
+	require.True(t, errors.As(err, &diagErr))
+	diag := diagErr.Diagnostics
+	assert.Equal(t, "CREATE_COMPLETE", diag.StackStatus)
+	assert.Empty(t, diag.Errors)
+
+	require.Equal(t, 1, len(diag.LambdaLogs))
+	logs := diag.LambdaLogs[0]
+	assert.Equal(t, "TestHandler", logs.LogicalID)
+	require.Equal(t, 2, len(logs.Messages))
+	assert.Contains(t, logs.Messages[0], "errorMessage")
+	assert.Contains(t, logs.Messages[1], "REPORT RequestId:")
+
+	require.Equal(t, 2, len(diag.Payloads))
+	assert.Equal(t, "1", diag.Payloads[0].Step)
+	assert.Contains(t, diag.Payloads[0].Payload, "not JSON")
+	assert.Contains(t, diag.Payloads[0].Target, "arn:aws:lambda:")
+	assert.Equal(t, `{"seq":1}`, diag.Payloads[1].Payload)
+
+	assert.Equal(t, filepath.Join(dir, probe.RunID()), diag.Dir)
+	assert.Contains(t, err.Error(), diag.Dir)
+	assert.FileExists(t, filepath.Join(diag.Dir, "diagnostics.json"))
+	raw, rerr := ioutil.ReadFile(filepath.Join(diag.Dir, "TestHandler.log"))
+	require.NoError(t, rerr)
+	assert.Contains(t, string(raw), "REPORT RequestId:")
+}
+
+func TestDiagnosticsLatestLogs(t *testing.T) {
+	backend, probe := newFakeStack(t, gp.WithDiagnostics(t.TempDir()))
+	backend.SetLogPageSize(1)
+	group := "/aws/lambda/" + probe.LookupID("TestHandler")
+	for i := 0; i < 60; i++ {
+		backend.PutLog(group, "old", fmt.Sprintf("[INFO] request %d", i))
+		backend.PutLog(group, "old", fmt.Sprintf("[ERROR] old error %d", i))
+	}
+
+	err := probe.Play([]gp.Scene{
+		gp.InvokeLambda(gp.LogicalID("TestHandler"), nil).SnsEvent("not JSON"),
+	})
+	var diagErr *gp.DiagnosticsError
+	require.True(t, errors.As(err, &diagErr))
+
+	require.Equal(t, 1, len(diagErr.Diagnostics.LambdaLogs))
+	msgs := diagErr.Diagnostics.LambdaLogs[0].Messages
+	require.Equal(t, 50, len(msgs))
+	assert.Equal(t, "[ERROR] old error 12", msgs[0])
+	assert.Contains(t, msgs[48], "errorMessage")
+	assert.Contains(t, msgs[49], "REPORT RequestId:")
+	for _, msg := range msgs {
+		assert.NotContains(t, msg, "[INFO]")
+	}
+}
+
+func TestDiagnosticsDisabled(t *testing.T) {
+	_, probe := newFakeStack(t)
+	err := probe.Play([]gp.Scene{
+		gp.AdLibE(func() error { return errors.New("broken") }),
+	})
+	var diagErr *gp.DiagnosticsError
+	assert.False(t, errors.As(err, &diagErr))
+
+	// Diagnostics are not collected for success.
+	_, probe = newFakeStack(t, gp.WithDiagnostics(""))
+	assert.NoError(t, probe.Play([]gp.Scene{gp.AdLib(func() {})}))
+}
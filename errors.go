@@ -0,0 +1,141 @@
+package generalprobe
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrResourceNotFound means that the target resource does not exist in
+	// the CloudFormation stack or AWS account.
+	ErrResourceNotFound = errors.New("resource not found")
+
+	// ErrUnsupportedResourceType means that the resource type of the target
+	// can not be handled by generalprobe.
+	ErrUnsupportedResourceType = errors.New("unsupported resource type")
+
+	// ErrPollingTimeout means that a polling scene reached retry limit
+	// without expected result.
+	ErrPollingTimeout = errors.New("polling timeout")
+
+	// ErrInvalidArn means that specified ARN has invalid format.
+	ErrInvalidArn = errors.New("invalid ARN format")
+
+	// ErrUnexpectedResult means that a result of scene does not satisfy
+	// Matcher.
+	ErrUnexpectedResult = errors.New("unexpected result")
+
+	// ErrLambdaFunctionError means that invoked Lambda function returned
+	// error (FunctionError of the response is set).
+	ErrLambdaFunctionError = errors.New("Lambda function error")
+)
+
+// SceneError is returned by Play and PlayContext when a scene fails.
+// Cause of the failure can be checked by errors.Is and errors.As.
+type SceneError struct {
+	// Step is 1-origin index of the failed scene in the playbook, or in
+	// the parent scene if the scene is nested.
+	Step int
+	// Path is step path of the nested scene such as "2.3". It is empty
+	// for a top level scene.
+	Path string
+	// Total is number of scenes in the playbook.
+	Total int
+	// Scene is text explanation of the failed scene.
+	Scene string
+	// Err is an error returned from the scene.
+	Err error
+	// Teardown is true if the scene is in Teardown.
+	Teardown bool
+
+	ctxErr error
+}
+
+func (x *SceneError) Error() string {
+	status := "Failed"
+	if x.ctxErr != nil {
+		status = "Interrupted"
+	}
+	step := "step"
+	if x.Teardown {
+		step = "teardown step"
+	}
+
+	path := x.Path
+	if path == "" {
+		path = strconv.Itoa(x.Step)
+	}
+
+	return fmt.Sprintf("%s at %s (%s/%d) %s: %v", status, step, path, x.Total, x.Scene, x.Err)
+}
+
+// Unwrap returns the original error of the scene.
+func (x *SceneError) Unwrap() error { return x.Err }
+
+// Is returns true if the scene was interrupted by context and target is
+// the context error (context.Canceled or context.DeadlineExceeded).
+func (x *SceneError) Is(target error) bool {
+	return x.ctxErr != nil && x.ctxErr == target
+}
+
+// TeardownError is returned by Play and PlayContext when scenes in Teardown
+// fail. Err is the primary failure of the playbook (nil if the playbook
+// succeeded) and TeardownErrors are errors of teardown scenes.
+type TeardownError struct {
+	Err            error
+	TeardownErrors []error
+}
+
+func (x *TeardownError) Error() string {
+	var msgs []string
+	for _, err := range x.TeardownErrors {
+		msgs = append(msgs, err.Error())
+	}
+	teardown := strings.Join(msgs, "; ")
+
+	if x.Err == nil {
+		return "Teardown failed: " + teardown
+	}
+	return fmt.Sprintf("%v (teardown also failed: %s)", x.Err, teardown)
+}
+
+// Unwrap returns the primary failure and errors of teardown scenes for
+// errors.Is and errors.As.
+func (x *TeardownError) Unwrap() []error {
+	var errs []error
+	if x.Err != nil {
+		errs = append(errs, x.Err)
+	}
+	return append(errs, x.TeardownErrors...)
+}
+
+// Is returns true if the primary failure or an error of teardown scenes
+// matches target.
+func (x *TeardownError) Is(target error) bool { return isAny(x.Unwrap(), target) }
+
+// As finds the first error that matches target in the primary failure and
+// errors of teardown scenes.
+func (x *TeardownError) As(target interface{}) bool { return asAny(x.Unwrap(), target) }
+
+// isAny and asAny check each of errs because errors.Is and errors.As follow
+// Unwrap() []error only since Go 1.20.
+func isAny(errs []error, target error) bool {
+	for _, err := range errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func asAny(errs []error, target interface{}) bool {
+	for _, err := range errs {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
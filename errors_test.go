@@ -0,0 +1,58 @@
+package generalprobe_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gp "github.com/m-mizutani/generalprobe"
+	"github.com/m-mizutani/generalprobe/fake"
+)
+
+func TestErrors(t *testing.T) {
+	t.Run("stack not found", func(t *testing.T) {
+		backend := fake.New(fakeRegion, fakeAccount, fakeStackName)
+		_, err := gp.New(fakeRegion, "no-such-stack", gp.WithClients(backend.Clients()))
+		assert.Error(t, err)
+	})
+
+	t.Run("resource not found", func(t *testing.T) {
+		_, probe := newFakeStack(t)
+		err := probe.Play([]gp.Scene{
+			gp.PutKinesisStreamRecord(gp.LogicalID("NoSuchStream"), []byte("x")),
+		})
+
+		var sceneErr *gp.SceneError
+		require.True(t, errors.As(err, &sceneErr))
+		assert.Equal(t, 1, sceneErr.Step)
+		assert.True(t, errors.Is(err, gp.ErrResourceNotFound))
+	})
+
+	t.Run("invalid arn", func(t *testing.T) {
+		_, probe := newFakeStack(t)
+		err := probe.Play([]gp.Scene{
+			gp.PublishSnsMessage(gp.Arn("invalid-arn"), []byte("x")),
+		})
+		assert.True(t, errors.Is(err, gp.ErrInvalidArn))
+	})
+
+	t.Run("failure of AWS API", func(t *testing.T) {
+		_, probe := newFakeStack(t)
+		arn := "arn:aws:lambda:" + fakeRegion + ":" + fakeAccount + ":function:no-such-function"
+		n := 0
+		err := probe.Play([]gp.Scene{
+			gp.AdLib(func() { n++ }),
+			gp.InvokeLambda(gp.Arn(arn), nil).Event(map[string]string{"id": "x"}),
+			gp.AdLib(func() { n++ }),
+		})
+
+		var sceneErr *gp.SceneError
+		require.True(t, errors.As(err, &sceneErr))
+		assert.Equal(t, 2, sceneErr.Step)
+		assert.Equal(t, 3, sceneErr.Total)
+		assert.Contains(t, err.Error(), "Failed at step (2/3)")
+		assert.Equal(t, 1, n)
+	})
+}
@@ -0,0 +1,101 @@
+// Package fake provides in-memory AWS backend for generalprobe. It
+// emulates a CloudFormation stack and its resources (Lambda, SNS, Kinesis,
+// DynamoDB, CloudWatch Logs and S3) so that a playbook can be played inside
+// go test without network access.
+//
+//	backend := fake.New("ap-northeast-1", "123456789012", "test-stack")
+//	backend.AddFunction("TestHandler", func(ctx context.Context, payload []byte) ([]byte, error) {
+//		return []byte(`{"message":"ok"}`), nil
+//	})
+//
+//	probe, err := gp.New("ap-northeast-1", "test-stack", gp.WithClients(backend.Clients()))
+package fake
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/google/uuid"
+
+	gp "github.com/m-mizutani/generalprobe"
+)
+
+// Backend is in-memory AWS environment that has one CloudFormation stack.
+type Backend struct {
+	Region    string
+	Account   string
+	StackName string
+	StackID   string
+
+	mutex     sync.Mutex
+	resources []*cloudformation.StackResource
+	functions map[string]*function
+	topics    map[string]*topic
+	streams   map[string]*stream
+	tables    map[string]*table
+	logGroups map[string]*logGroup
+	buckets   map[string]*bucket
+	queries   map[string]*queryExecution
+
+	// logPageSize is maximum number of events in a page of
+	// FilterLogEvents. Zero means no limit.
+	logPageSize int
+
+	deliveryErrors []error
+}
+
+// New creates an empty stack in region and account.
+func New(region, account, stackName string) *Backend {
+	return &Backend{
+		Region:    region,
+		Account:   account,
+		StackName: stackName,
+		StackID: fmt.Sprintf("arn:aws:cloudformation:%s:%s:stack/%s/%s",
+			region, account, stackName, uuid.New().String()),
+		functions: map[string]*function{},
+		topics:    map[string]*topic{},
+		streams:   map[string]*stream{},
+		tables:    map[string]*table{},
+		logGroups: map[string]*logGroup{},
+		buckets:   map[string]*bucket{},
+		queries:   map[string]*queryExecution{},
+	}
+}
+
+// Clients returns AWS clients connected to the backend. It should be passed
+// to generalprobe.New with generalprobe.WithClients.
+func (x *Backend) Clients() gp.Clients {
+	return gp.Clients{
+		CloudFormation: &cloudFormationClient{backend: x},
+		Lambda:         &lambdaClient{backend: x},
+		SNS:            &snsClient{backend: x},
+		Kinesis:        &kinesisClient{backend: x},
+		DynamoDB:       &dynamoDBClient{backend: x},
+		CloudWatchLogs: &cloudWatchLogsClient{backend: x},
+		S3:             &s3Client{backend: x},
+	}
+}
+
+// addResource registers a resource to the stack. It must be called with lock.
+func (x *Backend) addResource(logicalID, physicalID, resourceType string) {
+	x.resources = append(x.resources, &cloudformation.StackResource{
+		LogicalResourceId:  aws.String(logicalID),
+		PhysicalResourceId: aws.String(physicalID),
+		ResourceType:       aws.String(resourceType),
+		ResourceStatus:     aws.String(cloudformation.ResourceStatusCreateComplete),
+		StackName:          aws.String(x.StackName),
+		StackId:            aws.String(x.StackID),
+		Timestamp:          aws.Time(time.Now().UTC()),
+	})
+}
+
+func (x *Backend) physicalName(logicalID string) string {
+	return fmt.Sprintf("%s-%s", x.StackName, logicalID)
+}
+
+func (x *Backend) arn(service, resource string) string {
+	return fmt.Sprintf("arn:aws:%s:%s:%s:%s", service, x.Region, x.Account, resource)
+}
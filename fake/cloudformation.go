@@ -0,0 +1,59 @@
+package fake
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudformation/cloudformationiface"
+)
+
+type cloudFormationClient struct {
+	cloudformationiface.CloudFormationAPI
+	backend *Backend
+}
+
+func (x *cloudFormationClient) checkStack(stackName *string) error {
+	name := aws.StringValue(stackName)
+	if name != x.backend.StackName && name != x.backend.StackID {
+		return awserr.New("ValidationError", "Stack with id "+name+" does not exist", nil)
+	}
+	return nil
+}
+
+func (x *cloudFormationClient) DescribeStackResources(input *cloudformation.DescribeStackResourcesInput) (*cloudformation.DescribeStackResourcesOutput, error) {
+	return x.DescribeStackResourcesWithContext(aws.BackgroundContext(), input)
+}
+
+func (x *cloudFormationClient) DescribeStackResourcesWithContext(ctx aws.Context, input *cloudformation.DescribeStackResourcesInput, opts ...request.Option) (*cloudformation.DescribeStackResourcesOutput, error) {
+	if err := x.checkStack(input.StackName); err != nil {
+		return nil, err
+	}
+
+	x.backend.mutex.Lock()
+	defer x.backend.mutex.Unlock()
+
+	resources := make([]*cloudformation.StackResource, len(x.backend.resources))
+	copy(resources, x.backend.resources)
+	return &cloudformation.DescribeStackResourcesOutput{StackResources: resources}, nil
+}
+
+func (x *cloudFormationClient) DescribeStacks(input *cloudformation.DescribeStacksInput) (*cloudformation.DescribeStacksOutput, error) {
+	return x.DescribeStacksWithContext(aws.BackgroundContext(), input)
+}
+
+func (x *cloudFormationClient) DescribeStacksWithContext(ctx aws.Context, input *cloudformation.DescribeStacksInput, opts ...request.Option) (*cloudformation.DescribeStacksOutput, error) {
+	if err := x.checkStack(input.StackName); err != nil {
+		return nil, err
+	}
+
+	return &cloudformation.DescribeStacksOutput{
+		Stacks: []*cloudformation.Stack{
+			{
+				StackName:   aws.String(x.backend.StackName),
+				StackId:     aws.String(x.backend.StackID),
+				StackStatus: aws.String(cloudformation.StackStatusCreateComplete),
+			},
+		},
+	}, nil
+}
@@ -0,0 +1,170 @@
+package fake
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	"github.com/google/uuid"
+)
+
+type logGroup struct {
+	name   string
+	events []*cloudwatchlogs.FilteredLogEvent
+}
+
+// AddLogGroup adds AWS::Logs::LogGroup resource and returns name of the
+// log group.
+func (x *Backend) AddLogGroup(logicalID string) string {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	name := x.physicalName(logicalID)
+	x.logGroups[name] = &logGroup{name: name}
+	x.addResource(logicalID, name, "AWS::Logs::LogGroup")
+	return name
+}
+
+// PutLog writes message to the log stream of CloudWatch Logs. The log group
+// is created if not exists.
+func (x *Backend) PutLog(groupName, streamName, message string) {
+	x.PutLogAt(groupName, streamName, message, time.Now())
+}
+
+// PutLogAt writes message with timestamp to the log stream of CloudWatch
+// Logs, e.g. to emulate logs delivered long after start of a test.
+func (x *Backend) PutLogAt(groupName, streamName, message string, timestamp time.Time) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	group, ok := x.logGroups[groupName]
+	if !ok {
+		group = &logGroup{name: groupName}
+		x.logGroups[groupName] = group
+	}
+
+	group.events = append(group.events, &cloudwatchlogs.FilteredLogEvent{
+		EventId:       aws.String(uuid.New().String()),
+		IngestionTime: aws.Int64(time.Now().UnixNano() / int64(time.Millisecond)),
+		LogStreamName: aws.String(streamName),
+		Message:       aws.String(message),
+		Timestamp:     aws.Int64(timestamp.UnixNano() / int64(time.Millisecond)),
+	})
+}
+
+// SetLogPageSize sets maximum number of events in a page of FilterLogEvents
+// to test pagination. Zero (default) means no limit.
+func (x *Backend) SetLogPageSize(size int) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.logPageSize = size
+}
+
+// matchFilterPattern supports only terms of filter pattern. A quoted term is
+// matched as a phrase and all terms must be contained in the message. Terms
+// with "?" prefix are OR condition and one of them must be contained.
+func matchFilterPattern(pattern, message string) bool {
+	var terms, optionalTerms []string
+	for len(pattern) > 0 {
+		pattern = strings.TrimLeft(pattern, " ")
+		optional := strings.HasPrefix(pattern, "?")
+		if optional {
+			pattern = pattern[1:]
+		}
+
+		var term string
+		if strings.HasPrefix(pattern, "\"") {
+			end := strings.Index(pattern[1:], "\"")
+			if end < 0 {
+				term, pattern = pattern[1:], ""
+			} else {
+				term, pattern = pattern[1:end+1], pattern[end+2:]
+			}
+		} else {
+			end := strings.Index(pattern, " ")
+			if end < 0 {
+				end = len(pattern)
+			}
+			term, pattern = pattern[:end], pattern[end:]
+		}
+
+		switch {
+		case term == "":
+		case optional:
+			optionalTerms = append(optionalTerms, term)
+		default:
+			terms = append(terms, term)
+		}
+	}
+
+	for _, term := range terms {
+		if !strings.Contains(message, term) {
+			return false
+		}
+	}
+	for _, term := range optionalTerms {
+		if strings.Contains(message, term) {
+			return true
+		}
+	}
+	return len(optionalTerms) == 0
+}
+
+type cloudWatchLogsClient struct {
+	cloudwatchlogsiface.CloudWatchLogsAPI
+	backend *Backend
+}
+
+func (x *cloudWatchLogsClient) FilterLogEventsWithContext(ctx aws.Context, input *cloudwatchlogs.FilterLogEventsInput, opts ...request.Option) (*cloudwatchlogs.FilterLogEventsOutput, error) {
+	x.backend.mutex.Lock()
+	defer x.backend.mutex.Unlock()
+
+	groupName := aws.StringValue(input.LogGroupName)
+	group, ok := x.backend.logGroups[groupName]
+	if !ok {
+		return nil, awserr.New(cloudwatchlogs.ErrCodeResourceNotFoundException,
+			"The specified log group does not exist: "+groupName, nil)
+	}
+
+	events := []*cloudwatchlogs.FilteredLogEvent{}
+	for _, ev := range group.events {
+		ts := aws.Int64Value(ev.Timestamp)
+		switch {
+		case input.StartTime != nil && ts < *input.StartTime:
+			continue
+		case input.EndTime != nil && ts > *input.EndTime:
+			continue
+		case input.FilterPattern != nil &&
+			!matchFilterPattern(*input.FilterPattern, aws.StringValue(ev.Message)):
+			continue
+		}
+		events = append(events, ev)
+	}
+
+	// NextToken is offset of the next page.
+	offset := 0
+	if input.NextToken != nil {
+		n, err := strconv.Atoi(*input.NextToken)
+		if err != nil || n < 0 || n > len(events) {
+			return nil, awserr.New(cloudwatchlogs.ErrCodeInvalidParameterException,
+				"The specified nextToken is invalid: "+*input.NextToken, nil)
+		}
+		offset = n
+	}
+	size := x.backend.logPageSize
+	if input.Limit != nil && (size == 0 || int(*input.Limit) < size) {
+		size = int(*input.Limit)
+	}
+
+	output := &cloudwatchlogs.FilterLogEventsOutput{Events: events[offset:]}
+	if size > 0 && len(events)-offset > size {
+		output.Events = events[offset : offset+size]
+		output.NextToken = aws.String(strconv.Itoa(offset + size))
+	}
+	return output, nil
+}
@@ -0,0 +1,329 @@
+package fake
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/pkg/errors"
+)
+
+type dynamoItem map[string]*dynamodb.AttributeValue
+
+type table struct {
+	name     string
+	hashKey  string
+	rangeKey string
+	items    []dynamoItem
+}
+
+// AddTable registers a DynamoDB table as logicalID of the stack. rangeKey
+// can be empty if the table has only hash key. It returns physical name of
+// the table.
+func (x *Backend) AddTable(logicalID, hashKey, rangeKey string) string {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	name := x.physicalName(logicalID)
+	x.tables[name] = &table{name: name, hashKey: hashKey, rangeKey: rangeKey}
+	x.addResource(logicalID, name, "AWS::DynamoDB::Table")
+	return name
+}
+
+// PutItem stores item (struct or map) into the table. It can be used in
+// LambdaHandler to emulate writing by Lambda function.
+func (x *Backend) PutItem(tableName string, item interface{}) error {
+	attrs, err := dynamodbattribute.MarshalMap(item)
+	if err != nil {
+		return errors.Wrap(err, "Fail to marshal DynamoDB item")
+	}
+
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	t, err := x.lookupTable(tableName)
+	if err != nil {
+		return err
+	}
+	return t.put(attrs)
+}
+
+// TableItems returns number of items in the table.
+func (x *Backend) TableItems(tableName string) int {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	if t, ok := x.tables[tableName]; ok {
+		return len(t.items)
+	}
+	return 0
+}
+
+func (x *Backend) lookupTable(name string) (*table, error) {
+	t, ok := x.tables[name]
+	if !ok {
+		return nil, awserr.New(dynamodb.ErrCodeResourceNotFoundException,
+			"Requested resource not found: Table: "+name+" not found", nil)
+	}
+	return t, nil
+}
+
+func (x *table) key(item dynamoItem) dynamoItem {
+	key := dynamoItem{x.hashKey: item[x.hashKey]}
+	if x.rangeKey != "" {
+		key[x.rangeKey] = item[x.rangeKey]
+	}
+	return key
+}
+
+func (x *table) index(key dynamoItem) int {
+	for i, item := range x.items {
+		if matchKey(item, x.key(key)) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (x *table) put(item dynamoItem) error {
+	for _, k := range x.key(item) {
+		if k == nil {
+			return awserr.New("ValidationException",
+				"One or more parameter values were invalid: Missing the key in the item", nil)
+		}
+	}
+
+	if idx := x.index(item); idx >= 0 {
+		x.items[idx] = item
+	} else {
+		x.items = append(x.items, item)
+	}
+	return nil
+}
+
+func matchKey(item, key dynamoItem) bool {
+	for name, v := range key {
+		if compareAttr(item[name], v) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// compareAttr compares scalar attribute values (S, N and B). It returns
+// non-zero if a or b is nil or types are mismatched.
+func compareAttr(a, b *dynamodb.AttributeValue) int {
+	switch {
+	case a == nil || b == nil:
+		return -2
+	case a.S != nil && b.S != nil:
+		return strings.Compare(*a.S, *b.S)
+	case a.N != nil && b.N != nil:
+		an, _ := strconv.ParseFloat(*a.N, 64)
+		bn, _ := strconv.ParseFloat(*b.N, 64)
+		switch {
+		case an < bn:
+			return -1
+		case an > bn:
+			return 1
+		}
+		return 0
+	case a.B != nil && b.B != nil:
+		return bytes.Compare(a.B, b.B)
+	}
+	return -2
+}
+
+func matchCondition(v *dynamodb.AttributeValue, cond *dynamodb.Condition) (bool, error) {
+	args := cond.AttributeValueList
+	op := aws.StringValue(cond.ComparisonOperator)
+
+	cmp := func(i int) int {
+		if i >= len(args) {
+			return -2
+		}
+		return compareAttr(v, args[i])
+	}
+	inRange := func(c int) bool { return c != -2 }
+
+	switch op {
+	case dynamodb.ComparisonOperatorEq:
+		return cmp(0) == 0, nil
+	case dynamodb.ComparisonOperatorLt:
+		c := cmp(0)
+		return inRange(c) && c < 0, nil
+	case dynamodb.ComparisonOperatorLe:
+		c := cmp(0)
+		return inRange(c) && c <= 0, nil
+	case dynamodb.ComparisonOperatorGt:
+		c := cmp(0)
+		return inRange(c) && c > 0, nil
+	case dynamodb.ComparisonOperatorGe:
+		c := cmp(0)
+		return inRange(c) && c >= 0, nil
+	case dynamodb.ComparisonOperatorBetween:
+		lo, hi := cmp(0), cmp(1)
+		return inRange(lo) && inRange(hi) && lo >= 0 && hi <= 0, nil
+	case dynamodb.ComparisonOperatorBeginsWith:
+		if v == nil || v.S == nil || len(args) == 0 || args[0].S == nil {
+			return false, nil
+		}
+		return strings.HasPrefix(*v.S, *args[0].S), nil
+	}
+
+	return false, awserr.New("ValidationException", "Unsupported ComparisonOperator: "+op, nil)
+}
+
+type dynamoDBClient struct {
+	dynamodbiface.DynamoDBAPI
+	backend *Backend
+}
+
+// DescribeTableWithContext returns key schema and ARNs of the table. The
+// table always has a stream.
+func (x *dynamoDBClient) DescribeTableWithContext(ctx aws.Context, input *dynamodb.DescribeTableInput, opts ...request.Option) (*dynamodb.DescribeTableOutput, error) {
+	x.backend.mutex.Lock()
+	defer x.backend.mutex.Unlock()
+
+	t, err := x.backend.lookupTable(aws.StringValue(input.TableName))
+	if err != nil {
+		return nil, err
+	}
+
+	tableArn := x.backend.arn("dynamodb", "table/"+t.name)
+	keySchema := []*dynamodb.KeySchemaElement{
+		{AttributeName: aws.String(t.hashKey), KeyType: aws.String(dynamodb.KeyTypeHash)},
+	}
+	if t.rangeKey != "" {
+		keySchema = append(keySchema, &dynamodb.KeySchemaElement{
+			AttributeName: aws.String(t.rangeKey), KeyType: aws.String(dynamodb.KeyTypeRange),
+		})
+	}
+
+	return &dynamodb.DescribeTableOutput{
+		Table: &dynamodb.TableDescription{
+			TableName:       aws.String(t.name),
+			TableArn:        aws.String(tableArn),
+			TableStatus:     aws.String(dynamodb.TableStatusActive),
+			KeySchema:       keySchema,
+			LatestStreamArn: aws.String(tableArn + "/stream/2018-01-01T00:00:00.000"),
+		},
+	}, nil
+}
+
+func (x *dynamoDBClient) GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput, opts ...request.Option) (*dynamodb.GetItemOutput, error) {
+	x.backend.mutex.Lock()
+	defer x.backend.mutex.Unlock()
+
+	t, err := x.backend.lookupTable(aws.StringValue(input.TableName))
+	if err != nil {
+		return nil, err
+	}
+
+	output := &dynamodb.GetItemOutput{}
+	if idx := t.index(input.Key); idx >= 0 {
+		output.Item = t.items[idx]
+	}
+	return output, nil
+}
+
+func (x *dynamoDBClient) PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput, opts ...request.Option) (*dynamodb.PutItemOutput, error) {
+	x.backend.mutex.Lock()
+	defer x.backend.mutex.Unlock()
+
+	t, err := x.backend.lookupTable(aws.StringValue(input.TableName))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.put(input.Item); err != nil {
+		return nil, err
+	}
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (x *dynamoDBClient) DeleteItemWithContext(ctx aws.Context, input *dynamodb.DeleteItemInput, opts ...request.Option) (*dynamodb.DeleteItemOutput, error) {
+	x.backend.mutex.Lock()
+	defer x.backend.mutex.Unlock()
+
+	t, err := x.backend.lookupTable(aws.StringValue(input.TableName))
+	if err != nil {
+		return nil, err
+	}
+
+	output := &dynamodb.DeleteItemOutput{}
+	if idx := t.index(input.Key); idx >= 0 {
+		output.Attributes = t.items[idx]
+		t.items = append(t.items[:idx], t.items[idx+1:]...)
+	}
+	return output, nil
+}
+
+func (x *dynamoDBClient) QueryWithContext(ctx aws.Context, input *dynamodb.QueryInput, opts ...request.Option) (*dynamodb.QueryOutput, error) {
+	if input.FilterExpression != nil || input.KeyConditionExpression != nil {
+		return nil, awserr.New("ValidationException",
+			"Expression is not supported by fake backend, use KeyConditions", nil)
+	}
+
+	x.backend.mutex.Lock()
+	defer x.backend.mutex.Unlock()
+
+	t, err := x.backend.lookupTable(aws.StringValue(input.TableName))
+	if err != nil {
+		return nil, err
+	}
+
+	items := []map[string]*dynamodb.AttributeValue{}
+	for _, item := range t.items {
+		matched := true
+		for name, cond := range input.KeyConditions {
+			ok, err := matchCondition(item[name], cond)
+			if err != nil {
+				return nil, err
+			}
+			matched = matched && ok
+		}
+
+		if matched {
+			items = append(items, item)
+		}
+	}
+
+	return &dynamodb.QueryOutput{
+		Items:        items,
+		Count:        aws.Int64(int64(len(items))),
+		ScannedCount: aws.Int64(int64(len(items))),
+	}, nil
+}
+
+func (x *dynamoDBClient) ScanWithContext(ctx aws.Context, input *dynamodb.ScanInput, opts ...request.Option) (*dynamodb.ScanOutput, error) {
+	if input.FilterExpression != nil {
+		return nil, awserr.New("ValidationException",
+			"FilterExpression is not supported by fake backend", nil)
+	}
+
+	x.backend.mutex.Lock()
+	defer x.backend.mutex.Unlock()
+
+	t, err := x.backend.lookupTable(aws.StringValue(input.TableName))
+	if err != nil {
+		return nil, err
+	}
+
+	items := []map[string]*dynamodb.AttributeValue{}
+	for _, item := range t.items {
+		items = append(items, item)
+	}
+
+	return &dynamodb.ScanOutput{
+		Items:        items,
+		Count:        aws.Int64(int64(len(items))),
+		ScannedCount: aws.Int64(int64(len(items))),
+	}, nil
+}
@@ -0,0 +1,53 @@
+package fake
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchFilterPattern(t *testing.T) {
+	assert.True(t, matchFilterPattern(`"abc def"`, "xx abc def yy"))
+	assert.False(t, matchFilterPattern(`"abc def"`, "xx abc yy def"))
+	assert.True(t, matchFilterPattern(`abc def`, "xx def yy abc"))
+	assert.False(t, matchFilterPattern(`abc zzz`, "xx def yy abc"))
+	assert.True(t, matchFilterPattern(``, "anything"))
+	assert.True(t, matchFilterPattern(`?ERROR ?"timed out"`, "Task timed out after 3.00 seconds"))
+	assert.False(t, matchFilterPattern(`?ERROR ?"timed out"`, "[INFO] ok"))
+	assert.True(t, matchFilterPattern(`abc ?x ?y`, "abc y"))
+	assert.False(t, matchFilterPattern(`abc ?x ?y`, "abc z"))
+	assert.False(t, matchFilterPattern(`abc ?x ?y`, "x y"))
+}
+
+func TestDynamoDBQuery(t *testing.T) {
+	backend := New("us-east-1", "123456789012", "stack")
+	name := backend.AddTable("Table", "pk", "sk")
+
+	for _, sk := range []int{1, 2, 3} {
+		require.NoError(t, backend.PutItem(name, map[string]interface{}{"pk": "a", "sk": sk}))
+	}
+	require.NoError(t, backend.PutItem(name, map[string]interface{}{"pk": "b", "sk": 1}))
+	// Overwrite existing item
+	require.NoError(t, backend.PutItem(name, map[string]interface{}{"pk": "a", "sk": 1, "v": "x"}))
+	assert.Equal(t, 4, backend.TableItems(name))
+
+	client := backend.Clients().DynamoDB
+	resp, err := client.QueryWithContext(aws.BackgroundContext(), &dynamodb.QueryInput{
+		TableName: aws.String(name),
+		KeyConditions: map[string]*dynamodb.Condition{
+			"pk": {
+				ComparisonOperator: aws.String("EQ"),
+				AttributeValueList: []*dynamodb.AttributeValue{{S: aws.String("a")}},
+			},
+			"sk": {
+				ComparisonOperator: aws.String("GE"),
+				AttributeValueList: []*dynamodb.AttributeValue{{N: aws.String("2")}},
+			},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(resp.Items))
+}
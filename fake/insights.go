@@ -0,0 +1,538 @@
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/google/uuid"
+
+	gp "github.com/m-mizutani/generalprobe"
+)
+
+// insightsTimeFormat is format of @timestamp in results of Logs Insights.
+const insightsTimeFormat = "2006-01-02 15:04:05.000"
+
+// insightsRecord is a log event or an aggregated row in a query.
+type insightsRecord map[string]string
+
+// insightsCommand is a command of query such as "filter" and "stats".
+type insightsCommand func(records []insightsRecord) []insightsRecord
+
+// insightsQuery is a parsed query of Logs Insights. The fake supports only
+// fields, display, filter, stats, sort and limit commands.
+type insightsQuery struct {
+	commands []insightsCommand
+	display  []string
+	limit    int
+}
+
+// queryExecution is a query started by StartQuery. The first
+// GetQueryResults returns Running status to emulate asynchronous query.
+type queryExecution struct {
+	status     string
+	polled     bool
+	results    [][]*cloudwatchlogs.ResultField
+	statistics *cloudwatchlogs.QueryStatistics
+}
+
+func malformedQuery(format string, args ...interface{}) error {
+	return awserr.New(cloudwatchlogs.ErrCodeMalformedQueryException, fmt.Sprintf(format, args...), nil)
+}
+
+// splitQuery splits s by sep out of quotes and regular expressions.
+func splitQuery(s string, sep byte) []string {
+	var parts []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '/':
+			quote = c
+		case c == sep:
+			parts = append(parts, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(parts, strings.TrimSpace(s[start:]))
+}
+
+func parseInsightsQuery(query string) (*insightsQuery, error) {
+	q := &insightsQuery{display: []string{"@timestamp", "@message"}, limit: 1000}
+
+	for _, part := range splitQuery(query, '|') {
+		if part == "" {
+			continue
+		}
+		fields := strings.SplitN(part, " ", 2)
+		command, args := strings.ToLower(fields[0]), ""
+		if len(fields) == 2 {
+			args = strings.TrimSpace(fields[1])
+		}
+
+		switch command {
+		case "fields", "display":
+			q.display = splitQuery(args, ',')
+
+		case "filter":
+			filter, err := parseInsightsFilter(args)
+			if err != nil {
+				return nil, err
+			}
+			q.commands = append(q.commands, func(records []insightsRecord) []insightsRecord {
+				var matched []insightsRecord
+				for _, r := range records {
+					if filter(r) {
+						matched = append(matched, r)
+					}
+				}
+				return matched
+			})
+
+		case "stats":
+			stats, display, err := parseInsightsStats(args)
+			if err != nil {
+				return nil, err
+			}
+			q.commands = append(q.commands, stats)
+			q.display = display
+
+		case "sort":
+			q.commands = append(q.commands, parseInsightsSort(args))
+
+		case "limit":
+			n, err := strconv.Atoi(args)
+			if err != nil || n <= 0 {
+				return nil, malformedQuery("Invalid limit: %s", args)
+			}
+			q.limit = n
+
+		default:
+			return nil, malformedQuery("Unsupported command in fake Logs Insights: %s", command)
+		}
+	}
+
+	return q, nil
+}
+
+var insightsComparison = regexp.MustCompile(`^(\S+)\s*(=|!=|>=|<=|>|<)\s*(.+)$`)
+
+// parseInsightsFilter supports conditions joined by "and": "field like
+// /regex/", "field like 'substring'", comparison and ispresent(field).
+func parseInsightsFilter(expr string) (func(insightsRecord) bool, error) {
+	var conds []func(insightsRecord) bool
+	for _, cond := range regexp.MustCompile(`(?i)\s+and\s+`).Split(expr, -1) {
+		cond = strings.TrimSpace(cond)
+
+		switch {
+		case strings.HasPrefix(cond, "ispresent(") && strings.HasSuffix(cond, ")"):
+			field := strings.TrimSuffix(strings.TrimPrefix(cond, "ispresent("), ")")
+			conds = append(conds, func(r insightsRecord) bool {
+				_, ok := r[field]
+				return ok
+			})
+
+		case strings.Contains(cond, " like "):
+			kv := strings.SplitN(cond, " like ", 2)
+			field, pattern := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+			if len(pattern) >= 2 && pattern[0] == '/' && pattern[len(pattern)-1] == '/' {
+				re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+				if err != nil {
+					return nil, malformedQuery("Invalid regular expression: %s", pattern)
+				}
+				conds = append(conds, func(r insightsRecord) bool { return re.MatchString(r[field]) })
+			} else {
+				substr := unquote(pattern)
+				conds = append(conds, func(r insightsRecord) bool { return strings.Contains(r[field], substr) })
+			}
+
+		default:
+			m := insightsComparison.FindStringSubmatch(cond)
+			if m == nil {
+				return nil, malformedQuery("Unsupported filter in fake Logs Insights: %s", cond)
+			}
+			field, op, value := m[1], m[2], unquote(strings.TrimSpace(m[3]))
+			conds = append(conds, func(r insightsRecord) bool {
+				actual, ok := r[field]
+				return ok && compareInsightsValue(actual, value, op)
+			})
+		}
+	}
+
+	return func(r insightsRecord) bool {
+		for _, cond := range conds {
+			if !cond(r) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+func compareInsightsValue(actual, expected, op string) bool {
+	cmp := strings.Compare(actual, expected)
+	a, aerr := strconv.ParseFloat(actual, 64)
+	e, eerr := strconv.ParseFloat(expected, 64)
+	if aerr == nil && eerr == nil {
+		switch {
+		case a < e:
+			cmp = -1
+		case a > e:
+			cmp = 1
+		default:
+			cmp = 0
+		}
+	}
+
+	switch op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	default:
+		return cmp <= 0
+	}
+}
+
+var insightsAggregation = regexp.MustCompile(`^(\w+)\(\s*([^)]*?)\s*\)(?:\s+as\s+(\S+))?$`)
+
+// parseInsightsStats supports count, count_distinct, sum, avg, min and max
+// with "by" fields.
+func parseInsightsStats(args string) (insightsCommand, []string, error) {
+	var groupBy []string
+	if idx := strings.Index(strings.ToLower(args), " by "); idx >= 0 {
+		groupBy = splitQuery(args[idx+4:], ',')
+		args = args[:idx]
+	}
+
+	type aggregation struct {
+		name, fn, field string
+	}
+	var aggs []aggregation
+	for _, expr := range splitQuery(args, ',') {
+		m := insightsAggregation.FindStringSubmatch(expr)
+		if m == nil {
+			return nil, nil, malformedQuery("Unsupported stats in fake Logs Insights: %s", expr)
+		}
+		agg := aggregation{name: m[3], fn: strings.ToLower(m[1]), field: m[2]}
+		if agg.name == "" {
+			agg.name = fmt.Sprintf("%s(%s)", m[1], m[2])
+		}
+		switch agg.fn {
+		case "count", "count_distinct", "sum", "avg", "min", "max":
+		default:
+			return nil, nil, malformedQuery("Unsupported function in fake Logs Insights: %s", agg.fn)
+		}
+		aggs = append(aggs, agg)
+	}
+
+	display := append([]string{}, groupBy...)
+	for _, agg := range aggs {
+		display = append(display, agg.name)
+	}
+
+	stats := func(records []insightsRecord) []insightsRecord {
+		var keys []string
+		groups := map[string][]insightsRecord{}
+		for _, r := range records {
+			var values []string
+			for _, field := range groupBy {
+				values = append(values, r[field])
+			}
+			key := strings.Join(values, "\x00")
+			if _, ok := groups[key]; !ok {
+				keys = append(keys, key)
+			}
+			groups[key] = append(groups[key], r)
+		}
+
+		var results []insightsRecord
+		for _, key := range keys {
+			group := groups[key]
+			result := insightsRecord{}
+			for _, field := range groupBy {
+				if v, ok := group[0][field]; ok {
+					result[field] = v
+				}
+			}
+
+			for _, agg := range aggs {
+				var values []float64
+				distinct := map[string]bool{}
+				count := 0
+				for _, r := range group {
+					v, ok := r[agg.field]
+					if agg.field != "*" && !ok {
+						continue
+					}
+					count++
+					distinct[v] = true
+					if f, err := strconv.ParseFloat(v, 64); err == nil {
+						values = append(values, f)
+					}
+				}
+
+				switch agg.fn {
+				case "count":
+					result[agg.name] = strconv.Itoa(count)
+				case "count_distinct":
+					result[agg.name] = strconv.Itoa(len(distinct))
+				default:
+					if len(values) == 0 {
+						continue
+					}
+					v := values[0]
+					for _, f := range values[1:] {
+						switch agg.fn {
+						case "min":
+							if f < v {
+								v = f
+							}
+						case "max":
+							if f > v {
+								v = f
+							}
+						default:
+							v += f
+						}
+					}
+					if agg.fn == "avg" {
+						v /= float64(len(values))
+					}
+					result[agg.name] = strconv.FormatFloat(v, 'f', -1, 64)
+				}
+			}
+			results = append(results, result)
+		}
+		return results
+	}
+
+	return stats, display, nil
+}
+
+func parseInsightsSort(args string) insightsCommand {
+	type sortKey struct {
+		field string
+		desc  bool
+	}
+	var keys []sortKey
+	for _, expr := range splitQuery(args, ',') {
+		fields := strings.Fields(expr)
+		if len(fields) == 0 {
+			continue
+		}
+		keys = append(keys, sortKey{field: fields[0], desc: len(fields) > 1 && strings.ToLower(fields[1]) == "desc"})
+	}
+
+	return func(records []insightsRecord) []insightsRecord {
+		sort.SliceStable(records, func(i, j int) bool {
+			for _, key := range keys {
+				a, b := records[i][key.field], records[j][key.field]
+				if a == b {
+					continue
+				}
+				less := compareInsightsValue(a, b, "<")
+				if key.desc {
+					return !less
+				}
+				return less
+			}
+			return false
+		})
+		return records
+	}
+}
+
+// newInsightsRecord extracts fields of a log event. Fields of JSON message
+// and fields of Lambda (@type, @requestId, @duration and so on) are
+// discovered like Logs Insights.
+func (x *Backend) newInsightsRecord(group *logGroup, ev *cloudwatchlogs.FilteredLogEvent) insightsRecord {
+	msg := aws.StringValue(ev.Message)
+	ts := time.Unix(0, aws.Int64Value(ev.Timestamp)*int64(time.Millisecond)).UTC()
+	r := insightsRecord{
+		"@timestamp": ts.Format(insightsTimeFormat),
+		"@message":   msg,
+		"@logStream": aws.StringValue(ev.LogStreamName),
+		"@log":       x.Account + ":" + group.name,
+	}
+
+	var body map[string]interface{}
+	if json.Unmarshal([]byte(msg), &body) == nil {
+		flattenInsightsFields(r, "", body)
+	}
+
+	if strings.HasPrefix(group.name, "/aws/lambda/") {
+		parsed := gp.ParseLambdaLog(msg)
+		if parsed.Type != gp.LambdaLogMessage {
+			r["@type"] = string(parsed.Type)
+			r["@requestId"] = parsed.RequestID
+		}
+		if report := parsed.Report; report != nil {
+			ms := func(d time.Duration) string {
+				return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', -1, 64)
+			}
+			r["@duration"] = ms(report.Duration)
+			r["@billedDuration"] = ms(report.BilledDuration)
+			r["@memorySize"] = strconv.Itoa(report.MemorySize * 1000000)
+			r["@maxMemoryUsed"] = strconv.Itoa(report.MaxMemoryUsed * 1000000)
+			if report.InitDuration > 0 {
+				r["@initDuration"] = ms(report.InitDuration)
+			}
+		}
+	}
+	return r
+}
+
+func flattenInsightsFields(r insightsRecord, prefix string, body map[string]interface{}) {
+	for k, v := range body {
+		switch value := v.(type) {
+		case map[string]interface{}:
+			flattenInsightsFields(r, prefix+k+".", value)
+		case string:
+			r[prefix+k] = value
+		case nil:
+		default:
+			raw, _ := json.Marshal(value)
+			r[prefix+k] = string(raw)
+		}
+	}
+}
+
+func (x *cloudWatchLogsClient) StartQueryWithContext(ctx aws.Context, input *cloudwatchlogs.StartQueryInput, opts ...request.Option) (*cloudwatchlogs.StartQueryOutput, error) {
+	x.backend.mutex.Lock()
+	defer x.backend.mutex.Unlock()
+
+	groupNames := aws.StringValueSlice(input.LogGroupNames)
+	if input.LogGroupName != nil {
+		groupNames = append(groupNames, *input.LogGroupName)
+	}
+	if len(groupNames) == 0 {
+		return nil, awserr.New(cloudwatchlogs.ErrCodeInvalidParameterException, "Log group is required", nil)
+	}
+
+	query, err := parseInsightsQuery(aws.StringValue(input.QueryString))
+	if err != nil {
+		return nil, err
+	}
+	if input.Limit != nil {
+		query.limit = int(*input.Limit)
+	}
+
+	// StartTime and EndTime of StartQuery are UNIX time in seconds.
+	start := aws.Int64Value(input.StartTime) * 1000
+	end := aws.Int64Value(input.EndTime)*1000 + 999
+
+	var records []insightsRecord
+	var scanned, bytes float64
+	for _, name := range groupNames {
+		group, ok := x.backend.logGroups[name]
+		if !ok {
+			return nil, awserr.New(cloudwatchlogs.ErrCodeResourceNotFoundException,
+				"The specified log group does not exist: "+name, nil)
+		}
+		for _, ev := range group.events {
+			if ts := aws.Int64Value(ev.Timestamp); ts < start || end < ts {
+				continue
+			}
+			scanned++
+			bytes += float64(len(aws.StringValue(ev.Message)))
+			records = append(records, x.backend.newInsightsRecord(group, ev))
+		}
+	}
+
+	for _, command := range query.commands {
+		records = command(records)
+	}
+	if len(records) > query.limit {
+		records = records[:query.limit]
+	}
+
+	exec := &queryExecution{
+		status: cloudwatchlogs.QueryStatusRunning,
+		statistics: &cloudwatchlogs.QueryStatistics{
+			RecordsMatched: aws.Float64(float64(len(records))),
+			RecordsScanned: aws.Float64(scanned),
+			BytesScanned:   aws.Float64(bytes),
+		},
+	}
+	for _, r := range records {
+		var row []*cloudwatchlogs.ResultField
+		for _, field := range query.display {
+			if v, ok := r[field]; ok {
+				row = append(row, &cloudwatchlogs.ResultField{Field: aws.String(field), Value: aws.String(v)})
+			}
+		}
+		row = append(row, &cloudwatchlogs.ResultField{Field: aws.String("@ptr"), Value: aws.String(uuid.New().String())})
+		exec.results = append(exec.results, row)
+	}
+
+	queryID := uuid.New().String()
+	x.backend.queries[queryID] = exec
+	return &cloudwatchlogs.StartQueryOutput{QueryId: aws.String(queryID)}, nil
+}
+
+func (x *cloudWatchLogsClient) GetQueryResultsWithContext(ctx aws.Context, input *cloudwatchlogs.GetQueryResultsInput, opts ...request.Option) (*cloudwatchlogs.GetQueryResultsOutput, error) {
+	x.backend.mutex.Lock()
+	defer x.backend.mutex.Unlock()
+
+	exec, ok := x.backend.queries[aws.StringValue(input.QueryId)]
+	if !ok {
+		return nil, awserr.New(cloudwatchlogs.ErrCodeResourceNotFoundException,
+			"Query does not exist: "+aws.StringValue(input.QueryId), nil)
+	}
+
+	if !exec.polled {
+		exec.polled = true
+		return &cloudwatchlogs.GetQueryResultsOutput{
+			Status:     aws.String(exec.status),
+			Results:    [][]*cloudwatchlogs.ResultField{},
+			Statistics: &cloudwatchlogs.QueryStatistics{},
+		}, nil
+	}
+	if exec.status == cloudwatchlogs.QueryStatusRunning {
+		exec.status = cloudwatchlogs.QueryStatusComplete
+	}
+
+	return &cloudwatchlogs.GetQueryResultsOutput{
+		Status:     aws.String(exec.status),
+		Results:    exec.results,
+		Statistics: exec.statistics,
+	}, nil
+}
+
+func (x *cloudWatchLogsClient) StopQueryWithContext(ctx aws.Context, input *cloudwatchlogs.StopQueryInput, opts ...request.Option) (*cloudwatchlogs.StopQueryOutput, error) {
+	x.backend.mutex.Lock()
+	defer x.backend.mutex.Unlock()
+
+	exec, ok := x.backend.queries[aws.StringValue(input.QueryId)]
+	if !ok || exec.status != cloudwatchlogs.QueryStatusRunning {
+		return &cloudwatchlogs.StopQueryOutput{Success: aws.Bool(false)}, nil
+	}
+	exec.status = cloudwatchlogs.QueryStatusCancelled
+	return &cloudwatchlogs.StopQueryOutput{Success: aws.Bool(true)}, nil
+}
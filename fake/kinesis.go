@@ -0,0 +1,163 @@
+package fake
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/aws/aws-sdk-go/service/kinesis/kinesisiface"
+)
+
+const fakeShardID = "shardId-000000000000"
+
+type stream struct {
+	name    string
+	records []*kinesis.Record
+}
+
+// AddStream registers a Kinesis stream that has one shard as logicalID of
+// the stack. It returns physical name of the stream.
+func (x *Backend) AddStream(logicalID string) string {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	name := x.physicalName(logicalID)
+	x.streams[name] = &stream{name: name}
+	x.addResource(logicalID, name, "AWS::Kinesis::Stream")
+	return name
+}
+
+// StreamRecords returns data of all records in the stream.
+func (x *Backend) StreamRecords(streamName string) [][]byte {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	var data [][]byte
+	if s, ok := x.streams[streamName]; ok {
+		for _, r := range s.records {
+			data = append(data, r.Data)
+		}
+	}
+	return data
+}
+
+func (x *Backend) lookupStream(name string) (*stream, error) {
+	s, ok := x.streams[name]
+	if !ok {
+		return nil, awserr.New(kinesis.ErrCodeResourceNotFoundException,
+			"Stream "+name+" not found", nil)
+	}
+	return s, nil
+}
+
+type kinesisClient struct {
+	kinesisiface.KinesisAPI
+	backend *Backend
+}
+
+func (x *kinesisClient) ListShardsWithContext(ctx aws.Context, input *kinesis.ListShardsInput, opts ...request.Option) (*kinesis.ListShardsOutput, error) {
+	x.backend.mutex.Lock()
+	defer x.backend.mutex.Unlock()
+
+	if _, err := x.backend.lookupStream(aws.StringValue(input.StreamName)); err != nil {
+		return nil, err
+	}
+
+	return &kinesis.ListShardsOutput{
+		Shards: []*kinesis.Shard{{ShardId: aws.String(fakeShardID)}},
+	}, nil
+}
+
+func (x *kinesisClient) PutRecordWithContext(ctx aws.Context, input *kinesis.PutRecordInput, opts ...request.Option) (*kinesis.PutRecordOutput, error) {
+	x.backend.mutex.Lock()
+	defer x.backend.mutex.Unlock()
+
+	s, err := x.backend.lookupStream(aws.StringValue(input.StreamName))
+	if err != nil {
+		return nil, err
+	}
+
+	seq := fmt.Sprintf("%056d", len(s.records))
+	s.records = append(s.records, &kinesis.Record{
+		ApproximateArrivalTimestamp: aws.Time(time.Now().UTC()),
+		Data:                        input.Data,
+		PartitionKey:                input.PartitionKey,
+		SequenceNumber:              aws.String(seq),
+	})
+
+	return &kinesis.PutRecordOutput{
+		ShardId:        aws.String(fakeShardID),
+		SequenceNumber: aws.String(seq),
+	}, nil
+}
+
+// Shard iterator of fake backend is "<stream name>/<index of next record>".
+func toShardIterator(streamName string, idx int) *string {
+	return aws.String(fmt.Sprintf("%s/%d", streamName, idx))
+}
+
+func (x *kinesisClient) GetShardIteratorWithContext(ctx aws.Context, input *kinesis.GetShardIteratorInput, opts ...request.Option) (*kinesis.GetShardIteratorOutput, error) {
+	x.backend.mutex.Lock()
+	defer x.backend.mutex.Unlock()
+
+	s, err := x.backend.lookupStream(aws.StringValue(input.StreamName))
+	if err != nil {
+		return nil, err
+	}
+
+	idx := 0
+	switch aws.StringValue(input.ShardIteratorType) {
+	case kinesis.ShardIteratorTypeTrimHorizon:
+		idx = 0
+	case kinesis.ShardIteratorTypeLatest:
+		idx = len(s.records)
+	case kinesis.ShardIteratorTypeAtTimestamp:
+		ts := aws.TimeValue(input.Timestamp)
+		for idx = 0; idx < len(s.records); idx++ {
+			if !s.records[idx].ApproximateArrivalTimestamp.Before(ts) {
+				break
+			}
+		}
+	default:
+		return nil, awserr.New(kinesis.ErrCodeInvalidArgumentException,
+			"Unsupported ShardIteratorType: "+aws.StringValue(input.ShardIteratorType), nil)
+	}
+
+	return &kinesis.GetShardIteratorOutput{ShardIterator: toShardIterator(s.name, idx)}, nil
+}
+
+func (x *kinesisClient) GetRecordsWithContext(ctx aws.Context, input *kinesis.GetRecordsInput, opts ...request.Option) (*kinesis.GetRecordsOutput, error) {
+	iter := aws.StringValue(input.ShardIterator)
+	pos := strings.LastIndex(iter, "/")
+	if pos < 0 {
+		return nil, awserr.New(kinesis.ErrCodeInvalidArgumentException, "Invalid ShardIterator", nil)
+	}
+	idx, err := strconv.Atoi(iter[pos+1:])
+	if err != nil {
+		return nil, awserr.New(kinesis.ErrCodeInvalidArgumentException, "Invalid ShardIterator", err)
+	}
+
+	x.backend.mutex.Lock()
+	defer x.backend.mutex.Unlock()
+
+	s, err := x.backend.lookupStream(iter[:pos])
+	if err != nil {
+		return nil, err
+	}
+
+	records := []*kinesis.Record{}
+	if idx < len(s.records) {
+		records = append(records, s.records[idx:]...)
+	}
+
+	return &kinesis.GetRecordsOutput{
+		Records:            records,
+		NextShardIterator:  toShardIterator(s.name, idx+len(records)),
+		MillisBehindLatest: aws.Int64(0),
+	}, nil
+}
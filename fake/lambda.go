@@ -0,0 +1,256 @@
+package fake
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/lambda/lambdaiface"
+	"github.com/google/uuid"
+)
+
+// LambdaHandler is a Go function that works as AWS Lambda function. payload
+// is the event of invocation and returned bytes are response payload. If
+// an error is returned, the invocation fails with FunctionError.
+type LambdaHandler func(ctx context.Context, payload []byte) ([]byte, error)
+
+type function struct {
+	name    string
+	arn     string
+	handler LambdaHandler
+}
+
+type invocation struct {
+	requestID     string
+	version       string
+	clientContext map[string]interface{}
+	logGroup      string
+	logStream     string
+	backend       *Backend
+
+	mutex sync.Mutex
+	logs  []string
+}
+
+// log writes message to CloudWatch Logs and keeps it for tail log of
+// the invocation.
+func (x *invocation) log(message string) {
+	x.backend.PutLog(x.logGroup, x.logStream, message)
+
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.logs = append(x.logs, message)
+}
+
+// tail returns base64 encoded last 4KB of logs like LogResult of Invoke.
+func (x *invocation) tail() string {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	var buf strings.Builder
+	for _, msg := range x.logs {
+		buf.WriteString(msg)
+		if !strings.HasSuffix(msg, "\n") {
+			buf.WriteString("\n")
+		}
+	}
+	logs := buf.String()
+	if len(logs) > maxTailLogSize {
+		logs = logs[len(logs)-maxTailLogSize:]
+	}
+	return base64.StdEncoding.EncodeToString([]byte(logs))
+}
+
+// maxTailLogSize is max size of LogResult of Invoke.
+const maxTailLogSize = 4096
+
+type invocationKey struct{}
+
+// AddFunction registers a Lambda function backed by handler as logicalID
+// of the stack. It returns physical name of the function.
+func (x *Backend) AddFunction(logicalID string, handler LambdaHandler) string {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	name := x.physicalName(logicalID)
+	x.functions[name] = &function{
+		name:    name,
+		arn:     x.arn("lambda", "function:"+name),
+		handler: handler,
+	}
+	x.addResource(logicalID, name, "AWS::Lambda::Function")
+	return name
+}
+
+// Logf writes a log message to CloudWatch Logs of the function invoked
+// with ctx. It does nothing if ctx is not from invocation of fake backend.
+func Logf(ctx context.Context, format string, args ...interface{}) {
+	inv, ok := ctx.Value(invocationKey{}).(*invocation)
+	if !ok {
+		return
+	}
+	inv.log(fmt.Sprintf(format, args...))
+}
+
+// RequestID returns request ID of the invocation with ctx.
+func RequestID(ctx context.Context) string {
+	if inv, ok := ctx.Value(invocationKey{}).(*invocation); ok {
+		return inv.requestID
+	}
+	return ""
+}
+
+// ClientContext returns decoded client context of the invocation with ctx.
+// It returns nil if client context is not given.
+func ClientContext(ctx context.Context) map[string]interface{} {
+	if inv, ok := ctx.Value(invocationKey{}).(*invocation); ok {
+		return inv.clientContext
+	}
+	return nil
+}
+
+// functionName extracts function name from name, partial ARN or full ARN.
+func functionName(name string) string {
+	sec := strings.Split(name, ":")
+	for i, s := range sec {
+		if s == "function" && i+1 < len(sec) {
+			return sec[i+1]
+		}
+	}
+	return sec[len(sec)-1]
+}
+
+func (x *Backend) lookupFunction(name string) *function {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	return x.functions[functionName(name)]
+}
+
+func (x *Backend) newInvocation(name string) (*function, *invocation, error) {
+	fn := x.lookupFunction(name)
+	if fn == nil {
+		return nil, nil, awserr.New(lambda.ErrCodeResourceNotFoundException,
+			"Function not found: "+name, nil)
+	}
+
+	inv := &invocation{
+		requestID: uuid.New().String(),
+		version:   "$LATEST",
+		logGroup:  "/aws/lambda/" + fn.name,
+		logStream: time.Now().UTC().Format("2006/01/02") + "/[$LATEST]" +
+			strings.Replace(uuid.New().String(), "-", "", -1),
+		backend: x,
+	}
+	return fn, inv, nil
+}
+
+// invoke calls function synchronously.
+func (x *Backend) invoke(ctx context.Context, name string, payload []byte) (*lambda.InvokeOutput, *invocation, error) {
+	fn, inv, err := x.newInvocation(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return x.run(ctx, fn, inv, payload), inv, nil
+}
+
+func (x *Backend) run(ctx context.Context, fn *function, inv *invocation, payload []byte) *lambda.InvokeOutput {
+	// Lambda runtime writes START, END and REPORT lines for each invocation.
+	start := time.Now()
+	inv.log(fmt.Sprintf("START RequestId: %s Version: %s", inv.requestID, inv.version))
+	resp, err := fn.handler(context.WithValue(ctx, invocationKey{}, inv), payload)
+	var errResp []byte
+	if err != nil {
+		errResp, _ = json.Marshal(map[string]string{
+			"errorMessage": err.Error(),
+			"errorType":    "Error",
+		})
+		inv.log(string(errResp))
+	}
+	duration := float64(time.Since(start).Microseconds()) / 1000
+	inv.log(fmt.Sprintf("END RequestId: %s", inv.requestID))
+	inv.log(fmt.Sprintf(
+		"REPORT RequestId: %s\tDuration: %.2f ms\tBilled Duration: %d ms\tMemory Size: 128 MB\tMax Memory Used: 32 MB\t",
+		inv.requestID, duration, int(duration)+1))
+	output := &lambda.InvokeOutput{
+		ExecutedVersion: aws.String(inv.version),
+		StatusCode:      aws.Int64(200),
+		Payload:         resp,
+	}
+
+	if err != nil {
+		output.FunctionError = aws.String("Unhandled")
+		output.Payload = errResp
+	}
+
+	return output
+}
+
+type lambdaClient struct {
+	lambdaiface.LambdaAPI
+	backend *Backend
+}
+
+func (x *lambdaClient) Invoke(input *lambda.InvokeInput) (*lambda.InvokeOutput, error) {
+	return x.InvokeWithContext(aws.BackgroundContext(), input)
+}
+
+// InvokeWithContext supports invocation types of RequestResponse, Event
+// (the function is run in another goroutine) and DryRun. Qualifier is
+// accepted as any version or alias and returned as ExecutedVersion.
+// Request ID can be retrieved by request.WithGetResponseHeader option with
+// X-Amzn-Requestid.
+func (x *lambdaClient) InvokeWithContext(ctx aws.Context, input *lambda.InvokeInput, opts ...request.Option) (*lambda.InvokeOutput, error) {
+	fn, inv, err := x.backend.newInvocation(aws.StringValue(input.FunctionName))
+	if err != nil {
+		return nil, err
+	}
+	if input.Qualifier != nil {
+		inv.version = *input.Qualifier
+	}
+	if input.ClientContext != nil {
+		raw, err := base64.StdEncoding.DecodeString(*input.ClientContext)
+		if err == nil {
+			err = json.Unmarshal(raw, &inv.clientContext)
+		}
+		if err != nil {
+			return nil, awserr.New(lambda.ErrCodeInvalidRequestContentException,
+				"Invalid client context: "+err.Error(), nil)
+		}
+	}
+
+	var output *lambda.InvokeOutput
+	switch aws.StringValue(input.InvocationType) {
+	case lambda.InvocationTypeDryRun:
+		output = &lambda.InvokeOutput{StatusCode: aws.Int64(204)}
+
+	case lambda.InvocationTypeEvent:
+		go x.backend.run(context.Background(), fn, inv, input.Payload)
+		output = &lambda.InvokeOutput{StatusCode: aws.Int64(202)}
+
+	default:
+		output = x.backend.run(ctx, fn, inv, input.Payload)
+		if aws.StringValue(input.LogType) == lambda.LogTypeTail {
+			output.LogResult = aws.String(inv.tail())
+		}
+	}
+
+	// Run Complete handlers of options such as WithGetResponseHeader.
+	req := &request.Request{
+		HTTPResponse: &http.Response{Header: http.Header{}},
+		RequestID:    inv.requestID,
+	}
+	req.HTTPResponse.Header.Set("X-Amzn-Requestid", inv.requestID)
+	req.ApplyOptions(opts...)
+	req.Handlers.Complete.Run(req)
+
+	return output, nil
+}
@@ -0,0 +1,120 @@
+package fake
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+type bucket struct {
+	name    string
+	objects map[string][]byte
+}
+
+// AddBucket registers a S3 bucket as logicalID of the stack. It returns
+// physical name of the bucket.
+func (x *Backend) AddBucket(logicalID string) string {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	name := strings.ToLower(x.physicalName(logicalID))
+	x.buckets[name] = &bucket{name: name, objects: map[string][]byte{}}
+	x.addResource(logicalID, name, "AWS::S3::Bucket")
+	return name
+}
+
+// PutObject stores data as key in the bucket. It does nothing if the bucket
+// does not exist.
+func (x *Backend) PutObject(bucketName, key string, data []byte) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	if b, ok := x.buckets[bucketName]; ok {
+		b.objects[key] = data
+	}
+}
+
+// ObjectKeys returns sorted keys of objects in the bucket.
+func (x *Backend) ObjectKeys(bucketName string) []string {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	var keys []string
+	if b, ok := x.buckets[bucketName]; ok {
+		for key := range b.objects {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (x *Backend) lookupBucket(name string) (*bucket, error) {
+	b, ok := x.buckets[name]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchBucket, "The specified bucket does not exist", nil)
+	}
+	return b, nil
+}
+
+type s3Client struct {
+	s3iface.S3API
+	backend *Backend
+}
+
+// ListObjectsV2WithContext returns all objects at once and never truncates.
+func (x *s3Client) ListObjectsV2WithContext(ctx aws.Context, input *s3.ListObjectsV2Input, opts ...request.Option) (*s3.ListObjectsV2Output, error) {
+	x.backend.mutex.Lock()
+	defer x.backend.mutex.Unlock()
+
+	b, err := x.backend.lookupBucket(aws.StringValue(input.Bucket))
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for key := range b.objects {
+		if strings.HasPrefix(key, aws.StringValue(input.Prefix)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	output := &s3.ListObjectsV2Output{
+		Name:        input.Bucket,
+		Prefix:      input.Prefix,
+		IsTruncated: aws.Bool(false),
+		KeyCount:    aws.Int64(int64(len(keys))),
+	}
+	for _, key := range keys {
+		output.Contents = append(output.Contents, &s3.Object{
+			Key:          aws.String(key),
+			Size:         aws.Int64(int64(len(b.objects[key]))),
+			LastModified: aws.Time(time.Now().UTC()),
+		})
+	}
+	return output, nil
+}
+
+func (x *s3Client) DeleteObjectsWithContext(ctx aws.Context, input *s3.DeleteObjectsInput, opts ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	x.backend.mutex.Lock()
+	defer x.backend.mutex.Unlock()
+
+	b, err := x.backend.lookupBucket(aws.StringValue(input.Bucket))
+	if err != nil {
+		return nil, err
+	}
+
+	output := &s3.DeleteObjectsOutput{}
+	for _, obj := range input.Delete.Objects {
+		delete(b.objects, aws.StringValue(obj.Key))
+		output.Deleted = append(output.Deleted, &s3.DeletedObject{Key: obj.Key})
+	}
+	return output, nil
+}
@@ -0,0 +1,135 @@
+package fake
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// SnsHandler receives messages published to a topic.
+type SnsHandler func(ctx context.Context, entity events.SNSEntity) error
+
+type topic struct {
+	arn      string
+	handlers []SnsHandler
+}
+
+// AddTopic registers a SNS topic as logicalID of the stack. It returns ARN
+// of the topic.
+func (x *Backend) AddTopic(logicalID string) string {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	arn := x.arn("sns", x.physicalName(logicalID))
+	x.topics[arn] = &topic{arn: arn}
+	x.addResource(logicalID, arn, "AWS::SNS::Topic")
+	return arn
+}
+
+// Subscribe adds handler to the topic. Published messages are delivered to
+// all handlers synchronously. As with actual SNS, an error of handler does
+// not fail Publish and it can be retrieved by DeliveryErrors.
+func (x *Backend) Subscribe(topicArn string, handler SnsHandler) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	if t, ok := x.topics[topicArn]; ok {
+		t.handlers = append(t.handlers, handler)
+	}
+}
+
+// SubscribeFunction subscribes the Lambda function to the topic. The function
+// is invoked with SNS event when a message is published.
+func (x *Backend) SubscribeFunction(topicArn, functionName string) {
+	x.Subscribe(topicArn, func(ctx context.Context, entity events.SNSEntity) error {
+		event := events.SNSEvent{
+			Records: []events.SNSEventRecord{
+				{EventSource: "aws:sns", EventVersion: "1.0", SNS: entity},
+			},
+		}
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+
+		resp, _, err := x.invoke(ctx, functionName, payload)
+		if err != nil {
+			return err
+		}
+		if resp.FunctionError != nil {
+			return errors.Errorf("Function error of %s: %s", functionName, string(resp.Payload))
+		}
+		return nil
+	})
+}
+
+// DeliveryErrors returns errors of SNS subscribers.
+func (x *Backend) DeliveryErrors() []error {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+
+	errs := make([]error, len(x.deliveryErrors))
+	copy(errs, x.deliveryErrors)
+	return errs
+}
+
+type snsClient struct {
+	snsiface.SNSAPI
+	backend *Backend
+}
+
+func (x *snsClient) Publish(input *sns.PublishInput) (*sns.PublishOutput, error) {
+	return x.PublishWithContext(aws.BackgroundContext(), input)
+}
+
+func (x *snsClient) PublishWithContext(ctx aws.Context, input *sns.PublishInput, opts ...request.Option) (*sns.PublishOutput, error) {
+	topicArn := aws.StringValue(input.TopicArn)
+
+	x.backend.mutex.Lock()
+	t, ok := x.backend.topics[topicArn]
+	var handlers []SnsHandler
+	if ok {
+		handlers = append(handlers, t.handlers...)
+	}
+	x.backend.mutex.Unlock()
+
+	if !ok {
+		return nil, awserr.New(sns.ErrCodeNotFoundException, "Topic does not exist: "+topicArn, nil)
+	}
+
+	entity := events.SNSEntity{
+		MessageID:         uuid.New().String(),
+		Type:              "Notification",
+		TopicArn:          topicArn,
+		Subject:           aws.StringValue(input.Subject),
+		Message:           aws.StringValue(input.Message),
+		Timestamp:         time.Now().UTC(),
+		MessageAttributes: map[string]interface{}{},
+	}
+	for key, attr := range input.MessageAttributes {
+		entity.MessageAttributes[key] = map[string]interface{}{
+			"Type":  aws.StringValue(attr.DataType),
+			"Value": aws.StringValue(attr.StringValue),
+		}
+	}
+
+	for _, handler := range handlers {
+		if err := handler(ctx, entity); err != nil {
+			x.backend.mutex.Lock()
+			x.backend.deliveryErrors = append(x.backend.deliveryErrors,
+				errors.Wrapf(err, "Fail to deliver SNS message to subscriber of %s", topicArn))
+			x.backend.mutex.Unlock()
+		}
+	}
+
+	return &sns.PublishOutput{MessageId: aws.String(entity.MessageID)}, nil
+}
@@ -0,0 +1,179 @@
+package generalprobe_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/uuid"
+	"github.com/guregu/dynamo"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gp "github.com/m-mizutani/generalprobe"
+	"github.com/m-mizutani/generalprobe/fake"
+)
+
+const (
+	fakeRegion    = "ap-northeast-1"
+	fakeAccount   = "123456789012"
+	fakeStackName = "generalprobe-test"
+)
+
+// newFakeStack creates fake backend that emulates test-stack/template.yml.
+// options are applied in addition to options for the fake backend.
+func newFakeStack(t *testing.T, options ...gp.Option) (*fake.Backend, *gp.Generalprobe) {
+	backend := fake.New(fakeRegion, fakeAccount, fakeStackName)
+
+	tableName := backend.AddTable("ResultStore", "result_id", "")
+	backend.AddStream("ResultStream")
+	backend.AddBucket("ResultBucket")
+	topicArn := backend.AddTopic("Trigger")
+	funcName := backend.AddFunction("TestHandler", func(ctx context.Context, payload []byte) ([]byte, error) {
+		var event events.SNSEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, err
+		}
+
+		for _, record := range event.Records {
+			var msg struct {
+				ID string `json:"id"`
+			}
+			if err := json.Unmarshal([]byte(record.SNS.Message), &msg); err != nil {
+				return nil, err
+			}
+			fake.Logf(ctx, "[INFO] %s", record.SNS.Message)
+
+			item := map[string]interface{}{"result_id": msg.ID, "report": record.SNS.Message}
+			if err := backend.PutItem(tableName, item); err != nil {
+				return nil, err
+			}
+		}
+
+		return []byte(`{"message":"ok"}`), nil
+	})
+	backend.SubscribeFunction(topicArn, funcName)
+
+	options = append([]gp.Option{gp.WithClients(backend.Clients()),
+		gp.WithWaitPolicy(gp.WaitPolicy{Interval: 100 * time.Millisecond, MaxAttempts: 20})}, options...)
+	probe, err := gp.New(fakeRegion, fakeStackName, options...)
+	require.NoError(t, err)
+	return backend, probe
+}
+
+func TestFakeSnsToDynamo(t *testing.T) {
+	backend, probe := newFakeStack(t)
+	id := uuid.New().String()
+
+	var item map[string]interface{}
+	playbook := []gp.Scene{
+		gp.PublishSnsMessage(gp.LogicalID("Trigger"), []byte(`{"id":"`+id+`"}`)),
+		gp.GetDynamoRecord(gp.LogicalID("ResultStore"), func(table dynamo.Table) bool {
+			err := table.Get("result_id", id).One(&item)
+			return err == nil
+		}),
+		gp.GetLambdaLogs(gp.LogicalID("TestHandler"), func(log gp.CloudWatchLog) bool {
+			return log.Contains(id)
+		}).Filter(id),
+	}
+
+	require.NoError(t, probe.Play(playbook))
+	assert.Equal(t, id, item["result_id"])
+	assert.Equal(t, 0, len(backend.DeliveryErrors()))
+}
+
+func TestFakeInvokeLambda(t *testing.T) {
+	_, probe := newFakeStack(t)
+	id := uuid.New().String()
+
+	var response struct {
+		Message string `json:"message"`
+	}
+	playbook := []gp.Scene{
+		gp.InvokeLambda(gp.LogicalID("TestHandler"), func(ret []byte) {
+			require.NoError(t, json.Unmarshal(ret, &response))
+		}).SnsEvent(map[string]string{"id": id}),
+		gp.GetDynamoRecord(gp.LogicalID("ResultStore"), func(table dynamo.Table) bool {
+			var resp []map[string]interface{}
+			require.NoError(t, table.Get("result_id", id).All(&resp))
+			return len(resp) > 0
+		}),
+	}
+
+	require.NoError(t, probe.Play(playbook))
+	assert.Equal(t, "ok", response.Message)
+}
+
+func TestFakeKinesisStream(t *testing.T) {
+	_, probe := newFakeStack(t)
+	id := uuid.New().String()
+
+	var received string
+	playbook := []gp.Scene{
+		gp.PutKinesisStreamRecord(gp.LogicalID("ResultStream"), []byte(id)),
+		gp.GetKinesisStreamRecord(gp.LogicalID("ResultStream"), func(data []byte) bool {
+			received = string(data)
+			return true
+		}),
+	}
+
+	require.NoError(t, probe.Play(playbook))
+	assert.Equal(t, id, received)
+}
+
+func TestFakeErrors(t *testing.T) {
+	t.Run("polling timeout", func(t *testing.T) {
+		_, probe := newFakeStack(t)
+		err := probe.Play([]gp.Scene{
+			gp.GetDynamoRecord(gp.LogicalID("ResultStore"), func(table dynamo.Table) bool {
+				return false
+			}).Wait(gp.WaitPolicy{Interval: time.Millisecond, MaxAttempts: 2}),
+		})
+
+		var timeoutErr *gp.PollingTimeoutError
+		require.True(t, errors.As(err, &timeoutErr))
+		assert.True(t, errors.Is(err, gp.ErrPollingTimeout))
+		assert.Equal(t, 2, timeoutErr.Attempts)
+	})
+
+	t.Run("DynamoDB error is not retried", func(t *testing.T) {
+		_, probe := newFakeStack(t)
+		arn := "arn:aws:dynamodb:" + fakeRegion + ":" + fakeAccount + ":table/no-such-table"
+		err := probe.Play([]gp.Scene{
+			gp.GetDynamoRecord(gp.Arn(arn), nil).Key("result_id", "r1").
+				Wait(gp.WaitPolicy{Interval: time.Millisecond, MaxAttempts: 5}),
+		})
+
+		require.Error(t, err)
+		assert.False(t, errors.Is(err, gp.ErrPollingTimeout))
+		assert.Contains(t, err.Error(), "ResourceNotFoundException")
+		assert.Equal(t, 1, probe.LastReport().Scenes[0].Attempts)
+	})
+
+	t.Run("polling timeout with last result", func(t *testing.T) {
+		backend, probe := newFakeStack(t)
+		tableName := probe.LookupID("ResultStore")
+		require.NoError(t, backend.PutItem(tableName, map[string]interface{}{
+			"result_id": "r1", "status": "running",
+		}))
+
+		playbook, err := gp.LoadPlaybook(writePlaybook(t, `
+scenes:
+  - type: get_dynamo_record
+    target: { logical_id: ResultStore }
+    hash_key: { name: result_id, value: r1 }
+    wait: { interval: 10ms, multiplier: 2, timeout: 200ms }
+    expect:
+      json: { status: done }
+`))
+		require.NoError(t, err)
+
+		var timeoutErr *gp.PollingTimeoutError
+		require.True(t, errors.As(probe.Play(playbook), &timeoutErr))
+		assert.Contains(t, timeoutErr.LastResult, `"status":"running"`)
+		assert.True(t, timeoutErr.Waited < time.Second)
+	})
+}
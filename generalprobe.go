@@ -1,13 +1,19 @@
 package generalprobe
 
 import (
+	"context"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync"
+	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
 
 	"github.com/sirupsen/logrus"
 )
@@ -20,36 +26,64 @@ func init() {
 type Generalprobe struct {
 	awsRegion  string
 	awsSession *session.Session
+	awsConfig  *aws.Config
+	clients    Clients
 	awsAccount string
 	stackName  string
 	stackArn   string
 	scenes     []Scene
 	resources  []*cloudformation.StackResource
 	done       bool
+	timeout    time.Duration
+	vars       *Vars
+	runID      string
+	waitPolicy WaitPolicy
+	logger     *logrus.Logger
+	testTB     testing.TB
+	hooks      hooks
+
+	reporters   []Reporter
+	report      *Report
+	reportMutex sync.Mutex
+
+	diagnostics    bool
+	diagnosticsDir string
+	payloads       []*SentPayload
+	payloadMutex   sync.Mutex
 
 	StartTime time.Time
 }
 
-// New is constructor of Generalprobe structure.
-func New(awsRegion, stackName string) *Generalprobe {
+// New is constructor of Generalprobe structure. It returns error if
+// the CloudFormation stack can not be retrieved. AWS clients can be
+// configured by options such as WithAWSConfig and WithClients.
+func New(awsRegion, stackName string, options ...Option) (*Generalprobe, error) {
 	gp := Generalprobe{
-		awsRegion: awsRegion,
-		stackName: stackName,
-		done:      false,
-		StartTime: time.Now().UTC(),
+		awsRegion:  awsRegion,
+		awsConfig:  aws.NewConfig(),
+		stackName:  stackName,
+		done:       false,
+		vars:       newVars(),
+		runID:      uuid.New().String(),
+		waitPolicy: DefaultWaitPolicy(),
+		logger:     logger,
+		StartTime:  time.Now().UTC(),
 	}
 
-	gp.awsSession = session.Must(session.NewSession(&aws.Config{
-		Region: aws.String(awsRegion),
-	}))
-	client := cloudformation.New(gp.awsSession)
+	for _, opt := range options {
+		opt(&gp)
+	}
+
+	if err := gp.setupClients(); err != nil {
+		return nil, err
+	}
+	client := gp.clients.CloudFormation
 
 	resp, err := client.DescribeStackResources(&cloudformation.DescribeStackResourcesInput{
 		StackName: aws.String(stackName),
 	})
-	// pp.Println(resp)
 	if err != nil {
-		logger.Fatal("Fail to get CloudFormation Stack resources: ", err)
+		return nil, errors.Wrapf(err, "Fail to get CloudFormation Stack resources of %s", stackName)
 	}
 
 	gp.resources = resp.StackResources
@@ -57,9 +91,8 @@ func New(awsRegion, stackName string) *Generalprobe {
 	stackResp, err := client.DescribeStacks(&cloudformation.DescribeStacksInput{
 		StackName: aws.String(stackName),
 	})
-
 	if err != nil {
-		logger.Fatal("Fail to get detail of CloudFormation Stack instance", err, stackName)
+		return nil, errors.Wrapf(err, "Fail to get detail of CloudFormation Stack %s", stackName)
 	}
 
 	for _, stack := range stackResp.Stacks {
@@ -70,7 +103,11 @@ func New(awsRegion, stackName string) *Generalprobe {
 		}
 	}
 
-	return &gp
+	if gp.stackArn == "" {
+		return nil, errors.Wrapf(ErrResourceNotFound, "CloudFormation Stack %s", stackName)
+	}
+
+	return &gp, nil
 }
 
 // LookupID looks up PhysicalID from resource list of the CFn stack.
@@ -101,22 +138,175 @@ func toMilliSec(t time.Time) *int64 {
 	return &u
 }
 
-// Play executes defined scenes sequentially.
-func (x *Generalprobe) Play(playbook []Scene) error {
-	for idx, scene := range playbook {
-		scene.setGeneralprobe(x)
-		logger.Infof("Step (%d/%d): %s (%s)\n", idx+1, len(playbook), scene.string(), reflect.TypeOf(scene))
+// RunID returns unique ID of the Generalprobe. It can be referred as
+// {{ runID }} in templates to correlate data of the run.
+func (x *Generalprobe) RunID() string {
+	return x.runID
+}
+
+// Vars returns variable store shared by scenes.
+func (x *Generalprobe) Vars() *Vars {
+	return x.vars
+}
+
+// SetTimeout sets deadline of whole playbook. Play and PlayContext stop
+// the running scene and return error when the duration is exceeded.
+// Zero (default) means no deadline.
+func (x *Generalprobe) SetTimeout(timeout time.Duration) {
+	x.timeout = timeout
+}
+
+// Play executes defined scenes sequentially. Report of the run is passed
+// to reporters in addition to reporters set by WithReporter.
+func (x *Generalprobe) Play(playbook []Scene, reporters ...Reporter) error {
+	return x.PlayContext(context.Background(), playbook, reporters...)
+}
+
+// PlayContext executes defined scenes sequentially with ctx. If ctx is
+// canceled or exceeds the deadline, the running scene is interrupted and
+// PlayContext returns error that indicates the interrupted scene.
+//
+// Scenes in Teardown are played after other scenes even if a scene fails,
+// ctx is canceled or a callback calls t.FailNow or panics. Errors of teardown scenes are returned together with
+// the primary failure as *TeardownError. If diagnostics are enabled by
+// WithDiagnostics, the error is wrapped by *DiagnosticsError.
+func (x *Generalprobe) PlayContext(ctx context.Context, playbook []Scene, reporters ...Reporter) error {
+	x.startReport()
+	err := x.diagnose(ctx, x.playContext(ctx, playbook))
+
+	if rerr := x.finishReport(err, reporters); rerr != nil {
+		if err != nil {
+			x.logger.WithError(rerr).Error("Fail to write report")
+			return err
+		}
+		return rerr
+	}
+	return err
+}
+
+func (x *Generalprobe) playContext(ctx context.Context, playbook []Scene) (err error) {
+	scenes, teardown := splitTeardown(playbook)
+
+	// Teardown is played in defer because a callback of the main scenes may
+	// exit the goroutine by t.FailNow (and require) or panic. The panic is
+	// raised again after teardown.
+	returned := false
+	defer func() {
+		var r interface{}
+		if !returned {
+			r = recover()
+		}
+		if teardownErrs := x.playTeardown(ctx, teardown); len(teardownErrs) > 0 {
+			err = &TeardownError{Err: err, TeardownErrors: teardownErrs}
+		}
+		if r != nil {
+			panic(r)
+		}
+	}()
+
+	if sceneErr := x.playMain(ctx, scenes); sceneErr != nil {
+		err = sceneErr
+	}
+	returned = true
+	return err
+}
+
+func (x *Generalprobe) playTeardown(ctx context.Context, teardown []Scene) []error {
+	// Teardown must not be interrupted by cancel of the main scenes.
+	tctx := detachedContext{parent: ctx}
+
+	var errs []error
+	for idx, scene := range teardown {
+		if err := x.playScene(tctx, idx, len(teardown), scene, true); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func (x *Generalprobe) playMain(ctx context.Context, scenes []Scene) *SceneError {
+	if x.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, x.timeout)
+		defer cancel()
+	}
 
-		if err := scene.play(); err != nil {
-			logger.WithFields(logrus.Fields{
-				"sceneType": reflect.TypeOf(scene),
-				"sceneNo":   idx,
-				"scene":     scene,
-				"error":     err,
-			}).Error("Failed Generalprobe")
+	for idx, scene := range scenes {
+		if err := x.playScene(ctx, idx, len(scenes), scene, false); err != nil {
+			for skip := idx + 1; skip < len(scenes); skip++ {
+				x.addSceneReport(step{path: strconv.Itoa(skip + 1), index: skip}, scenes[skip], ResultSkipped)
+			}
 			return err
 		}
 	}
 
 	return nil
 }
+
+func (x *Generalprobe) playScene(ctx context.Context, idx, total int, scene Scene, teardown bool) *SceneError {
+	scene.setGeneralprobe(x)
+
+	s := step{label: "Step", path: strconv.Itoa(idx + 1), index: idx, total: total, teardown: teardown}
+	if teardown {
+		s.label = "Teardown"
+	}
+	x.logger.Infof("%s (%s/%d): %s (%s)\n", s.label, s.path, total, scene.string(), reflect.TypeOf(scene))
+
+	ctx, finish := x.recordScene(ctx, s, scene)
+
+	sceneErr := &SceneError{
+		Step:     idx + 1,
+		Total:    total,
+		Scene:    scene.string(),
+		Teardown: teardown,
+	}
+
+	if err := ctx.Err(); err != nil {
+		finish(err)
+		sceneErr.Err, sceneErr.ctxErr = err, err
+		return sceneErr
+	}
+
+	if err := x.runScene(withStep(ctx, s), scene, finish); err != nil {
+		x.logger.WithFields(logrus.Fields{
+			"sceneType": reflect.TypeOf(scene),
+			"sceneNo":   idx,
+			"scene":     scene,
+			"teardown":  teardown,
+			"error":     err,
+		}).Error("Failed Generalprobe")
+
+		sceneErr.Err, sceneErr.ctxErr = err, ctx.Err()
+		return sceneErr
+	}
+
+	return nil
+}
+
+// runScene plays scene and finishes the report by the result. The scene may
+// not return when a callback calls t.FailNow (and require) of PlayT, that
+// exits the goroutine, or panics. The report is finished as failed in the
+// case and the panic is raised again.
+func (x *Generalprobe) runScene(ctx context.Context, scene Scene, finish func(err error)) error {
+	returned := false
+	failedBefore := x.testTB != nil && x.testTB.Failed()
+	defer func() {
+		if returned {
+			return
+		}
+		r := recover()
+		if r != nil {
+			finish(errors.Errorf("Scene panicked: %v", r))
+			panic(r)
+		}
+		finish(errors.New("Scene is stopped by testing.T"))
+	}()
+
+	err := scene.play(ctx)
+	returned = true
+	if err == nil && !failedBefore && x.testTB != nil && x.testTB.Failed() {
+		err = errors.New("Scene is failed by testing.T")
+	}
+	finish(err)
+	return err
+}
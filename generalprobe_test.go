@@ -1,15 +1,17 @@
 package generalprobe_test
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
-	"log"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/guregu/dynamo"
 	gp "github.com/m-mizutani/generalprobe"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -19,29 +21,29 @@ type testParameters struct {
 	Region    string `json:"Region"`
 }
 
-func loadTestParameters() testParameters {
+// loadTestParameters reads parameters of the test stack deployed by
+// test-stack/deploy.sh. The test is skipped if the stack is not deployed.
+func loadTestParameters(t *testing.T) testParameters {
 	paramFile := "test-stack/params.json"
 	fd, err := os.Open(paramFile)
-	if err != nil {
-		log.Fatalf("Can not open %s: %s", paramFile, err)
+	if os.IsNotExist(err) {
+		t.Skipf("%s is not found, deploy test stack to run integration test", paramFile)
 	}
+	require.NoError(t, err, "Can not open %s", paramFile)
+	defer fd.Close()
 
 	data, err := ioutil.ReadAll(fd)
-	if err != nil {
-		log.Fatalf("Fail to read data %s: %s", paramFile, err)
-	}
+	require.NoError(t, err, "Fail to read data %s", paramFile)
 
 	var p testParameters
 	err = json.Unmarshal(data, &p)
-	if err != nil {
-		log.Fatalf("Fail to unmarshal data %s: %s", paramFile, err)
-	}
+	require.NoError(t, err, "Fail to unmarshal data %s", paramFile)
 
 	return p
 }
 
 func TestBasicUsage(t *testing.T) {
-	params := loadTestParameters()
+	params := loadTestParameters(t)
 
 	n := 0
 	scenario := []gp.Scene{
@@ -54,13 +56,15 @@ func TestBasicUsage(t *testing.T) {
 		}),
 	}
 
-	err := gp.New(params.Region, params.StackName).Play(scenario)
+	probe, err := gp.New(params.Region, params.StackName)
+	require.NoError(t, err)
+	err = probe.Play(scenario)
 	require.NoError(t, err)
 	assert.Equal(t, 2, n)
 }
 
 func TestSnsToDynamo(t *testing.T) {
-	params := loadTestParameters()
+	params := loadTestParameters(t)
 	id := uuid.New().String()
 
 	done := false
@@ -90,13 +94,15 @@ func TestSnsToDynamo(t *testing.T) {
 		}).Filter(id),
 	}
 
-	err := gp.New(params.Region, params.StackName).Play(scenario)
+	probe, err := gp.New(params.Region, params.StackName)
+	require.NoError(t, err)
+	err = probe.Play(scenario)
 	require.NoError(t, err)
 	require.Equal(t, true, done)
 }
 
 func TestInvokeLambda(t *testing.T) {
-	params := loadTestParameters()
+	params := loadTestParameters(t)
 
 	id := uuid.New().String()
 	request := struct {
@@ -127,12 +133,14 @@ func TestInvokeLambda(t *testing.T) {
 		}),
 	}
 
-	err := gp.New(params.Region, params.StackName).Play(scenario)
+	probe, err := gp.New(params.Region, params.StackName)
+	require.NoError(t, err)
+	err = probe.Play(scenario)
 	require.NoError(t, err)
 }
 
 func TestKinesisStream(t *testing.T) {
-	params := loadTestParameters()
+	params := loadTestParameters(t)
 
 	id := uuid.New().String()
 	scenario := []gp.Scene{
@@ -144,6 +152,65 @@ func TestKinesisStream(t *testing.T) {
 		}),
 	}
 
-	err := gp.New(params.Region, params.StackName).Play(scenario)
+	probe, err := gp.New(params.Region, params.StackName)
+	require.NoError(t, err)
+	err = probe.Play(scenario)
 	require.NoError(t, err)
 }
+
+func TestPlayContextCancel(t *testing.T) {
+	t.Run("deadline interrupts running scene", func(t *testing.T) {
+		_, probe := newFakeStack(t)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		n := 0
+		start := time.Now()
+		err := probe.PlayContext(ctx, []gp.Scene{
+			gp.AdLib(func() { n++ }),
+			gp.Pause(10),
+			gp.AdLib(func() { n++ }),
+		})
+
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+		assert.True(t, time.Since(start) < 5*time.Second)
+		assert.Equal(t, 1, n)
+
+		var sceneErr *gp.SceneError
+		require.True(t, errors.As(err, &sceneErr))
+		assert.Equal(t, 2, sceneErr.Step)
+		assert.Contains(t, err.Error(), "Interrupted at step (2/3) Pausing 10 seconds")
+	})
+
+	t.Run("canceled context plays no scene", func(t *testing.T) {
+		_, probe := newFakeStack(t)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		n := 0
+		err := probe.PlayContext(ctx, []gp.Scene{gp.AdLib(func() { n++ })})
+		assert.True(t, errors.Is(err, context.Canceled))
+		assert.Equal(t, 0, n)
+	})
+
+	t.Run("SetTimeout", func(t *testing.T) {
+		_, probe := newFakeStack(t)
+		probe.SetTimeout(100 * time.Millisecond)
+
+		start := time.Now()
+		err := probe.Play([]gp.Scene{gp.Pause(10)})
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+		assert.True(t, time.Since(start) < 5*time.Second)
+	})
+
+	t.Run("scene failure is not interruption", func(t *testing.T) {
+		_, probe := newFakeStack(t)
+		err := probe.Play([]gp.Scene{gp.AdLibE(func() error { return errors.New("boom") })})
+		require.Error(t, err)
+		assert.False(t, errors.Is(err, context.Canceled))
+		assert.Contains(t, err.Error(), "Failed at step (1/1) AdLib: boom")
+	})
+}
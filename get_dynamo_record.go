@@ -1,11 +1,10 @@
 package generalprobe
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
-	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/guregu/dynamo"
 	"github.com/pkg/errors"
 )
@@ -14,44 +13,177 @@ import (
 type GetDynamoRecordScene struct {
 	target Target
 
-	callback GetDynamoRecordCallback
+	hashKey  *dynamoKey
+	rangeKey *dynamoKey
+	expectation
+
+	callback GetDynamoRecordCallbackE
 	pollingScene
 }
 
+// dynamoKey is a key attribute of DynamoDB table. A string value can be a
+// template that refers variables.
+type dynamoKey struct {
+	name  string
+	value interface{}
+}
+
 // GetDynamoRecordCallback is callback function called after retrieving target record
 type GetDynamoRecordCallback func(table dynamo.Table) bool
 
+// GetDynamoRecordCallbackE is callback function that can stop polling. It
+// returns true if the expected record is found, false to retry, or error to
+// fail the scene immediately.
+type GetDynamoRecordCallbackE func(table dynamo.Table) (bool, error)
+
 // GetDynamoRecord is a constructor of Scene
 func GetDynamoRecord(target Target, callback GetDynamoRecordCallback) *GetDynamoRecordScene {
+	var callbackE GetDynamoRecordCallbackE
+	if callback != nil {
+		callbackE = func(table dynamo.Table) (bool, error) { return callback(table), nil }
+	}
+	return GetDynamoRecordE(target, callbackE)
+}
+
+// GetDynamoRecordE is a constructor of Scene with callback that can return
+// error to stop polling, e.g. when the record has unexpected value.
+func GetDynamoRecordE(target Target, callback GetDynamoRecordCallbackE) *GetDynamoRecordScene {
 	scene := GetDynamoRecordScene{
 		target:   target,
 		callback: callback,
-		pollingScene: pollingScene{
-			limit:    20,
-			interval: 3,
-		},
 	}
 	return &scene
 }
 
+// Key sets hash key of the record to wait. It can be used instead of
+// callback. A string value can be a template that refers variables.
+func (x *GetDynamoRecordScene) Key(name string, value interface{}) *GetDynamoRecordScene {
+	x.hashKey = &dynamoKey{name: name, value: value}
+	return x
+}
+
+// Range sets range key of the record to wait in addition to Key.
+func (x *GetDynamoRecordScene) Range(name string, value interface{}) *GetDynamoRecordScene {
+	x.rangeKey = &dynamoKey{name: name, value: value}
+	return x
+}
+
+// Expect sets matchers to check the record that is got by Key (and Range).
+// The record is converted to JSON before matching. Polling continues until
+// the record satisfies them.
+func (x *GetDynamoRecordScene) Expect(matchers ...Matcher) *GetDynamoRecordScene {
+	x.expect(matchers)
+	return x
+}
+
+// MatchSnapshot expects that the record equals golden file of name. See
+// Snapshot for ignorePaths and update mode.
+func (x *GetDynamoRecordScene) MatchSnapshot(name string, ignorePaths ...string) *GetDynamoRecordScene {
+	return x.Expect(Snapshot(name, ignorePaths...))
+}
+
+// Limit sets maximum number of attempts. If the limit exceeded, Play
+// returns error of ErrPollingTimeout.
+func (x *GetDynamoRecordScene) Limit(limit int) *GetDynamoRecordScene {
+	x.setLimit(limit)
+	return x
+}
+
+// Interval sets seconds of wait time between attempts.
+func (x *GetDynamoRecordScene) Interval(seconds int) *GetDynamoRecordScene {
+	x.setInterval(seconds)
+	return x
+}
+
+// Wait sets WaitPolicy of the scene instead of default policy of Generalprobe.
+func (x *GetDynamoRecordScene) Wait(policy WaitPolicy) *GetDynamoRecordScene {
+	x.setWait(policy)
+	return x
+}
+
 // Strings return text explanation of the scene
 func (x *GetDynamoRecordScene) string() string {
-	return fmt.Sprintf("Read DynamoDB of %s", x.target.arn(x.gp))
+	return fmt.Sprintf("Read DynamoDB of %s", targetString(x.target, x.gp))
 }
 
-func (x *GetDynamoRecordScene) play() error {
-	db := dynamo.New(session.New(), &aws.Config{
-		Region: aws.String(x.region()),
-	})
-	table := db.Table(x.target.name(x.gp))
+func (x *GetDynamoRecordScene) sceneTarget() Target { return x.target }
+
+func (x *GetDynamoRecordScene) play(ctx context.Context) error {
+	db := dynamo.NewFromIface(x.clients().DynamoDB)
+	tableName, err := x.target.name(x.gp)
+	if err != nil {
+		return err
+	}
+	table := db.Table(tableName)
 
-	for n := 0; n < x.limit; n++ {
-		if x.callback(table) {
-			return nil
+	var attempt pollFunc
+	if x.callback != nil && x.expected() {
+		return errors.New("Expect can not be used with callback, use Key instead")
+	}
+	if x.callback != nil {
+		attempt = func(ctx context.Context) (bool, string, error) {
+			ok, err := x.callback(table)
+			if err != nil {
+				return false, "", errors.Wrap(err, "Rejected by callback")
+			}
+			return ok, "", nil
 		}
+	} else if attempt, err = x.keyAttempt(ctx, table); err != nil {
+		return err
+	}
+
+	if err := x.poll(ctx, attempt); err != nil {
+		return errors.Wrap(err, "Fail to fetch records from DynamoDB")
+	}
+	return nil
+}
+
+// keyAttempt creates an attempt of polling that gets an item by hashKey and
+// rangeKey and checks the item.
+func (x *GetDynamoRecordScene) keyAttempt(ctx context.Context, table dynamo.Table) (pollFunc, error) {
+	if x.hashKey == nil {
+		return nil, errors.New("Either of callback or hash key is required")
+	}
 
-		time.Sleep(time.Second * time.Duration(x.interval))
+	hashValue, err := x.gp.renderValue(ctx, x.hashKey.value)
+	if err != nil {
+		return nil, err
 	}
 
-	return errors.New("Timeout to fetch records from DynamoDB")
+	var rangeValue interface{}
+	if x.rangeKey != nil {
+		if rangeValue, err = x.gp.renderValue(ctx, x.rangeKey.value); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(ctx context.Context) (bool, string, error) {
+		query := table.Get(x.hashKey.name, hashValue)
+		if x.rangeKey != nil {
+			query = query.Range(x.rangeKey.name, dynamo.Equal, rangeValue)
+		}
+
+		var item map[string]interface{}
+		if err := query.OneWithContext(ctx, &item); err != nil {
+			if err == dynamo.ErrNotFound {
+				x.log().WithError(err).Debug("DynamoDB record is not available")
+				return false, err.Error(), nil
+			}
+			return false, "", errors.Wrapf(err, "Fail to get DynamoDB record of %v", hashValue)
+		}
+
+		raw, err := json.Marshal(item)
+		if err != nil {
+			x.log().WithError(err).Warn("Fail to marshal DynamoDB record")
+			return false, err.Error(), nil
+		}
+
+		if err := x.verify(ctx, raw); err != nil {
+			if !isMismatch(err) {
+				return false, "", err
+			}
+			return false, describeMismatch(raw, err), nil
+		}
+		return true, string(raw), nil
+	}, nil
 }
@@ -1,13 +1,12 @@
 package generalprobe
 
 import (
+	"context"
 	"fmt"
-	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/kinesis"
 )
 
@@ -15,42 +14,74 @@ import (
 type GetKinesisStreamRecordScene struct {
 	target Target
 	pollingScene
-	callback GetKinesisStreamRecordCallback
+	callback GetKinesisStreamRecordCallbackE
+	expectation
 }
 
 // GetKinesisStreamRecordCallback is callback function called after retrieving kinesis record
 type GetKinesisStreamRecordCallback func(data []byte) bool
 
+// GetKinesisStreamRecordCallbackE is callback function that can stop
+// polling. It returns true if the record is expected one, false to check
+// next record, or error to fail the scene immediately.
+type GetKinesisStreamRecordCallbackE func(data []byte) (bool, error)
+
 // GetKinesisStreamRecord is a constructor of Scene
 func GetKinesisStreamRecord(target Target, callback GetKinesisStreamRecordCallback) *GetKinesisStreamRecordScene {
+	var callbackE GetKinesisStreamRecordCallbackE
+	if callback != nil {
+		callbackE = func(data []byte) (bool, error) { return callback(data), nil }
+	}
+	return GetKinesisStreamRecordE(target, callbackE)
+}
+
+// GetKinesisStreamRecordE is a constructor of Scene with callback that can
+// return error to stop polling.
+func GetKinesisStreamRecordE(target Target, callback GetKinesisStreamRecordCallbackE) *GetKinesisStreamRecordScene {
 	scene := GetKinesisStreamRecordScene{
 		target:   target,
 		callback: callback,
-		pollingScene: pollingScene{
-			limit:    20,
-			interval: 3,
-		},
 	}
 	return &scene
 }
 
+// Limit sets maximum number of attempts. If the limit exceeded, Play
+// returns error of ErrPollingTimeout.
+func (x *GetKinesisStreamRecordScene) Limit(limit int) *GetKinesisStreamRecordScene {
+	x.setLimit(limit)
+	return x
+}
+
+// Interval sets seconds of wait time between attempts.
+func (x *GetKinesisStreamRecordScene) Interval(seconds int) *GetKinesisStreamRecordScene {
+	x.setInterval(seconds)
+	return x
+}
+
+// Wait sets WaitPolicy of the scene instead of default policy of Generalprobe.
+func (x *GetKinesisStreamRecordScene) Wait(policy WaitPolicy) *GetKinesisStreamRecordScene {
+	x.setWait(policy)
+	return x
+}
+
 func (x *GetKinesisStreamRecordScene) string() string {
-	return fmt.Sprintf("Get Kinesis Record from %s", x.target.arn(x.gp))
+	return fmt.Sprintf("Get Kinesis Record from %s", targetString(x.target, x.gp))
 }
 
-func (x *GetKinesisStreamRecordScene) play() error {
-	streamName := x.target.name(x.gp)
+func (x *GetKinesisStreamRecordScene) sceneTarget() Target { return x.target }
 
-	ssn := session.Must(session.NewSession(&aws.Config{
-		Region: aws.String(x.region()),
-	}))
+func (x *GetKinesisStreamRecordScene) play(ctx context.Context) error {
+	streamName, err := x.target.name(x.gp)
+	if err != nil {
+		return err
+	}
 
-	kinesisService := kinesis.New(ssn)
-	resp, err := kinesisService.ListShards(&kinesis.ListShardsInput{
+	kinesisService := x.clients().Kinesis
+	resp, err := kinesisService.ListShardsWithContext(ctx, &kinesis.ListShardsInput{
 		StreamName: aws.String(streamName),
 	})
 	if err != nil {
-		logger.Fatal("Fail to shard list", err)
+		return errors.Wrap(err, "Fail to shard list")
 	}
 
 	shardList := []string{}
@@ -59,42 +90,83 @@ func (x *GetKinesisStreamRecordScene) play() error {
 	}
 
 	if len(shardList) != 1 {
-		logger.Fatal("Invalid shard number: ", len(shardList), ", expected 1")
+		return fmt.Errorf("Invalid shard number: %d, expected 1", len(shardList))
 	}
 
-	now := time.Now()
+	// Read records since the probe started because the record may be put
+	// by the previous scene.
+	startTime := x.startTime()
 
-	iter, err := kinesisService.GetShardIterator(&kinesis.GetShardIteratorInput{
+	iter, err := kinesisService.GetShardIteratorWithContext(ctx, &kinesis.GetShardIteratorInput{
 		ShardId:           aws.String(shardList[0]),
 		ShardIteratorType: aws.String("AT_TIMESTAMP"),
 		StreamName:        aws.String(streamName),
-		Timestamp:         &now,
+		Timestamp:         &startTime,
 	})
 	if err != nil {
-		logger.Fatal("Fail to get iterator", err)
+		return errors.Wrap(err, "Fail to get iterator")
 	}
 
 	shardIter := iter.ShardIterator
-	for i := 0; i < x.limit; i++ {
-		records, err := kinesisService.GetRecords(&kinesis.GetRecordsInput{
+	err = x.poll(ctx, func(ctx context.Context) (bool, string, error) {
+		records, err := kinesisService.GetRecordsWithContext(ctx, &kinesis.GetRecordsInput{
 			ShardIterator: shardIter,
 		})
-
 		if err != nil {
-			logger.WithField("records", records).Fatal("Fail to get kinesis records")
+			return false, "", errors.Wrap(err, "Fail to get kinesis records")
 		}
 		shardIter = records.NextShardIterator
 
-		if len(records.Records) > 0 {
-			for _, record := range records.Records {
-				if x.callback(record.Data) {
-					return nil
-				}
+		last := ""
+		for _, record := range records.Records {
+			ok, result, err := x.match(ctx, record.Data)
+			if err != nil {
+				return false, result, err
 			}
+			if ok {
+				return true, "", nil
+			}
+			last = result
 		}
+		return false, last, nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "No expected kinesis record")
+	}
+	return nil
+}
+
+// Expect sets matchers to find the expected record. Records that do not
+// satisfy them are skipped without calling callback. callback can be nil
+// if matchers are set.
+func (x *GetKinesisStreamRecordScene) Expect(matchers ...Matcher) *GetKinesisStreamRecordScene {
+	x.expect(matchers)
+	return x
+}
 
-		time.Sleep(time.Second * time.Duration(x.interval))
+// MatchSnapshot expects a record that equals golden file of name. Records
+// that do not match are skipped. See Snapshot for ignorePaths and update
+// mode; in update mode, the first record is written.
+func (x *GetKinesisStreamRecordScene) MatchSnapshot(name string, ignorePaths ...string) *GetKinesisStreamRecordScene {
+	return x.Expect(Snapshot(name, ignorePaths...))
+}
+
+// match checks data by expectations and callback. It also returns text of
+// the result for PollingTimeoutError.
+func (x *GetKinesisStreamRecordScene) match(ctx context.Context, data []byte) (bool, string, error) {
+	if err := x.verify(ctx, data); err != nil {
+		if !isMismatch(err) {
+			return false, "", err
+		}
+		return false, describeMismatch(data, err), nil
+	}
+	if x.callback == nil {
+		return true, "", nil
 	}
 
-	return errors.New("No kinesis message")
+	ok, err := x.callback(data)
+	if err != nil {
+		return false, string(data), errors.Wrap(err, "Rejected by callback")
+	}
+	return ok, string(data), nil
 }
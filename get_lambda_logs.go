@@ -1,9 +1,9 @@
 package generalprobe
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"strings"
 	"time"
 
@@ -17,11 +17,22 @@ import (
 // GetLambdaLogsCallback is a callback type of GetLambdaLogs
 type GetLambdaLogsCallback func(logs CloudWatchLog) bool
 
+// GetLambdaLogsCallbackE is a callback type of GetLambdaLogsE. It returns
+// true if the log is expected one, false to check next log, or error to
+// fail the scene immediately.
+type GetLambdaLogsCallbackE func(logs CloudWatchLog) (bool, error)
+
+// GetLambdaLogEventsCallback is a callback type of GetLambdaLogEvents.
+// Returned values are same as GetLambdaLogsCallbackE.
+type GetLambdaLogEventsCallback func(ev *LambdaLogEvent) (bool, error)
+
 // GetLambdaLogsScene is a scene of waiting AWS Lambda logs
 type GetLambdaLogsScene struct {
-	target   Target
-	filter   string
-	callback GetLambdaLogsCallback
+	target        Target
+	filter        string
+	callback      GetLambdaLogsCallbackE
+	eventCallback GetLambdaLogEventsCallback
+	expectation
 	pollingScene
 }
 
@@ -29,11 +40,13 @@ type GetLambdaLogsScene struct {
 // The type provides utility methods for tests.
 type CloudWatchLog string
 
-// Bind marshal json to structure. If error, test will exit by log.Fatalf
-func (x CloudWatchLog) Bind(data interface{}) {
+// Bind marshal json to structure. It returns error if the log message is
+// not valid JSON.
+func (x CloudWatchLog) Bind(data interface{}) error {
 	if err := json.Unmarshal([]byte(x), data); err != nil {
-		log.Fatalf("Fail to unmarshal CloudWatchLog: %s", x)
+		return errors.Wrapf(err, "Fail to unmarshal CloudWatchLog: %s", x)
 	}
+	return nil
 }
 
 // Contains search string in the log message
@@ -43,20 +56,59 @@ func (x CloudWatchLog) Contains(key string) bool {
 
 // GetLambdaLogs creates a new scene to wait AWS Lambda output from CloudWatchLogs
 func GetLambdaLogs(target Target, callback GetLambdaLogsCallback) *GetLambdaLogsScene {
+	var callbackE GetLambdaLogsCallbackE
+	if callback != nil {
+		callbackE = func(log CloudWatchLog) (bool, error) { return callback(log), nil }
+	}
+	return GetLambdaLogsE(target, callbackE)
+}
+
+// GetLambdaLogsE creates a new scene to wait AWS Lambda output with callback
+// that can return error to stop polling.
+func GetLambdaLogsE(target Target, callback GetLambdaLogsCallbackE) *GetLambdaLogsScene {
 	scene := GetLambdaLogsScene{
 		target:   target,
 		callback: callback,
-		pollingScene: pollingScene{
-			limit:    20,
-			interval: 3,
-		},
 	}
 
 	return &scene
 }
 
+// GetLambdaLogEvents creates a new scene to wait AWS Lambda logs with
+// callback that receives parsed LambdaLogEvent.
+func GetLambdaLogEvents(target Target, callback GetLambdaLogEventsCallback) *GetLambdaLogsScene {
+	scene := GetLambdaLogsScene{
+		target:        target,
+		eventCallback: callback,
+	}
+
+	return &scene
+}
+
+// Limit sets maximum number of attempts. If the limit exceeded, Play
+// returns error of ErrPollingTimeout.
+func (x *GetLambdaLogsScene) Limit(limit int) *GetLambdaLogsScene {
+	x.setLimit(limit)
+	return x
+}
+
+// Interval sets seconds of wait time between attempts.
+func (x *GetLambdaLogsScene) Interval(seconds int) *GetLambdaLogsScene {
+	x.setInterval(seconds)
+	return x
+}
+
+// Wait sets WaitPolicy of the scene instead of default policy of Generalprobe.
+func (x *GetLambdaLogsScene) Wait(policy WaitPolicy) *GetLambdaLogsScene {
+	x.setWait(policy)
+	return x
+}
+
 // Filter sets filtering keyword to search CloudWatch Logs.
 // Default is empty. The filter keyword will be quote automatically when querying.
+// START, END and REPORT lines are still read to fill request ID of
+// LambdaLogEvent, but they are not passed to callback unless they contain
+// the filter.
 func (x *GetLambdaLogsScene) Filter(filter string) *GetLambdaLogsScene {
 	x.filter = filter
 	return x
@@ -64,65 +116,136 @@ func (x *GetLambdaLogsScene) Filter(filter string) *GetLambdaLogsScene {
 
 // Strings return text explanation of the scene
 func (x *GetLambdaLogsScene) string() string {
-	return fmt.Sprintf("Reading Lambda Logs of %s", x.target.arn(x.gp))
+	return fmt.Sprintf("Reading Lambda Logs of %s", targetString(x.target, x.gp))
 }
 
-func (x *GetLambdaLogsScene) play() error {
-	lambdaName := x.target.name(x.gp)
-	if lambdaName == "" {
-		logger.Fatal(fmt.Printf("No such lambda function: %s", x.target))
+func (x *GetLambdaLogsScene) sceneTarget() Target { return x.target }
+
+func (x *GetLambdaLogsScene) play(ctx context.Context) error {
+	lambdaName, err := x.target.name(x.gp)
+	if err != nil {
+		return errors.Wrap(err, "No such lambda function")
 	}
 
-	client := cloudwatchlogs.New(x.awsSession())
-	nextToken := ""
-	now := time.Now().UTC()
+	filter, err := x.render(ctx, x.filter)
+	if err != nil {
+		return err
+	}
 
-	for n := 0; n <= x.limit; n++ {
-		time.Sleep(time.Second * time.Duration(x.interval))
+	client := x.clients().CloudWatchLogs
+	tracker := lambdaLogTracker{}
+	checked := map[string]bool{}
 
+	err = x.poll(ctx, func(ctx context.Context) (bool, string, error) {
+		// EndTime is not set and all pages are read from the beginning in
+		// each attempt, so that logs written long after start of the scene
+		// can be found. Events checked by previous attempts are skipped.
 		input := cloudwatchlogs.FilterLogEventsInput{
 			LogGroupName: aws.String(fmt.Sprintf("/aws/lambda/%s", lambdaName)),
 			StartTime:    toMilliSec(x.startTime().Add(time.Minute * -1)),
-			EndTime:      toMilliSec(now.Add(time.Minute * 1)),
 		}
-		if x.filter != "" {
-			input.FilterPattern = aws.String(fmt.Sprintf("\"%s\"", x.filter))
-		}
-		if nextToken != "" {
-			input.NextToken = aws.String(nextToken)
+		if filter != "" {
+			// START, END and REPORT lines are also read to track request ID
+			// of logs, but they are passed to callback only if they match
+			// filter.
+			input.FilterPattern = aws.String(fmt.Sprintf(`?"%s" ?"START RequestId: " ?"END RequestId: " ?"REPORT RequestId: "`, filter))
 		}
 
-		logger.WithField("input", input).Debug("Call FilterLogEvents")
-		resp, err := client.FilterLogEvents(&input)
-		logger.WithFields(logrus.Fields{
-			"resp":  resp,
-			"input": input,
-			"start": *input.StartTime,
-		}).Trace("Filtered log events")
-
-		if nil != err {
-			if aerr, ok := err.(awserr.Error); ok {
-				switch aerr.Code() {
-				case cloudwatchlogs.ErrCodeResourceNotFoundException:
-					continue
+		last := ""
+		for {
+			x.log().WithField("input", input).Debug("Call FilterLogEvents")
+			resp, err := client.FilterLogEventsWithContext(ctx, &input)
+			x.log().WithFields(logrus.Fields{
+				"resp":  resp,
+				"input": input,
+				"start": *input.StartTime,
+			}).Trace("Filtered log events")
+
+			if nil != err {
+				if aerr, ok := err.(awserr.Error); ok {
+					switch aerr.Code() {
+					case cloudwatchlogs.ErrCodeResourceNotFoundException:
+						return false, aerr.Message(), nil
+					}
 				}
+
+				return false, "", errors.Wrap(err, "Can not access to ClodwatchLogs")
 			}
 
-			logger.Fatal("Can not access to ClodwatchLogs", err)
-		}
+			for _, event := range resp.Events {
+				if event.Message == nil {
+					continue
+				}
+				if id := aws.StringValue(event.EventId); id != "" {
+					if checked[id] {
+						continue
+					}
+					checked[id] = true
+				}
+
+				ev := ParseLambdaLog(*event.Message)
+				ev.LogStream = aws.StringValue(event.LogStreamName)
+				if event.Timestamp != nil {
+					ev.Timestamp = time.Unix(0, *event.Timestamp*int64(time.Millisecond)).UTC()
+				}
+				tracker.track(ev)
+				if filter != "" && !strings.Contains(ev.Raw, filter) {
+					continue
+				}
 
-		for _, event := range resp.Events {
-			if event.Message != nil {
-				if x.callback(CloudWatchLog(*event.Message)) {
-					return nil
+				ok, result, err := x.match(ctx, ev)
+				if err != nil {
+					return false, result, err
 				}
+				if ok {
+					return true, "", nil
+				}
+				last = result
+			}
+
+			if resp.NextToken == nil {
+				return false, last, nil
 			}
+			input.NextToken = resp.NextToken
 		}
+	})
+	if err != nil {
+		return errors.Wrap(err, "No expected logs from CloudWatch Logs")
+	}
+	return nil
+}
 
-		if resp.NextToken != nil {
-			nextToken = *resp.NextToken
+// Expect sets matchers to find the expected log message. Messages that do
+// not satisfy them are skipped without calling callback. callback can be
+// nil if matchers are set.
+func (x *GetLambdaLogsScene) Expect(matchers ...Matcher) *GetLambdaLogsScene {
+	x.expect(matchers)
+	return x
+}
+
+// match checks log message by expectations and callback. It also returns
+// text of the result for PollingTimeoutError.
+func (x *GetLambdaLogsScene) match(ctx context.Context, ev *LambdaLogEvent) (bool, string, error) {
+	msg := ev.Raw
+	if err := x.verify(ctx, []byte(msg)); err != nil {
+		if !isMismatch(err) {
+			return false, "", err
 		}
+		return false, describeMismatch([]byte(msg), err), nil
 	}
 
-	return errors.New("No expected logs from CloudWatch Logs")
+	var ok bool
+	var err error
+	switch {
+	case x.eventCallback != nil:
+		ok, err = x.eventCallback(ev)
+	case x.callback != nil:
+		ok, err = x.callback(CloudWatchLog(msg))
+	default:
+		return true, "", nil
+	}
+	if err != nil {
+		return false, msg, errors.Wrap(err, "Rejected by callback")
+	}
+	return ok, msg, nil
 }
@@ -1,15 +1,30 @@
 module github.com/m-mizutani/generalprobe
 
+go 1.18
+
 require (
-	github.com/aws/aws-lambda-go v1.6.0
-	github.com/aws/aws-sdk-go v1.15.88
-	github.com/cenkalti/backoff v2.0.0+incompatible // indirect
+	github.com/aws/aws-lambda-go v1.33.0
+	github.com/aws/aws-sdk-go v1.22.0
 	github.com/google/uuid v1.1.0
 	github.com/guregu/dynamo v1.0.0
-	github.com/guregu/toki v0.0.0-20150128062511-84b1fe56f646 // indirect
-	github.com/pkg/errors v0.8.0
+	github.com/pkg/errors v0.9.1
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/sirupsen/logrus v1.2.0
-	github.com/stretchr/testify v1.2.2
+	github.com/stretchr/testify v1.7.2
+	github.com/xeipuuv/gojsonschema v1.2.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/cenkalti/backoff v2.0.0+incompatible // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/guregu/toki v0.0.0-20150128062511-84b1fe56f646 // indirect
+	github.com/jmespath/go-jmespath v0.0.0-20180206201540-c2b33e8439af // indirect
+	github.com/konsorten/go-windows-terminal-sequences v1.0.1 // indirect
+	github.com/xeipuuv/gojsonpointer v0.0.0-20180127040702-4e3ac2762d5f // indirect
+	github.com/xeipuuv/gojsonreference v0.0.0-20180127040603-bd5ef7bd5415 // indirect
+	golang.org/x/crypto v0.0.0-20180904163835-0709b304e793 // indirect
 	golang.org/x/net v0.0.0-20181102091132-c10e9556a7bc // indirect
+	golang.org/x/sys v0.0.0-20180905080454-ebe1bf3edb33 // indirect
 	golang.org/x/text v0.3.0 // indirect
 )
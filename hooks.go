@@ -0,0 +1,152 @@
+package generalprobe
+
+import (
+	"context"
+	"time"
+)
+
+// SceneInfo is identity of a scene in events and reports.
+type SceneInfo struct {
+	// Step is position of the scene in the playbook, e.g. "2" and "2.1".
+	Step string `json:"step"`
+	// Index is 0-origin index of the scene in the playbook, or in the
+	// parent composite scene.
+	Index    int  `json:"index"`
+	Teardown bool `json:"teardown,omitempty"`
+	// Name is text explanation of the scene and Type is type name of the
+	// scene such as "InvokeLambdaScene".
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Target is ARN of the resource that the scene accesses. It is empty
+	// if the scene has no target or the ARN can not be resolved.
+	Target string `json:"target,omitempty"`
+}
+
+// RunStartEvent is passed to OnRunStart hooks.
+type RunStartEvent struct {
+	StackName string
+	RunID     string
+	StartTime time.Time
+}
+
+// RunEndEvent is passed to OnRunEnd hooks. Err is error of the run (nil if
+// all scenes passed).
+type RunEndEvent struct {
+	StackName string
+	RunID     string
+	Duration  time.Duration
+	Report    *Report
+	Err       error
+}
+
+// SceneEvent is passed to BeforeScene and AfterScene hooks. Duration,
+// Attempts and Err are set only for AfterScene.
+type SceneEvent struct {
+	SceneInfo
+	Time     time.Time
+	Duration time.Duration
+	Attempts int
+	Err      error
+}
+
+// PollAttemptEvent is passed to OnPollAttempt hooks after each attempt of
+// polling scenes. Done is true if the expected result is found. Err is
+// error that stops polling.
+type PollAttemptEvent struct {
+	SceneInfo
+	Attempt    int
+	Elapsed    time.Duration
+	Done       bool
+	LastResult string
+	Err        error
+}
+
+// hooks are observers of a run registered by OnRunStart, BeforeScene and
+// so on. They must be registered before Play.
+type hooks struct {
+	runStart    []func(RunStartEvent)
+	runEnd      []func(RunEndEvent)
+	beforeScene []func(SceneEvent)
+	afterScene  []func(SceneEvent)
+	pollAttempt []func(PollAttemptEvent)
+}
+
+// OnRunStart adds a hook called when Play, PlayContext or PlayT starts.
+// Hooks are called synchronously in the order of registration. Hooks of
+// scenes are called from multiple goroutines in Parallel, so they must be
+// safe for concurrent use.
+func (x *Generalprobe) OnRunStart(hook func(ev RunStartEvent)) {
+	x.hooks.runStart = append(x.hooks.runStart, hook)
+}
+
+// OnRunEnd adds a hook called after all scenes including teardown and
+// reporters.
+func (x *Generalprobe) OnRunEnd(hook func(ev RunEndEvent)) {
+	x.hooks.runEnd = append(x.hooks.runEnd, hook)
+}
+
+// BeforeScene adds a hook called before each scene, including scenes in
+// composite scenes and teardown.
+func (x *Generalprobe) BeforeScene(hook func(ev SceneEvent)) {
+	x.hooks.beforeScene = append(x.hooks.beforeScene, hook)
+}
+
+// AfterScene adds a hook called after each scene with its result.
+func (x *Generalprobe) AfterScene(hook func(ev SceneEvent)) {
+	x.hooks.afterScene = append(x.hooks.afterScene, hook)
+}
+
+// OnPollAttempt adds a hook called after each attempt of polling scenes
+// such as GetDynamoRecord, GetKinesisStreamRecord and GetLambdaLogs.
+func (x *Generalprobe) OnPollAttempt(hook func(ev PollAttemptEvent)) {
+	x.hooks.pollAttempt = append(x.hooks.pollAttempt, hook)
+}
+
+func (x *Generalprobe) fireRunStart() {
+	ev := RunStartEvent{StackName: x.stackName, RunID: x.runID, StartTime: x.report.StartTime}
+	for _, hook := range x.hooks.runStart {
+		hook(ev)
+	}
+}
+
+func (x *Generalprobe) fireRunEnd(err error) {
+	ev := RunEndEvent{
+		StackName: x.stackName,
+		RunID:     x.runID,
+		Duration:  x.report.Duration(),
+		Report:    x.report,
+		Err:       err,
+	}
+	for _, hook := range x.hooks.runEnd {
+		hook(ev)
+	}
+}
+
+func (x *Generalprobe) fireBeforeScene(r *SceneReport) {
+	ev := SceneEvent{SceneInfo: r.SceneInfo, Time: r.StartTime}
+	for _, hook := range x.hooks.beforeScene {
+		hook(ev)
+	}
+}
+
+func (x *Generalprobe) fireAfterScene(r *SceneReport, err error) {
+	ev := SceneEvent{
+		SceneInfo: r.SceneInfo,
+		Time:      r.EndTime,
+		Duration:  r.Duration(),
+		Attempts:  r.Attempts,
+		Err:       err,
+	}
+	for _, hook := range x.hooks.afterScene {
+		hook(ev)
+	}
+}
+
+func (x *Generalprobe) firePollAttempt(ctx context.Context, ev PollAttemptEvent) {
+	if r := sceneReport(ctx); r != nil {
+		ev.SceneInfo = r.SceneInfo
+	}
+	for _, hook := range x.hooks.pollAttempt {
+		hook(ev)
+	}
+}
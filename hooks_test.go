@@ -0,0 +1,78 @@
+package generalprobe_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gp "github.com/m-mizutani/generalprobe"
+)
+
+func TestHooks(t *testing.T) {
+	backend, probe := newFakeStack(t)
+
+	var mutex sync.Mutex
+	var events []string
+	record := func(format string, args ...interface{}) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		events = append(events, fmt.Sprintf(format, args...))
+	}
+
+	var runEnd gp.RunEndEvent
+	var afterDynamo gp.SceneEvent
+	probe.OnRunStart(func(ev gp.RunStartEvent) { record("start %v", ev.RunID == probe.RunID()) })
+	probe.BeforeScene(func(ev gp.SceneEvent) { record("before %s %s", ev.Step, ev.Type) })
+	probe.AfterScene(func(ev gp.SceneEvent) {
+		record("after %s %v", ev.Step, ev.Err)
+		if ev.Type == "GetDynamoRecordScene" {
+			afterDynamo = ev
+		}
+	})
+	probe.OnPollAttempt(func(ev gp.PollAttemptEvent) {
+		record("poll %s %d %v", ev.Step, ev.Attempt, ev.Done)
+		if ev.Attempt == 2 {
+			require.NoError(t, backend.PutItem(probe.LookupID("ResultStore"), map[string]interface{}{
+				"result_id": "r1",
+			}))
+		}
+	})
+	probe.OnRunEnd(func(ev gp.RunEndEvent) { runEnd = ev })
+
+	err := probe.Play([]gp.Scene{
+		gp.Sequence("wait",
+			gp.GetDynamoRecord(gp.LogicalID("ResultStore"), nil).Key("result_id", "r1").
+				Wait(gp.WaitPolicy{Interval: time.Millisecond, MaxAttempts: 5}),
+		),
+		gp.AdLibE(func() error { return errors.New("broken") }),
+		gp.AdLib(func() {}),
+	})
+	require.Error(t, err)
+
+	assert.Equal(t, []string{
+		"start true",
+		"before 1 SequenceScene",
+		"before 1.1 GetDynamoRecordScene",
+		"poll 1.1 1 false",
+		"poll 1.1 2 false",
+		"poll 1.1 3 true",
+		"after 1.1 <nil>",
+		"after 1 <nil>",
+		"before 2 AdLibScene",
+		"after 2 broken",
+	}, events)
+
+	assert.Equal(t, 3, afterDynamo.Attempts)
+	assert.Equal(t, 0, afterDynamo.Index)
+	assert.Contains(t, afterDynamo.Target, "arn:aws:dynamodb:")
+	assert.True(t, afterDynamo.Duration > 0)
+
+	assert.Equal(t, err, runEnd.Err)
+	require.NotNil(t, runEnd.Report)
+	assert.Equal(t, gp.ResultFailed, runEnd.Report.Result)
+}
@@ -1,13 +1,18 @@
 package generalprobe
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/google/uuid"
 
 	// "github.com/k0kubun/pp"
 	"github.com/pkg/errors"
@@ -15,18 +20,54 @@ import (
 
 // InvokeLambdaScene is a scene only to invoke AWS Lambda.
 type InvokeLambdaScene struct {
-	target   Target
-	input    []byte
-	event    interface{}
-	callback InvokeLambdaCallback
+	target Target
+	input  []byte
+	event  interface{}
+	// eventBuilder creates event instead of event when the scene is played.
+	eventBuilder eventBuilder
+	err          error
+	callback     InvokeLambdaCallbackE
+	captures     []jsonCapture
+	expectation
+	payloadTemplate
 	baseScene
+
+	resultCallback      InvokeLambdaResultCallback
+	expectFunctionError bool
+	result              *InvokeLambdaResult
+
+	invocationType   string
+	qualifier        string
+	clientContext    map[string]interface{}
+	requestIDCapture string
 }
 
 // InvokeLambdaCallback is callback function called after Lambda exits
 type InvokeLambdaCallback func(response []byte)
 
+// InvokeLambdaCallbackE is callback function called after Lambda exits. The
+// scene fails if it returns error.
+type InvokeLambdaCallbackE func(response []byte) error
+
+// InvokeLambdaResultCallback is callback function called with whole result
+// of invocation. The scene fails if it returns error.
+type InvokeLambdaResultCallback func(result *InvokeLambdaResult) error
+
 // InvokeLambda is a constructor of Scene
 func InvokeLambda(target Target, callback InvokeLambdaCallback) *InvokeLambdaScene {
+	var callbackE InvokeLambdaCallbackE
+	if callback != nil {
+		callbackE = func(response []byte) error {
+			callback(response)
+			return nil
+		}
+	}
+	return InvokeLambdaE(target, callbackE)
+}
+
+// InvokeLambdaE is a constructor of Scene with callback that can fail the
+// scene by returning error.
+func InvokeLambdaE(target Target, callback InvokeLambdaCallbackE) *InvokeLambdaScene {
 	scene := InvokeLambdaScene{
 		target:   target,
 		callback: callback,
@@ -34,71 +75,293 @@ func InvokeLambda(target Target, callback InvokeLambdaCallback) *InvokeLambdaSce
 	return &scene
 }
 
+// InvokeLambdaWithResult is a constructor of Scene with callback that
+// receives InvokeLambdaResult including FunctionError, status code and tail
+// log of the invocation.
+func InvokeLambdaWithResult(target Target, callback InvokeLambdaResultCallback) *InvokeLambdaScene {
+	scene := InvokeLambdaScene{
+		target:         target,
+		resultCallback: callback,
+	}
+	return &scene
+}
+
+// ExpectFunctionError makes the scene expect that the function returns
+// error. By default, the scene fails if FunctionError of the response is
+// set. With ExpectFunctionError, it fails if FunctionError is not set, and
+// callbacks and matchers receive the error payload.
+func (x *InvokeLambdaScene) ExpectFunctionError() *InvokeLambdaScene {
+	x.expectFunctionError = true
+	return x
+}
+
+// Async makes the scene invoke the function asynchronously (InvocationType
+// Event). Response payload is empty and the scene does not wait for
+// completion of the function. Request ID of the invocation can be stored
+// by CaptureRequestID to find logs of the invocation by later scenes.
+func (x *InvokeLambdaScene) Async() *InvokeLambdaScene {
+	x.invocationType = lambda.InvocationTypeEvent
+	return x
+}
+
+// DryRun makes the scene only validate parameters and permission of the
+// invocation (InvocationType DryRun). The function is not run.
+func (x *InvokeLambdaScene) DryRun() *InvokeLambdaScene {
+	x.invocationType = lambda.InvocationTypeDryRun
+	return x
+}
+
+// Qualifier sets version or alias (e.g. "live") of the function to invoke.
+func (x *InvokeLambdaScene) Qualifier(qualifier string) *InvokeLambdaScene {
+	x.qualifier = qualifier
+	return x
+}
+
+// Version sets version number of the function to invoke.
+func (x *InvokeLambdaScene) Version(version int) *InvokeLambdaScene {
+	return x.Qualifier(strconv.Itoa(version))
+}
+
+// ClientContext sets client context that is passed to the function.
+// clientContext is marshaled to JSON as it is, e.g.
+// {"custom": {"key": "value"}}. Templates in values are rendered if
+// Template is called.
+func (x *InvokeLambdaScene) ClientContext(clientContext map[string]interface{}) *InvokeLambdaScene {
+	x.clientContext = clientContext
+	return x
+}
+
+// CaptureRequestID stores request ID of the invocation as variable name.
+func (x *InvokeLambdaScene) CaptureRequestID(name string) *InvokeLambdaScene {
+	x.requestIDCapture = name
+	return x
+}
+
+// Result returns result of the last invocation by the scene. It returns nil
+// before the scene is played.
+func (x *InvokeLambdaScene) Result() *InvokeLambdaResult {
+	return x.result
+}
+
 // Strings return text explanation of the scene
 func (x *InvokeLambdaScene) string() string {
-	return fmt.Sprintf("Invoke Lambda %s", x.target.arn(x.gp))
+	text := fmt.Sprintf("Invoke Lambda %s", targetString(x.target, x.gp))
+	if x.qualifier != "" {
+		text += ":" + x.qualifier
+	}
+	switch x.invocationType {
+	case lambda.InvocationTypeEvent:
+		text += " (async)"
+	case lambda.InvocationTypeDryRun:
+		text += " (dry run)"
+	}
+	return text
 }
 
-func toMessage(msg interface{}) string {
+func (x *InvokeLambdaScene) sceneTarget() Target { return x.target }
+
+func toMessage(msg interface{}) (string, error) {
 	switch v := msg.(type) {
 	case string:
-		return v
+		return v, nil
 	case []byte:
-		return string(v)
+		return string(v), nil
 	default:
 		raw, err := json.Marshal(v)
 		if err != nil {
-			logger.WithField("message", msg).Fatal(err)
+			return "", errors.Wrapf(err, "Fail to marshal message: %v", msg)
 		}
-		return string(raw)
+		return string(raw), nil
 	}
 }
 
-// SnsEvent sets SNS event as argument of invoke Lambda.
+// SnsEvent sets SNS event as argument of invoke Lambda. An error of
+// marshaling input is returned when the scene is played. The event has
+// realistic default values such as message ID and timestamp, and ARN of
+// a dummy topic "generalprobe" because the topic is not specified.
 func (x *InvokeLambdaScene) SnsEvent(input interface{}) *InvokeLambdaScene {
-	msg := toMessage(input)
-	event := events.SNSEvent{
-		Records: []events.SNSEventRecord{
-			events.SNSEventRecord{
-				SNS: events.SNSEntity{
-					Message: msg,
+	return x.buildEvent(func(ctx context.Context) (interface{}, error) {
+		msg, err := x.renderPayload(ctx, x.gp, input)
+		if err != nil {
+			return nil, err
+		}
+
+		topicArn := fmt.Sprintf("arn:aws:sns:%s:%s:generalprobe", x.region(), x.gp.awsAccount)
+		event := events.SNSEvent{
+			Records: []events.SNSEventRecord{
+				events.SNSEventRecord{
+					EventVersion:         "1.0",
+					EventSubscriptionArn: topicArn + ":" + uuid.New().String(),
+					EventSource:          "aws:sns",
+					SNS: events.SNSEntity{
+						SignatureVersion:  "1",
+						Timestamp:         time.Now().UTC(),
+						MessageID:         uuid.New().String(),
+						Type:              "Notification",
+						TopicArn:          topicArn,
+						MessageAttributes: map[string]interface{}{},
+						Message:           msg,
+					},
 				},
 			},
-		},
-	}
-	return x.Event(event)
+		}
+		return event, nil
+	})
+}
+
+// Expect sets matchers to check response of the Lambda function. The scene
+// fails if the response does not satisfy them.
+func (x *InvokeLambdaScene) Expect(matchers ...Matcher) *InvokeLambdaScene {
+	x.expect(matchers)
+	return x
+}
+
+// MatchSnapshot expects that response of the Lambda function equals golden
+// file of name. See Snapshot for ignorePaths and update mode.
+func (x *InvokeLambdaScene) MatchSnapshot(name string, ignorePaths ...string) *InvokeLambdaScene {
+	return x.Expect(Snapshot(name, ignorePaths...))
 }
 
 // Event sets general event structure as argument of invoke Lambda.
 // event will be marshaled to JSON string and pass it to Lambda.
 func (x *InvokeLambdaScene) Event(event interface{}) *InvokeLambdaScene {
 	x.event = event
+	x.eventBuilder = nil
 	return x
 }
 
-func (x *InvokeLambdaScene) play() error {
-	eventData, err := json.Marshal(x.event)
+// Template enables templates such as {{ runID }} and {{ .vars.name }} in
+// the event and client context. Only string values of structure data are
+// rendered, and {{ toJSON .vars.name }} embeds a value into JSON text
+// safely. Without Template, the event is sent as it is.
+func (x *InvokeLambdaScene) Template() *InvokeLambdaScene {
+	x.templated = true
+	return x
+}
+
+// Capture stores response payload of Lambda as variable name.
+func (x *InvokeLambdaScene) Capture(name string) *InvokeLambdaScene {
+	x.captures = append(x.captures, jsonCapture{name: name})
+	return x
+}
+
+// CaptureJSONPath stores a value specified by JSONPath (e.g. $.result.id)
+// in response payload of Lambda as variable name.
+func (x *InvokeLambdaScene) CaptureJSONPath(name, path string) *InvokeLambdaScene {
+	x.captures = append(x.captures, jsonCapture{name: name, path: path})
+	return x
+}
+
+func (x *InvokeLambdaScene) play(ctx context.Context) error {
+	if x.err != nil {
+		return x.err
+	}
+
+	eventData, err := x.eventData(ctx)
 	if err != nil {
-		return errors.Wrap(err, "unmarshal event")
+		return err
 	}
 
-	ssn := session.Must(session.NewSession(&aws.Config{
-		Region: aws.String(x.region()),
-	}))
-	lambdaService := lambda.New(ssn)
+	lambdaService := x.clients().Lambda
 
-	lambdaArn := x.target.arn(x.gp)
-	resp, err := lambdaService.Invoke(&lambda.InvokeInput{
+	lambdaArn, err := x.target.arn(x.gp)
+	if err != nil {
+		return err
+	}
+	x.gp.recordPayload(ctx, x.target, eventData)
+	input := &lambda.InvokeInput{
 		FunctionName: aws.String(lambdaArn),
 		Payload:      eventData,
-	})
+	}
+	if x.invocationType == "" {
+		input.LogType = aws.String(lambda.LogTypeTail)
+	} else {
+		input.InvocationType = aws.String(x.invocationType)
+	}
+	if x.qualifier != "" {
+		input.Qualifier = aws.String(x.qualifier)
+	}
+	if x.clientContext != nil {
+		clientContext, err := x.renderClientContext(ctx)
+		if err != nil {
+			return err
+		}
+		input.ClientContext = aws.String(clientContext)
+	}
+
+	var requestID string
+	resp, err := lambdaService.InvokeWithContext(ctx, input,
+		request.WithGetResponseHeader("X-Amzn-Requestid", &requestID))
+	if err != nil {
+		return errors.Wrap(err, "Fail to invoke lambda")
+	}
+
+	x.log().WithField("response", resp).Debug("lamba invoked")
+
+	result, err := newInvokeLambdaResult(resp)
 	if err != nil {
-		logger.Fatal("Fail to invoke lambda", err)
+		return err
+	}
+	result.RequestID = requestID
+	x.result = result
+	x.log().WithField("tail", result.LogTail).Debug("Tail log of lambda")
+
+	if x.requestIDCapture != "" {
+		x.vars().Set(x.requestIDCapture, requestID)
+	}
+
+	switch {
+	case result.FunctionError != "" && !x.expectFunctionError:
+		return newLambdaFunctionError(result)
+	case result.FunctionError == "" && x.expectFunctionError:
+		return errors.Wrapf(ErrUnexpectedResult, "Lambda function error is expected, but succeeded: %s", string(result.Payload))
+	}
+
+	if err := captureJSON(x.vars(), x.captures, result.Payload); err != nil {
+		return err
 	}
 
-	logger.WithField("response", resp).Debug("lamba invoked")
+	if x.callback != nil {
+		if err := x.callback(result.Payload); err != nil {
+			return errors.Wrap(err, "Rejected by callback")
+		}
+	}
+	if x.resultCallback != nil {
+		if err := x.resultCallback(result); err != nil {
+			return errors.Wrap(err, "Rejected by callback")
+		}
+	}
 
-	x.callback(resp.Payload)
+	if err := x.verify(ctx, result.Payload); err != nil {
+		return errors.Wrap(err, "Unexpected Lambda response")
+	}
 
 	return nil
 }
+
+// eventData returns JSON of the event. If templated, templates in the event
+// are rendered by event builders or here.
+func (x *InvokeLambdaScene) eventData(ctx context.Context) ([]byte, error) {
+	if x.eventBuilder != nil {
+		event, err := x.eventBuilder(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "Fail to build event")
+		}
+		raw, err := json.Marshal(event)
+		if err != nil {
+			return nil, errors.Wrap(err, "unmarshal event")
+		}
+		return raw, nil
+	}
+
+	return x.renderPayloadData(ctx, x.gp, x.event)
+}
+
+// renderClientContext returns base64 encoded JSON of client context.
+func (x *InvokeLambdaScene) renderClientContext(ctx context.Context) (string, error) {
+	raw, err := x.renderPayloadData(ctx, x.gp, x.clientContext)
+	if err != nil {
+		return "", errors.Wrap(err, "Fail to marshal client context")
+	}
+	return base64.StdEncoding.EncodeToString(raw), nil
+}
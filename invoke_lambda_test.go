@@ -0,0 +1,85 @@
+package generalprobe_test
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gp "github.com/m-mizutani/generalprobe"
+	"github.com/m-mizutani/generalprobe/fake"
+)
+
+func TestInvokeLambdaModes(t *testing.T) {
+	backend, probe := newFakeStack(t)
+
+	var calls int32
+	name := backend.AddFunction("Echo", func(ctx context.Context, payload []byte) ([]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		fake.Logf(ctx, "echo %s", payload)
+		return []byte(fmt.Sprintf(`{"client":"%v"}`, fake.ClientContext(ctx)["custom"])), nil
+	})
+	target := gp.Arn(fmt.Sprintf("arn:aws:lambda:%s:%s:function:%s", fakeRegion, fakeAccount, name))
+
+	t.Run("qualifier and client context", func(t *testing.T) {
+		scene := gp.InvokeLambda(target, nil).
+			Event(map[string]string{"id": "x"}).
+			Qualifier("live").
+			ClientContext(map[string]interface{}{"custom": "{{ runID }}"}).
+			Template().
+			Expect(gp.PathEquals("$.client", probe.RunID()))
+		require.NoError(t, probe.Play([]gp.Scene{scene}))
+		assert.Equal(t, "live", scene.Result().ExecutedVersion)
+		assert.NotEmpty(t, scene.Result().RequestID)
+
+		scene = gp.InvokeLambda(target, nil).Event(map[string]string{"id": "x"}).Version(3)
+		require.NoError(t, probe.Play([]gp.Scene{scene}))
+		assert.Equal(t, "3", scene.Result().ExecutedVersion)
+	})
+
+	t.Run("async", func(t *testing.T) {
+		scene := gp.InvokeLambda(target, nil).
+			Event(map[string]string{"id": "async"}).
+			Async().
+			CaptureRequestID("request_id")
+		require.NoError(t, probe.Play([]gp.Scene{
+			scene,
+			gp.GetLambdaLogs(target, func(log gp.CloudWatchLog) bool {
+				return gp.IsReportLine(string(log))
+			}).Filter("{{ .vars.request_id }}"),
+		}))
+		assert.Equal(t, 202, scene.Result().StatusCode)
+		assert.Empty(t, scene.Result().Payload)
+		requestID, ok := probe.Vars().Get("request_id")
+		require.True(t, ok)
+		assert.Equal(t, scene.Result().RequestID, requestID)
+	})
+
+	t.Run("template keeps field order", func(t *testing.T) {
+		echo := backend.AddFunction("RawEcho", func(ctx context.Context, payload []byte) ([]byte, error) {
+			return payload, nil
+		})
+		type item struct {
+			Zone  string      `json:"zone"`
+			Count int64       `json:"count"`
+			Attrs interface{} `json:"attrs"`
+		}
+		event := item{Zone: "{{ runID }}", Count: 9007199254740993, Attrs: []interface{}{nil, true, 1.5}}
+		scene := gp.InvokeLambda(gp.Arn(fmt.Sprintf("arn:aws:lambda:%s:%s:function:%s", fakeRegion, fakeAccount, echo)), nil).
+			Event(event).Template()
+		require.NoError(t, probe.Play([]gp.Scene{scene}))
+		assert.Equal(t, fmt.Sprintf(`{"zone":"%s","count":9007199254740993,"attrs":[null,true,1.5]}`, probe.RunID()),
+			string(scene.Result().Payload))
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		before := atomic.LoadInt32(&calls)
+		scene := gp.InvokeLambda(target, nil).Event(map[string]string{"id": "x"}).DryRun()
+		require.NoError(t, probe.Play([]gp.Scene{scene}))
+		assert.Equal(t, 204, scene.Result().StatusCode)
+		assert.Equal(t, before, atomic.LoadInt32(&calls))
+	})
+}
@@ -0,0 +1,72 @@
+package generalprobe
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// decodeJSON unmarshals data into a new value of T.
+func decodeJSON[T any](data []byte) (T, error) {
+	var v T
+	if err := json.Unmarshal(data, &v); err != nil {
+		return v, errors.Wrapf(err, "Fail to decode JSON: %s", string(data))
+	}
+	return v, nil
+}
+
+// InvokeLambdaJSON is a constructor of InvokeLambdaScene with callback that
+// receives response of the Lambda function decoded into T. The scene fails
+// if the response can not be decoded or the callback returns error. If
+// callback is nil, the response is only decoded.
+func InvokeLambdaJSON[T any](target Target, callback func(response T) error) *InvokeLambdaScene {
+	return InvokeLambdaE(target, func(response []byte) error {
+		v, err := decodeJSON[T](response)
+		if err != nil {
+			return err
+		}
+		if callback == nil {
+			return nil
+		}
+		return callback(v)
+	})
+}
+
+// GetKinesisStreamJSON is a constructor of GetKinesisStreamRecordScene with
+// callback that receives a record decoded into T. The scene fails if a
+// record can not be decoded. Returned values of callback are same as
+// GetKinesisStreamRecordCallbackE.
+func GetKinesisStreamJSON[T any](target Target, callback func(record T) (bool, error)) *GetKinesisStreamRecordScene {
+	return GetKinesisStreamRecordE(target, func(data []byte) (bool, error) {
+		v, err := decodeJSON[T](data)
+		if err != nil {
+			return false, err
+		}
+		return callback(v)
+	})
+}
+
+// GetLambdaLogsJSON is a constructor of GetLambdaLogsScene with callback
+// that receives a log message decoded into T. The message is parsed by
+// ParseLambdaLog, so prefix of runtimes (e.g. Node.js and Python) is removed
+// before decoding. Log messages that are not JSON (e.g. START and REPORT
+// lines of Lambda) are skipped, but the scene fails if a JSON message can
+// not be decoded into T. Returned values of callback are same as
+// GetLambdaLogsCallbackE.
+func GetLambdaLogsJSON[T any](target Target, callback func(log T) (bool, error)) *GetLambdaLogsScene {
+	var callbackE GetLambdaLogsCallbackE
+	if callback != nil {
+		callbackE = func(log CloudWatchLog) (bool, error) {
+			msg := []byte(ParseLambdaLog(string(log)).Message)
+			if !json.Valid(msg) {
+				return false, nil
+			}
+			v, err := decodeJSON[T](msg)
+			if err != nil {
+				return false, err
+			}
+			return callback(v)
+		}
+	}
+	return GetLambdaLogsE(target, callbackE)
+}
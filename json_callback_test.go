@@ -0,0 +1,112 @@
+package generalprobe_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gp "github.com/m-mizutani/generalprobe"
+)
+
+type jsonRecord struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+func TestJSONCallbacks(t *testing.T) {
+	backend, probe := newFakeStack(t)
+	group := "/aws/lambda/" + probe.LookupID("TestHandler")
+	backend.PutLog(group, "stream", "START RequestId: 0000")
+	backend.PutLog(group, "stream", `{"id":"log-0","status":"running"}`)
+	backend.PutLog(group, "stream", "2024-01-02T03:04:05.678Z\t0000\tINFO\t"+`{"id":"log-1","status":"done"}`)
+
+	var logRecord jsonRecord
+	var streamRecord jsonRecord
+	require.NoError(t, probe.Play([]gp.Scene{
+		gp.PutKinesisStreamRecord(gp.LogicalID("ResultStream"), []byte(`{"id":"kinesis-1"}`)),
+		gp.GetKinesisStreamJSON(gp.LogicalID("ResultStream"), func(record jsonRecord) (bool, error) {
+			streamRecord = record
+			return true, nil
+		}),
+		gp.GetLambdaLogsJSON(gp.LogicalID("TestHandler"), func(log jsonRecord) (bool, error) {
+			logRecord = log
+			return log.Status == "done", nil
+		}),
+	}))
+
+	assert.Equal(t, "kinesis-1", streamRecord.ID)
+	assert.Equal(t, "log-1", logRecord.ID)
+}
+
+func TestInvokeLambdaJSON(t *testing.T) {
+	_, probe := newFakeStack(t)
+
+	type response struct {
+		Message string `json:"message"`
+	}
+	var message string
+	require.NoError(t, probe.Play([]gp.Scene{
+		gp.InvokeLambdaJSON(gp.LogicalID("TestHandler"), func(resp response) error {
+			message = resp.Message
+			return nil
+		}).SnsEvent(jsonRecord{ID: "lambda-1"}),
+	}))
+	assert.Equal(t, "ok", message)
+
+	err := probe.Play([]gp.Scene{
+		gp.InvokeLambdaJSON(gp.LogicalID("TestHandler"), func(resp response) error {
+			return errors.New("rejected")
+		}).SnsEvent(jsonRecord{ID: "lambda-2"}),
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "rejected")
+
+	// Response is only decoded without callback.
+	require.NoError(t, probe.Play([]gp.Scene{
+		gp.InvokeLambdaJSON[response](gp.LogicalID("TestHandler"), nil).SnsEvent(jsonRecord{ID: "lambda-3"}),
+	}))
+}
+
+func TestJSONCallbacksDecodeError(t *testing.T) {
+	t.Run("kinesis", func(t *testing.T) {
+		_, probe := newFakeStack(t)
+		err := probe.Play([]gp.Scene{
+			gp.PutKinesisStreamRecord(gp.LogicalID("ResultStream"), []byte("not json")),
+			gp.GetKinesisStreamJSON(gp.LogicalID("ResultStream"), func(record jsonRecord) (bool, error) {
+				return true, nil
+			}),
+		})
+		require.Error(t, err)
+		assert.False(t, errors.Is(err, gp.ErrPollingTimeout))
+		assert.Contains(t, err.Error(), "not json")
+	})
+
+	t.Run("lambda logs", func(t *testing.T) {
+		backend, probe := newFakeStack(t)
+		group := "/aws/lambda/" + probe.LookupID("TestHandler")
+		backend.PutLog(group, "stream", "not json")
+		backend.PutLog(group, "stream", `{"id":1}`)
+
+		err := probe.Play([]gp.Scene{
+			gp.GetLambdaLogsJSON(gp.LogicalID("TestHandler"), func(log jsonRecord) (bool, error) {
+				return true, nil
+			}),
+		})
+		require.Error(t, err)
+		assert.False(t, errors.Is(err, gp.ErrPollingTimeout))
+		assert.Contains(t, err.Error(), `Fail to decode JSON: {"id":1}`)
+	})
+
+	t.Run("lambda", func(t *testing.T) {
+		_, probe := newFakeStack(t)
+		err := probe.Play([]gp.Scene{
+			gp.InvokeLambdaJSON(gp.LogicalID("TestHandler"), func(resp []string) error {
+				return nil
+			}).SnsEvent(map[string]string{"id": "x"}),
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "Fail to decode JSON")
+	})
+}
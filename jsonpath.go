@@ -0,0 +1,129 @@
+package generalprobe
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// lookupJSONPath returns a value specified by path from data decoded by
+// json.Unmarshal. Supported syntax is subset of JSONPath: root ($), child
+// (.name or ['name']) and array index ([0]).
+func lookupJSONPath(data interface{}, path string) (interface{}, error) {
+	keys, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	current := data
+	for _, key := range keys {
+		if _, ok := key.(jsonPathWildcard); ok {
+			return nil, fmt.Errorf("%s: wildcard is not supported", path)
+		}
+
+		switch v := current.(type) {
+		case map[string]interface{}:
+			name, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: index %v is applied to object", path, key)
+			}
+			child, ok := v[name]
+			if !ok {
+				return nil, fmt.Errorf("%s: field '%s' is not found", path, name)
+			}
+			current = child
+
+		case []interface{}:
+			idx, ok := key.(int)
+			if !ok {
+				return nil, fmt.Errorf("%s: field '%v' is applied to array", path, key)
+			}
+			if idx < 0 {
+				idx += len(v)
+			}
+			if idx < 0 || len(v) <= idx {
+				return nil, fmt.Errorf("%s: index %d is out of range", path, idx)
+			}
+			current = v[idx]
+
+		default:
+			return nil, fmt.Errorf("%s: '%v' is applied to non-container value", path, key)
+		}
+	}
+
+	return current, nil
+}
+
+// lookupJSONPathBytes decodes raw as JSON and looks up path.
+func lookupJSONPathBytes(raw []byte, path string) (interface{}, error) {
+	var data interface{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, errors.Wrapf(err, "Not JSON data: %s", string(raw))
+	}
+	return lookupJSONPath(data, path)
+}
+
+// jsonPathWildcard is parsed from * of JSONPath such as $.items[*].id and
+// $.detail.*. It is supported only by ignore paths of snapshot.
+type jsonPathWildcard struct{}
+
+// parseJSONPath splits path into field names (string), indices (int) and
+// wildcards (jsonPathWildcard).
+func parseJSONPath(path string) ([]interface{}, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("JSONPath must start with '$': %s", path)
+	}
+
+	var keys []interface{}
+	s := path[1:]
+	for len(s) > 0 {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("Empty field name in JSONPath: %s", path)
+			}
+			if s[:end] == "*" {
+				keys = append(keys, jsonPathWildcard{})
+			} else {
+				keys = append(keys, s[:end])
+			}
+			s = s[end:]
+
+		case '[':
+			end := strings.Index(s, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("Unclosed bracket in JSONPath: %s", path)
+			}
+			inner := s[1:end]
+			s = s[end+1:]
+
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				keys = append(keys, inner[1:len(inner)-1])
+				continue
+			}
+			if inner == "*" {
+				keys = append(keys, jsonPathWildcard{})
+				continue
+			}
+
+			idx, err := strconv.Atoi(inner)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid index '%s' in JSONPath: %s", inner, path)
+			}
+			keys = append(keys, idx)
+
+		default:
+			return nil, fmt.Errorf("Invalid JSONPath: %s", path)
+		}
+	}
+
+	return keys, nil
+}
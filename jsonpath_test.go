@@ -0,0 +1,29 @@
+package generalprobe
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupJSONPath(t *testing.T) {
+	raw := []byte(`{"a":{"b":[{"c":"x"},{"c":"y"}],"d e":1}}`)
+
+	testCases := map[string]interface{}{
+		"$.a.b[0].c":    "x",
+		"$.a.b[-1].c":   "y",
+		"$['a']['d e']": float64(1),
+		"$.a.b[1]":      map[string]interface{}{"c": "y"},
+	}
+	for path, expected := range testCases {
+		actual, err := lookupJSONPathBytes(raw, path)
+		require.NoError(t, err, path)
+		assert.Equal(t, expected, actual, path)
+	}
+
+	for _, path := range []string{"a.b", "$.a.z", "$.a.b[2]", "$.a.b.c", "$.a[0]", "$.a.b[x]", "$.a.b[0"} {
+		_, err := lookupJSONPathBytes(raw, path)
+		assert.Error(t, err, path)
+	}
+}
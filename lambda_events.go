@@ -0,0 +1,575 @@
+package generalprobe
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Event builders below create events of common Lambda triggers with
+// realistic default values. Events are built when the scene is played
+// because ARNs of targets are resolved with the stack. Messages, bodies and
+// records can be string, []byte or a value marshaled to JSON. Templates in
+// them are rendered if Template is called.
+
+const (
+	apiGatewayTimeFormat = "02/Jan/2006:15:04:05 -0700"
+	apiGatewaySourceIP   = "192.0.2.1"
+	apiGatewayUserAgent  = "generalprobe"
+)
+
+// eventBuilder creates event of InvokeLambdaScene when it is played.
+type eventBuilder func(ctx context.Context) (interface{}, error)
+
+func (x *InvokeLambdaScene) buildEvent(builder eventBuilder) *InvokeLambdaScene {
+	x.event = nil
+	x.eventBuilder = builder
+	return x
+}
+
+func toMilliSecString(t time.Time) string {
+	return fmt.Sprint(t.UnixNano() / int64(time.Millisecond))
+}
+
+// SqsEvent sets SQS event with messages as argument of invoke Lambda. Each
+// message is a record of the event with message ID, MD5 of body and ARN of
+// queue.
+func (x *InvokeLambdaScene) SqsEvent(queue Target, messages ...interface{}) *InvokeLambdaScene {
+	return x.buildEvent(func(ctx context.Context) (interface{}, error) {
+		queueArn, err := queue.arn(x.gp)
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now().UTC()
+		event := events.SQSEvent{Records: []events.SQSMessage{}}
+		for _, msg := range messages {
+			body, err := x.renderPayload(ctx, x.gp, msg)
+			if err != nil {
+				return nil, err
+			}
+			receipt, err := randomString(64)
+			if err != nil {
+				return nil, err
+			}
+			digest := md5.Sum([]byte(body))
+
+			event.Records = append(event.Records, events.SQSMessage{
+				MessageId:     uuid.New().String(),
+				ReceiptHandle: receipt,
+				Body:          body,
+				Md5OfBody:     hex.EncodeToString(digest[:]),
+				Attributes: map[string]string{
+					"ApproximateReceiveCount":          "1",
+					"SentTimestamp":                    toMilliSecString(now),
+					"SenderId":                         x.gp.awsAccount,
+					"ApproximateFirstReceiveTimestamp": toMilliSecString(now),
+				},
+				MessageAttributes: map[string]events.SQSMessageAttribute{},
+				EventSourceARN:    queueArn,
+				EventSource:       "aws:sqs",
+				AWSRegion:         x.region(),
+			})
+		}
+		return event, nil
+	})
+}
+
+// S3Event sets S3 event of ObjectCreated:Put for key in bucket as argument
+// of invoke Lambda.
+func (x *InvokeLambdaScene) S3Event(bucket Target, key string) *InvokeLambdaScene {
+	return x.buildEvent(func(ctx context.Context) (interface{}, error) {
+		bucketArn, err := bucket.arn(x.gp)
+		if err != nil {
+			return nil, err
+		}
+		bucketName, err := bucket.name(x.gp)
+		if err != nil {
+			return nil, err
+		}
+		objectKey, err := x.renderPayload(ctx, x.gp, key)
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now().UTC()
+		principal := events.S3UserIdentity{PrincipalID: "AWS:" + x.gp.awsAccount}
+		record := events.S3EventRecord{
+			EventVersion:      "2.1",
+			EventSource:       "aws:s3",
+			AWSRegion:         x.region(),
+			EventTime:         now,
+			EventName:         "ObjectCreated:Put",
+			PrincipalID:       principal,
+			RequestParameters: events.S3RequestParameters{SourceIPAddress: apiGatewaySourceIP},
+			ResponseElements: map[string]string{
+				"x-amz-request-id": strings.ToUpper(strings.Replace(uuid.New().String(), "-", "", -1))[:16],
+				"x-amz-id-2":       uuid.New().String(),
+			},
+			S3: events.S3Entity{
+				SchemaVersion:   "1.0",
+				ConfigurationID: "generalprobe",
+				Bucket: events.S3Bucket{
+					Name:          bucketName,
+					OwnerIdentity: principal,
+					Arn:           bucketArn,
+				},
+				Object: events.S3Object{
+					// Key in S3 event is URL encoded.
+					Key:           strings.Replace(url.QueryEscape(objectKey), "%2F", "/", -1),
+					URLDecodedKey: objectKey,
+					Sequencer:     fmt.Sprintf("%X", now.UnixNano()),
+				},
+			},
+		}
+		return events.S3Event{Records: []events.S3EventRecord{record}}, nil
+	})
+}
+
+// KinesisEvent sets Kinesis event with records as argument of invoke Lambda.
+// Data of each record is base64 encoded in the event, and records have
+// increasing sequence numbers and random partition keys.
+func (x *InvokeLambdaScene) KinesisEvent(stream Target, records ...interface{}) *InvokeLambdaScene {
+	return x.buildEvent(func(ctx context.Context) (interface{}, error) {
+		streamArn, err := stream.arn(x.gp)
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now().UTC()
+		event := events.KinesisEvent{Records: []events.KinesisEventRecord{}}
+		for i, record := range records {
+			data, err := x.renderPayload(ctx, x.gp, record)
+			if err != nil {
+				return nil, err
+			}
+			seq := fmt.Sprintf("49%020d%034d", now.UnixNano(), i)
+
+			event.Records = append(event.Records, events.KinesisEventRecord{
+				AwsRegion:      x.region(),
+				EventID:        "shardId-000000000000:" + seq,
+				EventName:      "aws:kinesis:record",
+				EventSource:    "aws:kinesis",
+				EventSourceArn: streamArn,
+				EventVersion:   "1.0",
+				Kinesis: events.KinesisRecord{
+					ApproximateArrivalTimestamp: events.SecondsEpochTime{Time: now},
+					Data:                        []byte(data),
+					PartitionKey:                uuid.New().String(),
+					SequenceNumber:              seq,
+					KinesisSchemaVersion:        "1.0",
+				},
+			})
+		}
+		return event, nil
+	})
+}
+
+// DynamoDBStreamEvent sets DynamoDB Streams event of a change of item in
+// table from oldImage to newImage as argument of invoke Lambda. eventName is
+// INSERT if oldImage is nil, REMOVE if newImage is nil, otherwise MODIFY.
+// Keys of the record are taken from the images by key schema of the table.
+func (x *InvokeLambdaScene) DynamoDBStreamEvent(table Target, oldImage, newImage interface{}) *InvokeLambdaScene {
+	return x.buildEvent(func(ctx context.Context) (interface{}, error) {
+		tableName, err := table.name(x.gp)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := x.clients().DynamoDB.DescribeTableWithContext(ctx, &dynamodb.DescribeTableInput{
+			TableName: aws.String(tableName),
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "Fail to describe table: %s", tableName)
+		}
+
+		now := time.Now().UTC()
+		streamArn := aws.StringValue(resp.Table.LatestStreamArn)
+		if streamArn == "" {
+			streamArn = fmt.Sprintf("%s/stream/%s", aws.StringValue(resp.Table.TableArn),
+				now.Format("2006-01-02T15:04:05.000"))
+		}
+
+		change := events.DynamoDBStreamRecord{
+			ApproximateCreationDateTime: events.SecondsEpochTime{Time: now},
+			SequenceNumber:              fmt.Sprintf("%d", now.UnixNano()),
+			StreamViewType:              dynamodb.StreamViewTypeNewAndOldImages,
+		}
+		var eventName string
+		switch {
+		case oldImage == nil && newImage == nil:
+			return nil, errors.New("Either old or new image is required for DynamoDB stream event")
+		case oldImage == nil:
+			eventName = string(events.DynamoDBOperationTypeInsert)
+		case newImage == nil:
+			eventName = string(events.DynamoDBOperationTypeRemove)
+		default:
+			eventName = string(events.DynamoDBOperationTypeModify)
+		}
+
+		if oldImage != nil {
+			if change.OldImage, err = x.streamImage(ctx, oldImage); err != nil {
+				return nil, err
+			}
+		}
+		if newImage != nil {
+			if change.NewImage, err = x.streamImage(ctx, newImage); err != nil {
+				return nil, err
+			}
+		}
+
+		image := change.NewImage
+		if image == nil {
+			image = change.OldImage
+		}
+		change.Keys = map[string]events.DynamoDBAttributeValue{}
+		for _, key := range resp.Table.KeySchema {
+			name := aws.StringValue(key.AttributeName)
+			v, ok := image[name]
+			if !ok {
+				return nil, errors.Errorf("Key %s is not found in image of DynamoDB stream event", name)
+			}
+			change.Keys[name] = v
+		}
+
+		raw, err := json.Marshal(image)
+		if err != nil {
+			return nil, errors.Wrap(err, "Fail to marshal image of DynamoDB stream event")
+		}
+		change.SizeBytes = int64(len(raw))
+
+		record := events.DynamoDBEventRecord{
+			AWSRegion:      x.region(),
+			Change:         change,
+			EventID:        strings.Replace(uuid.New().String(), "-", "", -1),
+			EventName:      eventName,
+			EventSource:    "aws:dynamodb",
+			EventVersion:   "1.1",
+			EventSourceArn: streamArn,
+		}
+		return events.DynamoDBEvent{Records: []events.DynamoDBEventRecord{record}}, nil
+	})
+}
+
+// streamImage converts item to image of DynamoDB stream record.
+func (x *InvokeLambdaScene) streamImage(ctx context.Context, item interface{}) (map[string]events.DynamoDBAttributeValue, error) {
+	text, err := x.renderPayload(ctx, x.gp, item)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(text), &values); err != nil {
+		return nil, errors.Wrapf(err, "Fail to unmarshal item of DynamoDB stream event: %s", text)
+	}
+	attrs, err := dynamodbattribute.MarshalMap(values)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Fail to marshal item of DynamoDB stream event: %s", text)
+	}
+
+	image := map[string]events.DynamoDBAttributeValue{}
+	for k, v := range attrs {
+		image[k] = toStreamAttribute(v)
+	}
+	return image, nil
+}
+
+func toStreamAttribute(v *dynamodb.AttributeValue) events.DynamoDBAttributeValue {
+	switch {
+	case v.S != nil:
+		return events.NewStringAttribute(*v.S)
+	case v.N != nil:
+		return events.NewNumberAttribute(*v.N)
+	case v.B != nil:
+		return events.NewBinaryAttribute(v.B)
+	case v.BOOL != nil:
+		return events.NewBooleanAttribute(*v.BOOL)
+	case v.SS != nil:
+		return events.NewStringSetAttribute(aws.StringValueSlice(v.SS))
+	case v.NS != nil:
+		return events.NewNumberSetAttribute(aws.StringValueSlice(v.NS))
+	case v.BS != nil:
+		return events.NewBinarySetAttribute(v.BS)
+	case v.L != nil:
+		list := make([]events.DynamoDBAttributeValue, len(v.L))
+		for i, item := range v.L {
+			list[i] = toStreamAttribute(item)
+		}
+		return events.NewListAttribute(list)
+	case v.M != nil:
+		m := map[string]events.DynamoDBAttributeValue{}
+		for k, item := range v.M {
+			m[k] = toStreamAttribute(item)
+		}
+		return events.NewMapAttribute(m)
+	default:
+		return events.NewNullAttribute()
+	}
+}
+
+// httpRequest is common part of API Gateway events.
+type httpRequest struct {
+	method  string
+	path    string
+	query   url.Values
+	body    string
+	headers map[string]string
+	apiID   string
+	now     time.Time
+}
+
+func (x *InvokeLambdaScene) newHTTPRequest(ctx context.Context, method, path string, body interface{}) (*httpRequest, error) {
+	rendered, err := x.renderPayload(ctx, x.gp, path)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(rendered)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid path of API Gateway event: %s", rendered)
+	}
+	apiID, err := randomString(10)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &httpRequest{
+		method: strings.ToUpper(method),
+		path:   u.Path,
+		query:  u.Query(),
+		apiID:  strings.ToLower(apiID),
+		now:    time.Now().UTC(),
+	}
+	req.headers = map[string]string{
+		"Host":       req.domainName(x.region()),
+		"User-Agent": apiGatewayUserAgent,
+	}
+	if body != nil {
+		if req.body, err = x.renderPayload(ctx, x.gp, body); err != nil {
+			return nil, err
+		}
+		req.headers["Content-Type"] = "application/json"
+	}
+	return req, nil
+}
+
+func (x *httpRequest) domainName(region string) string {
+	return fmt.Sprintf("%s.execute-api.%s.amazonaws.com", x.apiID, region)
+}
+
+// APIGatewayProxyEvent sets API Gateway (REST API) proxy event as argument
+// of invoke Lambda. path can have query string such as "/users?id=1". body
+// is omitted if it is nil.
+func (x *InvokeLambdaScene) APIGatewayProxyEvent(method, path string, body interface{}) *InvokeLambdaScene {
+	return x.buildEvent(func(ctx context.Context) (interface{}, error) {
+		req, err := x.newHTTPRequest(ctx, method, path, body)
+		if err != nil {
+			return nil, err
+		}
+
+		event := events.APIGatewayProxyRequest{
+			Resource:          req.path,
+			Path:              req.path,
+			HTTPMethod:        req.method,
+			Headers:           req.headers,
+			MultiValueHeaders: map[string][]string{},
+			Body:              req.body,
+			RequestContext: events.APIGatewayProxyRequestContext{
+				AccountID:         x.gp.awsAccount,
+				ResourceID:        req.apiID[:6],
+				Stage:             "prod",
+				DomainName:        req.domainName(x.region()),
+				DomainPrefix:      req.apiID,
+				RequestID:         uuid.New().String(),
+				ExtendedRequestID: uuid.New().String(),
+				Protocol:          "HTTP/1.1",
+				Identity: events.APIGatewayRequestIdentity{
+					SourceIP:  apiGatewaySourceIP,
+					UserAgent: apiGatewayUserAgent,
+				},
+				ResourcePath:     req.path,
+				Path:             "/prod" + req.path,
+				HTTPMethod:       req.method,
+				RequestTime:      req.now.Format(apiGatewayTimeFormat),
+				RequestTimeEpoch: req.now.UnixNano() / int64(time.Millisecond),
+				APIID:            req.apiID,
+			},
+		}
+		for k, v := range req.headers {
+			event.MultiValueHeaders[k] = []string{v}
+		}
+		if len(req.query) > 0 {
+			event.QueryStringParameters = map[string]string{}
+			event.MultiValueQueryStringParameters = map[string][]string(req.query)
+			for k, v := range req.query {
+				event.QueryStringParameters[k] = v[len(v)-1]
+			}
+		}
+		return event, nil
+	})
+}
+
+// APIGatewayV2HTTPEvent sets API Gateway HTTP API event (payload format
+// version 2.0) as argument of invoke Lambda. Arguments are same as
+// APIGatewayProxyEvent.
+func (x *InvokeLambdaScene) APIGatewayV2HTTPEvent(method, path string, body interface{}) *InvokeLambdaScene {
+	return x.buildEvent(func(ctx context.Context) (interface{}, error) {
+		req, err := x.newHTTPRequest(ctx, method, path, body)
+		if err != nil {
+			return nil, err
+		}
+
+		headers := map[string]string{}
+		for k, v := range req.headers {
+			// HTTP API passes header names in lower case.
+			headers[strings.ToLower(k)] = v
+		}
+		routeKey := req.method + " " + req.path
+
+		event := events.APIGatewayV2HTTPRequest{
+			Version:        "2.0",
+			RouteKey:       routeKey,
+			RawPath:        req.path,
+			RawQueryString: req.query.Encode(),
+			Headers:        headers,
+			Body:           req.body,
+			RequestContext: events.APIGatewayV2HTTPRequestContext{
+				RouteKey:     routeKey,
+				AccountID:    x.gp.awsAccount,
+				Stage:        "$default",
+				RequestID:    uuid.New().String(),
+				APIID:        req.apiID,
+				DomainName:   req.domainName(x.region()),
+				DomainPrefix: req.apiID,
+				Time:         req.now.Format(apiGatewayTimeFormat),
+				TimeEpoch:    req.now.UnixNano() / int64(time.Millisecond),
+				HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{
+					Method:    req.method,
+					Path:      req.path,
+					Protocol:  "HTTP/1.1",
+					SourceIP:  apiGatewaySourceIP,
+					UserAgent: apiGatewayUserAgent,
+				},
+			},
+		}
+		if len(req.query) > 0 {
+			event.QueryStringParameters = map[string]string{}
+			for k, v := range req.query {
+				// HTTP API joins multiple values with comma.
+				event.QueryStringParameters[k] = strings.Join(v, ",")
+			}
+		}
+		return event, nil
+	})
+}
+
+func (x *InvokeLambdaScene) newCloudWatchEvent(source, detailType string, resources []string, detail string) events.CloudWatchEvent {
+	return events.CloudWatchEvent{
+		Version:    "0",
+		ID:         uuid.New().String(),
+		DetailType: detailType,
+		Source:     source,
+		AccountID:  x.gp.awsAccount,
+		Time:       time.Now().UTC().Truncate(time.Second),
+		Region:     x.region(),
+		Resources:  resources,
+		Detail:     json.RawMessage(detail),
+	}
+}
+
+// CloudWatchScheduledEvent sets scheduled event of CloudWatch Events
+// (EventBridge) rule as argument of invoke Lambda.
+func (x *InvokeLambdaScene) CloudWatchScheduledEvent(rule Target) *InvokeLambdaScene {
+	return x.buildEvent(func(ctx context.Context) (interface{}, error) {
+		ruleArn, err := rule.arn(x.gp)
+		if err != nil {
+			return nil, err
+		}
+		return x.newCloudWatchEvent("aws.events", "Scheduled Event", []string{ruleArn}, "{}"), nil
+	})
+}
+
+// EventBridgeEvent sets EventBridge event with source, detail-type and
+// detail as argument of invoke Lambda. detail that is not JSON is passed as
+// JSON string.
+func (x *InvokeLambdaScene) EventBridgeEvent(source, detailType string, detail interface{}) *InvokeLambdaScene {
+	return x.buildEvent(func(ctx context.Context) (interface{}, error) {
+		text := "{}"
+		if detail != nil {
+			rendered, err := x.renderPayload(ctx, x.gp, detail)
+			if err != nil {
+				return nil, err
+			}
+			text = rendered
+		}
+		if !json.Valid([]byte(text)) {
+			raw, err := json.Marshal(text)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Fail to marshal detail: %s", text)
+			}
+			text = string(raw)
+		}
+		return x.newCloudWatchEvent(source, detailType, []string{}, text), nil
+	})
+}
+
+// CognitoTriggerEvent is event of Cognito User Pools trigger built by
+// InvokeLambdaScene.CognitoTriggerEvent.
+type CognitoTriggerEvent struct {
+	events.CognitoEventUserPoolsHeader
+	Request  CognitoTriggerRequest `json:"request"`
+	Response map[string]string     `json:"response"`
+}
+
+// CognitoTriggerRequest is request part of CognitoTriggerEvent.
+type CognitoTriggerRequest struct {
+	UserAttributes map[string]string `json:"userAttributes"`
+}
+
+// CognitoTriggerEvent sets Cognito User Pools trigger event of
+// triggerSource (e.g. "PreSignUp_SignUp", "PostConfirmation_ConfirmSignUp")
+// for userName as argument of invoke Lambda. Templates in values of
+// userAttributes are rendered if Template is called.
+func (x *InvokeLambdaScene) CognitoTriggerEvent(userPool Target, triggerSource, userName string, userAttributes map[string]string) *InvokeLambdaScene {
+	return x.buildEvent(func(ctx context.Context) (interface{}, error) {
+		userPoolID, err := userPool.name(x.gp)
+		if err != nil {
+			return nil, err
+		}
+		name, err := x.renderPayload(ctx, x.gp, userName)
+		if err != nil {
+			return nil, err
+		}
+		attrs := map[string]string{}
+		for k, v := range userAttributes {
+			if attrs[k], err = x.renderPayload(ctx, x.gp, v); err != nil {
+				return nil, err
+			}
+		}
+
+		return CognitoTriggerEvent{
+			CognitoEventUserPoolsHeader: events.CognitoEventUserPoolsHeader{
+				Version:       "1",
+				TriggerSource: triggerSource,
+				Region:        x.region(),
+				UserPoolID:    userPoolID,
+				CallerContext: events.CognitoEventUserPoolsCallerContext{
+					AWSSDKVersion: "aws-sdk-unknown-unknown",
+					ClientID:      "CLIENT_ID_NOT_APPLICABLE",
+				},
+				UserName: name,
+			},
+			Request:  CognitoTriggerRequest{UserAttributes: attrs},
+			Response: map[string]string{},
+		}, nil
+	})
+}
@@ -0,0 +1,162 @@
+package generalprobe_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gp "github.com/m-mizutani/generalprobe"
+)
+
+func TestEventBuilders(t *testing.T) {
+	backend, probe := newFakeStack(t)
+	name := backend.AddFunction("Echo", func(ctx context.Context, payload []byte) ([]byte, error) {
+		return payload, nil
+	})
+	target := gp.Arn(fmt.Sprintf("arn:aws:lambda:%s:%s:function:%s", fakeRegion, fakeAccount, name))
+	arn := func(service, resource string) string {
+		return fmt.Sprintf("arn:aws:%s:%s:%s:%s", service, fakeRegion, fakeAccount, resource)
+	}
+
+	play := func(t *testing.T, scene *gp.InvokeLambdaScene, event interface{}) {
+		require.NoError(t, probe.Play([]gp.Scene{scene}))
+		require.NoError(t, json.Unmarshal(scene.Result().Payload, event))
+	}
+
+	t.Run("SQS", func(t *testing.T) {
+		var event events.SQSEvent
+		play(t, gp.InvokeLambda(target, nil).Template().SqsEvent(gp.Arn(arn("sqs", "my-queue")),
+			map[string]string{"id": "{{ runID }}"}, "plain"), &event)
+
+		require.Equal(t, 2, len(event.Records))
+		assert.Equal(t, `{"id":"`+probe.RunID()+`"}`, event.Records[0].Body)
+		assert.Equal(t, "plain", event.Records[1].Body)
+		assert.Equal(t, "ac7938d40cfc2307e2bf325d28e7884e", event.Records[1].Md5OfBody)
+		assert.Equal(t, arn("sqs", "my-queue"), event.Records[0].EventSourceARN)
+		assert.NotEqual(t, event.Records[0].MessageId, event.Records[1].MessageId)
+	})
+
+	t.Run("SNS", func(t *testing.T) {
+		var event events.SNSEvent
+		play(t, gp.InvokeLambda(target, nil).SnsEvent(map[string]string{"id": "x"}), &event)
+
+		require.Equal(t, 1, len(event.Records))
+		record := event.Records[0]
+		assert.Equal(t, "aws:sns", record.EventSource)
+		assert.Contains(t, record.EventSubscriptionArn, arn("sns", "generalprobe:"))
+		assert.Equal(t, `{"id":"x"}`, record.SNS.Message)
+		assert.Equal(t, arn("sns", "generalprobe"), record.SNS.TopicArn)
+		assert.Equal(t, "Notification", record.SNS.Type)
+		assert.Equal(t, "1", record.SNS.SignatureVersion)
+		assert.NotEmpty(t, record.SNS.MessageID)
+		assert.False(t, record.SNS.Timestamp.IsZero())
+	})
+
+	t.Run("S3", func(t *testing.T) {
+		var event events.S3Event
+		play(t, gp.InvokeLambda(target, nil).S3Event(gp.LogicalID("ResultBucket"), "logs/my file.json"), &event)
+
+		require.Equal(t, 1, len(event.Records))
+		record := event.Records[0]
+		assert.Equal(t, "ObjectCreated:Put", record.EventName)
+		assert.Equal(t, probe.LookupID("ResultBucket"), record.S3.Bucket.Name)
+		assert.Equal(t, "arn:aws:s3:::"+probe.LookupID("ResultBucket"), record.S3.Bucket.Arn)
+		assert.Equal(t, "logs/my+file.json", record.S3.Object.Key)
+		assert.False(t, record.EventTime.IsZero())
+	})
+
+	t.Run("Kinesis", func(t *testing.T) {
+		var event events.KinesisEvent
+		play(t, gp.InvokeLambda(target, nil).Template().KinesisEvent(gp.LogicalID("ResultStream"),
+			map[string]string{"id": "{{ runID }}"}, []byte("raw")), &event)
+
+		require.Equal(t, 2, len(event.Records))
+		assert.Equal(t, `{"id":"`+probe.RunID()+`"}`, string(event.Records[0].Kinesis.Data))
+		assert.Equal(t, "raw", string(event.Records[1].Kinesis.Data))
+		assert.Equal(t, arn("kinesis", "stream/"+probe.LookupID("ResultStream")), event.Records[0].EventSourceArn)
+		assert.True(t, event.Records[0].Kinesis.SequenceNumber < event.Records[1].Kinesis.SequenceNumber)
+	})
+
+	t.Run("DynamoDB stream", func(t *testing.T) {
+		var event events.DynamoDBEvent
+		play(t, gp.InvokeLambda(target, nil).DynamoDBStreamEvent(gp.LogicalID("ResultStore"),
+			map[string]interface{}{"result_id": "r1", "count": 1},
+			map[string]interface{}{"result_id": "r1", "count": 2, "tags": []string{"a"}}), &event)
+
+		require.Equal(t, 1, len(event.Records))
+		record := event.Records[0]
+		assert.Equal(t, "MODIFY", record.EventName)
+		assert.Contains(t, record.EventSourceArn, arn("dynamodb", "table/"+probe.LookupID("ResultStore")+"/stream/"))
+		assert.Equal(t, 1, len(record.Change.Keys))
+		assert.Equal(t, "r1", record.Change.Keys["result_id"].String())
+		assert.Equal(t, "1", record.Change.OldImage["count"].Number())
+		assert.Equal(t, "2", record.Change.NewImage["count"].Number())
+		assert.Equal(t, "a", record.Change.NewImage["tags"].List()[0].String())
+
+		play(t, gp.InvokeLambda(target, nil).DynamoDBStreamEvent(gp.LogicalID("ResultStore"),
+			nil, map[string]string{"result_id": "r2"}), &event)
+		assert.Equal(t, "INSERT", event.Records[0].EventName)
+
+		err := probe.Play([]gp.Scene{gp.InvokeLambda(target, nil).DynamoDBStreamEvent(gp.LogicalID("ResultStore"),
+			nil, map[string]string{"id": "r3"})})
+		assert.Error(t, err)
+	})
+
+	t.Run("API Gateway", func(t *testing.T) {
+		var event events.APIGatewayProxyRequest
+		play(t, gp.InvokeLambda(target, nil).APIGatewayProxyEvent("post", "/users?id=1&id=2",
+			map[string]string{"name": "blue"}), &event)
+
+		assert.Equal(t, "POST", event.HTTPMethod)
+		assert.Equal(t, "/users", event.Path)
+		assert.Equal(t, "2", event.QueryStringParameters["id"])
+		assert.Equal(t, []string{"1", "2"}, event.MultiValueQueryStringParameters["id"])
+		assert.Equal(t, `{"name":"blue"}`, event.Body)
+		assert.Equal(t, fakeAccount, event.RequestContext.AccountID)
+		assert.NotEmpty(t, event.RequestContext.RequestID)
+	})
+
+	t.Run("API Gateway v2", func(t *testing.T) {
+		var event events.APIGatewayV2HTTPRequest
+		play(t, gp.InvokeLambda(target, nil).APIGatewayV2HTTPEvent("GET", "/users?id=1&id=2", nil), &event)
+
+		assert.Equal(t, "2.0", event.Version)
+		assert.Equal(t, "GET /users", event.RouteKey)
+		assert.Equal(t, "id=1&id=2", event.RawQueryString)
+		assert.Equal(t, "1,2", event.QueryStringParameters["id"])
+		assert.Equal(t, "GET", event.RequestContext.HTTP.Method)
+		assert.Empty(t, event.Body)
+	})
+
+	t.Run("CloudWatch Events", func(t *testing.T) {
+		var event events.CloudWatchEvent
+		play(t, gp.InvokeLambda(target, nil).CloudWatchScheduledEvent(gp.Arn(arn("events", "rule/nightly"))), &event)
+		assert.Equal(t, "aws.events", event.Source)
+		assert.Equal(t, "Scheduled Event", event.DetailType)
+		assert.Equal(t, []string{arn("events", "rule/nightly")}, event.Resources)
+
+		play(t, gp.InvokeLambda(target, nil).Template().EventBridgeEvent("my.app", "Order Created",
+			map[string]string{"id": "{{ runID }}"}), &event)
+		assert.Equal(t, "my.app", event.Source)
+		assert.Equal(t, "Order Created", event.DetailType)
+		assert.Equal(t, fakeAccount, event.AccountID)
+		assert.JSONEq(t, `{"id":"`+probe.RunID()+`"}`, string(event.Detail))
+	})
+
+	t.Run("Cognito", func(t *testing.T) {
+		var event gp.CognitoTriggerEvent
+		play(t, gp.InvokeLambda(target, nil).Template().CognitoTriggerEvent(
+			gp.Arn(arn("cognito-idp", "userpool/ap-northeast-1_abc")), "PreSignUp_SignUp", "blue",
+			map[string]string{"email": "{{ runID }}@example.com"}), &event)
+
+		assert.Equal(t, "PreSignUp_SignUp", event.TriggerSource)
+		assert.Equal(t, "ap-northeast-1_abc", event.UserPoolID)
+		assert.Equal(t, "blue", event.UserName)
+		assert.Equal(t, probe.RunID()+"@example.com", event.Request.UserAttributes["email"])
+	})
+}
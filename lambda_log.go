@@ -0,0 +1,246 @@
+package generalprobe
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// LambdaLogType is kind of a line of Lambda logs.
+type LambdaLogType string
+
+const (
+	// LambdaLogStart, LambdaLogEnd and LambdaLogReport are lines written
+	// by Lambda runtime for each invocation.
+	LambdaLogStart  LambdaLogType = "START"
+	LambdaLogEnd    LambdaLogType = "END"
+	LambdaLogReport LambdaLogType = "REPORT"
+	// LambdaLogMessage is output of the function.
+	LambdaLogMessage LambdaLogType = "MESSAGE"
+)
+
+// LambdaLogEvent is a parsed log event of Lambda function. Lines of
+// runtimes (e.g. "2018-01-01T00:00:00.000Z\t<request ID>\tINFO\tmessage" of
+// Node.js, "[INFO]\t<timestamp>\t<request ID>\tmessage" of Python) and JSON
+// logs are split into fields.
+type LambdaLogEvent struct {
+	Timestamp time.Time
+	LogStream string
+	// RequestID is request ID of the invocation that wrote the log. Logs
+	// without request ID (e.g. output of Go runtime) get it from START line
+	// of the same log stream when read by GetLambdaLogEvents.
+	RequestID string
+	Type      LambdaLogType
+	// Level is upper case log level such as "INFO" and "ERROR". It is
+	// empty if the log has no level.
+	Level string
+	// Message is the log message without prefix of runtime.
+	Message string
+	// JSON is decoded Message if Message is a JSON object.
+	JSON map[string]interface{}
+	// Report is parsed REPORT line. It is nil for other types.
+	Report *LambdaReport
+	// TimedOut is true for "Task timed out" line and REPORT line of
+	// timeout.
+	TimedOut bool
+	// Raw is the original log message.
+	Raw string
+}
+
+var lambdaLogLevels = map[string]bool{
+	"TRACE": true, "DEBUG": true, "INFO": true, "WARN": true, "WARNING": true,
+	"ERROR": true, "FATAL": true, "CRITICAL": true,
+}
+
+// IsError returns true if level of the log is ERROR, FATAL or CRITICAL, or
+// the invocation timed out.
+func (x *LambdaLogEvent) IsError() bool {
+	switch x.Level {
+	case "ERROR", "FATAL", "CRITICAL":
+		return true
+	}
+	return x.TimedOut
+}
+
+// Contains search string in the log message.
+func (x *LambdaLogEvent) Contains(key string) bool {
+	return strings.Contains(x.Message, key)
+}
+
+// Bind unmarshals JSON of the log message to data. It returns error if the
+// message is not valid JSON.
+func (x *LambdaLogEvent) Bind(data interface{}) error {
+	if err := json.Unmarshal([]byte(x.Message), data); err != nil {
+		return errors.Wrapf(err, "Fail to unmarshal Lambda log: %s", x.Message)
+	}
+	return nil
+}
+
+// ParseLambdaLog parses a message of Lambda logs. Timestamp and LogStream
+// are not set because they are not in the message.
+func ParseLambdaLog(message string) *LambdaLogEvent {
+	raw := strings.TrimRight(message, "\n")
+	ev := &LambdaLogEvent{Type: LambdaLogMessage, Message: raw, Raw: message}
+
+	switch {
+	case strings.HasPrefix(raw, "START RequestId: "):
+		ev.Type = LambdaLogStart
+		ev.RequestID = firstField(strings.TrimPrefix(raw, "START RequestId: "))
+		return ev
+
+	case strings.HasPrefix(raw, "END RequestId: "):
+		ev.Type = LambdaLogEnd
+		ev.RequestID = firstField(strings.TrimPrefix(raw, "END RequestId: "))
+		return ev
+
+	case IsReportLine(raw):
+		ev.Type = LambdaLogReport
+		ev.RequestID = firstField(strings.TrimPrefix(raw, "REPORT RequestId: "))
+		if report, err := ParseLambdaReport(raw); err == nil {
+			ev.Report = report
+		}
+		ev.TimedOut = strings.Contains(raw, "Status: timeout")
+		return ev
+	}
+
+	parseLambdaLogPrefix(ev, raw)
+	if strings.HasPrefix(ev.Message, "{") {
+		var body map[string]interface{}
+		if json.Unmarshal([]byte(ev.Message), &body) == nil {
+			ev.JSON = body
+			parseLambdaJSONLog(ev)
+		}
+	}
+	if strings.Contains(ev.Message, "Task timed out after") {
+		ev.TimedOut = true
+	}
+	return ev
+}
+
+// parseLambdaLogPrefix splits prefix of runtimes from raw.
+func parseLambdaLogPrefix(ev *LambdaLogEvent, raw string) {
+	// Python: [LEVEL]\t<timestamp>\t<request ID>\t<message>
+	if strings.HasPrefix(raw, "[") {
+		end := strings.Index(raw, "]")
+		if end < 0 || !lambdaLogLevels[strings.ToUpper(raw[1:end])] {
+			return
+		}
+		ev.Level = strings.ToUpper(raw[1:end])
+		rest := strings.TrimLeft(raw[end+1:], " ")
+		if fields := strings.SplitN(rest, "\t", 4); len(fields) == 4 && isLambdaLogTime(fields[1]) {
+			ev.RequestID, ev.Message = fields[2], fields[3]
+		} else {
+			ev.Message = strings.TrimLeft(rest, "\t")
+		}
+		return
+	}
+
+	// Node.js and so on: <timestamp>\t<request ID>\t<LEVEL>\t<message>
+	fields := strings.SplitN(raw, "\t", 4)
+	if len(fields) >= 3 && isLambdaLogTime(fields[0]) {
+		ev.RequestID = fields[1]
+		if len(fields) == 4 && lambdaLogLevels[fields[2]] {
+			ev.Level, ev.Message = fields[2], fields[3]
+		} else {
+			ev.Message = strings.Join(fields[2:], "\t")
+		}
+		return
+	}
+
+	// Lambda runtime: <timestamp> <request ID> Task timed out after 3.00 seconds
+	fields = strings.SplitN(raw, " ", 3)
+	if len(fields) == 3 && isLambdaLogTime(fields[0]) {
+		ev.RequestID, ev.Message = fields[1], fields[2]
+	}
+}
+
+// parseLambdaJSONLog sets fields of JSON log format of Lambda and common
+// logging libraries.
+func parseLambdaJSONLog(ev *LambdaLogEvent) {
+	lookup := func(keys ...string) string {
+		for _, key := range keys {
+			if v, ok := ev.JSON[key].(string); ok && v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	// System logs of Lambda in JSON format, e.g. {"type":"platform.report", ...}
+	if logType := lookup("type"); strings.HasPrefix(logType, "platform.") {
+		record, _ := ev.JSON["record"].(map[string]interface{})
+		if id, ok := record["requestId"].(string); ok {
+			ev.RequestID = id
+		}
+		switch logType {
+		case "platform.start":
+			ev.Type = LambdaLogStart
+		case "platform.report":
+			ev.Type = LambdaLogReport
+			ev.Report = parsePlatformReport(ev.RequestID, record)
+		}
+		if status, _ := record["status"].(string); status == "timeout" {
+			ev.TimedOut = true
+		}
+		return
+	}
+
+	if level := lookup("level", "levelname", "severity", "log_level"); level != "" {
+		ev.Level = strings.ToUpper(level)
+	}
+	if id := lookup("requestId", "request_id", "aws_request_id", "AWSRequestId"); id != "" {
+		ev.RequestID = id
+	}
+}
+
+func parsePlatformReport(requestID string, record map[string]interface{}) *LambdaReport {
+	metrics, _ := record["metrics"].(map[string]interface{})
+	ms := func(key string) time.Duration {
+		v, _ := metrics[key].(float64)
+		return time.Duration(v * float64(time.Millisecond))
+	}
+	mb := func(key string) int {
+		v, _ := metrics[key].(float64)
+		return int(v)
+	}
+	return &LambdaReport{
+		RequestID:      requestID,
+		Duration:       ms("durationMs"),
+		BilledDuration: ms("billedDurationMs"),
+		InitDuration:   ms("initDurationMs"),
+		MemorySize:     mb("memorySizeMB"),
+		MaxMemoryUsed:  mb("maxMemoryUsedMB"),
+	}
+}
+
+func isLambdaLogTime(s string) bool {
+	_, err := time.Parse(time.RFC3339Nano, s)
+	return err == nil
+}
+
+func firstField(s string) string {
+	if fields := strings.Fields(s); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
+
+// lambdaLogTracker fills request ID of logs that do not have it by START
+// and END lines of each log stream. Lambda runs one invocation at a time in
+// an execution environment that has its own log stream.
+type lambdaLogTracker map[string]string
+
+func (x lambdaLogTracker) track(ev *LambdaLogEvent) {
+	switch ev.Type {
+	case LambdaLogStart:
+		x[ev.LogStream] = ev.RequestID
+	case LambdaLogReport:
+		delete(x, ev.LogStream)
+	default:
+		if ev.RequestID == "" {
+			ev.RequestID = x[ev.LogStream]
+		}
+	}
+}
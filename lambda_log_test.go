@@ -0,0 +1,179 @@
+package generalprobe_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gp "github.com/m-mizutani/generalprobe"
+	"github.com/m-mizutani/generalprobe/fake"
+)
+
+func TestParseLambdaLog(t *testing.T) {
+	const id = "3f5e7d3c-1111-2222-3333-444455556666"
+
+	testCases := []struct {
+		title     string
+		message   string
+		logType   gp.LambdaLogType
+		requestID string
+		level     string
+		text      string
+		timedOut  bool
+	}{
+		{"start", "START RequestId: " + id + " Version: $LATEST\n", gp.LambdaLogStart, id, "", "", false},
+		{"end", "END RequestId: " + id + "\n", gp.LambdaLogEnd, id, "", "", false},
+		{"node", "2018-01-01T00:00:00.000Z\t" + id + "\tERROR\tfailed\n", gp.LambdaLogMessage, id, "ERROR", "failed", false},
+		{"python", "[WARNING]\t2018-01-01T00:00:00.000Z\t" + id + "\tslow\n", gp.LambdaLogMessage, id, "WARNING", "slow", false},
+		{"level prefix", "[INFO] hello", gp.LambdaLogMessage, "", "INFO", "hello", false},
+		{"plain", "hello [world]", gp.LambdaLogMessage, "", "", "hello [world]", false},
+		{"timeout", "2018-01-01T00:00:03.000Z " + id + " Task timed out after 3.00 seconds\n",
+			gp.LambdaLogMessage, id, "", "Task timed out after 3.00 seconds", true},
+		{"JSON", `{"level":"error","requestId":"` + id + `","message":"failed"}`,
+			gp.LambdaLogMessage, id, "ERROR", `{"level":"error","requestId":"` + id + `","message":"failed"}`, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			ev := gp.ParseLambdaLog(tc.message)
+			assert.Equal(t, tc.logType, ev.Type)
+			assert.Equal(t, tc.requestID, ev.RequestID)
+			assert.Equal(t, tc.level, ev.Level)
+			if tc.text != "" {
+				assert.Equal(t, tc.text, ev.Message)
+			}
+			assert.Equal(t, tc.timedOut, ev.TimedOut)
+			assert.Equal(t, tc.level == "ERROR" || tc.timedOut, ev.IsError())
+		})
+	}
+
+	t.Run("report", func(t *testing.T) {
+		ev := gp.ParseLambdaLog("REPORT RequestId: " + id + "\tDuration: 3000.00 ms\tBilled Duration: 3000 ms\t" +
+			"Memory Size: 128 MB\tMax Memory Used: 64 MB\tStatus: timeout\n")
+		assert.Equal(t, gp.LambdaLogReport, ev.Type)
+		require.NotNil(t, ev.Report)
+		assert.Equal(t, 3*time.Second, ev.Report.Duration)
+		assert.True(t, ev.TimedOut)
+	})
+
+	t.Run("platform report", func(t *testing.T) {
+		ev := gp.ParseLambdaLog(`{"time":"2018-01-01T00:00:00.000Z","type":"platform.report","record":{"requestId":"` +
+			id + `","metrics":{"durationMs":12.5,"billedDurationMs":13,"memorySizeMB":128,"maxMemoryUsedMB":64}}}`)
+		assert.Equal(t, gp.LambdaLogReport, ev.Type)
+		assert.Equal(t, id, ev.RequestID)
+		require.NotNil(t, ev.Report)
+		assert.Equal(t, 12500*time.Microsecond, ev.Report.Duration)
+		assert.Equal(t, 64, ev.Report.MaxMemoryUsed)
+	})
+
+	t.Run("bind", func(t *testing.T) {
+		ev := gp.ParseLambdaLog(`{"level":"info","message":"ok"}`)
+		assert.Equal(t, "ok", ev.JSON["message"])
+		var body struct {
+			Message string `json:"message"`
+		}
+		require.NoError(t, ev.Bind(&body))
+		assert.Equal(t, "ok", body.Message)
+	})
+}
+
+func TestGetLambdaLogEvents(t *testing.T) {
+	backend, probe := newFakeStack(t)
+	name := backend.AddFunction("Logger", func(ctx context.Context, payload []byte) ([]byte, error) {
+		fake.Logf(ctx, "[INFO] received %s", payload)
+		fake.Logf(ctx, `{"level":"debug","message":"done"}`)
+		return []byte(`{}`), nil
+	})
+	target := gp.Arn(fmt.Sprintf("arn:aws:lambda:%s:%s:function:%s", fakeRegion, fakeAccount, name))
+
+	var logs []*gp.LambdaLogEvent
+	require.NoError(t, probe.Play([]gp.Scene{
+		gp.InvokeLambda(target, nil).Event(map[string]string{"id": "x"}).CaptureRequestID("request_id"),
+		gp.GetLambdaLogEvents(target, func(ev *gp.LambdaLogEvent) (bool, error) {
+			requestID, _ := probe.Vars().Get("request_id")
+			if ev.RequestID != requestID {
+				return false, nil
+			}
+			if ev.IsError() {
+				return false, errors.New(ev.Message)
+			}
+			logs = append(logs, ev)
+			return ev.Type == gp.LambdaLogReport, nil
+		}),
+	}))
+
+	require.Equal(t, 5, len(logs))
+	assert.Equal(t, gp.LambdaLogStart, logs[0].Type)
+	assert.Equal(t, "INFO", logs[1].Level)
+	assert.Equal(t, `received {"id":"x"}`, logs[1].Message)
+	assert.Equal(t, "DEBUG", logs[2].Level)
+	assert.Equal(t, "done", logs[2].JSON["message"])
+	assert.Equal(t, gp.LambdaLogEnd, logs[3].Type)
+	require.NotNil(t, logs[4].Report)
+	assert.True(t, logs[4].Report.Duration < 500*time.Millisecond)
+	for _, ev := range logs {
+		assert.NotEmpty(t, ev.LogStream)
+		assert.False(t, ev.Timestamp.IsZero())
+	}
+}
+
+func TestGetLambdaLogEventsFilter(t *testing.T) {
+	backend, probe := newFakeStack(t)
+	name := backend.AddFunction("Logger", func(ctx context.Context, payload []byte) ([]byte, error) {
+		fake.Logf(ctx, "[INFO] other")
+		fake.Logf(ctx, "[INFO] received %s", payload)
+		return []byte(`{}`), nil
+	})
+	target := gp.Arn(fmt.Sprintf("arn:aws:lambda:%s:%s:function:%s", fakeRegion, fakeAccount, name))
+
+	// START line is not passed to callback but request ID is tracked by it.
+	var logs []*gp.LambdaLogEvent
+	require.NoError(t, probe.Play([]gp.Scene{
+		gp.InvokeLambda(target, nil).Event(map[string]string{"id": "x"}).CaptureRequestID("request_id"),
+		gp.GetLambdaLogEvents(target, func(ev *gp.LambdaLogEvent) (bool, error) {
+			logs = append(logs, ev)
+			return true, nil
+		}).Filter("received"),
+	}))
+
+	requestID, _ := probe.Vars().Get("request_id")
+	require.Equal(t, 1, len(logs))
+	assert.Equal(t, `received {"id":"x"}`, logs[0].Message)
+	assert.Equal(t, requestID, logs[0].RequestID)
+	assert.NotEmpty(t, logs[0].RequestID)
+}
+
+func TestGetLambdaLogsLateEvent(t *testing.T) {
+	backend, probe := newFakeStack(t)
+	backend.SetLogPageSize(2)
+	name := backend.AddFunction("Late", func(ctx context.Context, payload []byte) ([]byte, error) {
+		return []byte(`{}`), nil
+	})
+	target := gp.Arn(fmt.Sprintf("arn:aws:lambda:%s:%s:function:%s", fakeRegion, fakeAccount, name))
+	group := "/aws/lambda/" + name
+	for i := 0; i < 3; i++ {
+		backend.PutLog(group, "early", fmt.Sprintf("early %d", i))
+	}
+
+	// The log arrives after the first attempt and its timestamp is beyond
+	// one minute from start of the scene.
+	written := 0
+	var found []string
+	require.NoError(t, probe.Play([]gp.Scene{
+		gp.GetLambdaLogs(target, func(log gp.CloudWatchLog) bool {
+			found = append(found, string(log))
+			if log.Contains("early 2") {
+				written++
+				backend.PutLogAt(group, "late", "late message", time.Now().Add(2*time.Minute))
+			}
+			return log.Contains("late")
+		}).Wait(gp.WaitPolicy{Interval: time.Millisecond, MaxAttempts: 3}),
+	}))
+	assert.Equal(t, 1, written)
+	assert.Equal(t, []string{"early 0", "early 1", "early 2", "late message"}, found)
+}
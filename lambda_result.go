@@ -0,0 +1,161 @@
+package generalprobe
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/pkg/errors"
+)
+
+// InvokeLambdaResult is a result of invocation of Lambda function.
+type InvokeLambdaResult struct {
+	// RequestID is ID of the invocation that appears in logs of the
+	// function.
+	RequestID  string
+	Payload    []byte
+	StatusCode int
+	// FunctionError is "Handled" or "Unhandled" if the function returned
+	// error. It is empty if the invocation succeeded.
+	FunctionError   string
+	ExecutedVersion string
+	// LogTail is the last 4KB of logs of the invocation split into lines.
+	LogTail []string
+	// Report is parsed REPORT line in LogTail. It is nil if LogTail does
+	// not have the line.
+	Report *LambdaReport
+}
+
+// LambdaReport is parsed REPORT line of Lambda logs such as
+// "REPORT RequestId: ... Duration: 1.23 ms Billed Duration: 2 ms ...".
+type LambdaReport struct {
+	RequestID      string
+	Duration       time.Duration
+	BilledDuration time.Duration
+	// InitDuration is zero if the invocation is not cold start.
+	InitDuration time.Duration
+	// MemorySize and MaxMemoryUsed are in MB.
+	MemorySize    int
+	MaxMemoryUsed int
+}
+
+// IsReportLine returns true if line is REPORT line of Lambda logs.
+func IsReportLine(line string) bool {
+	return strings.HasPrefix(line, "REPORT RequestId:")
+}
+
+// ParseLambdaReport parses REPORT line of Lambda logs.
+func ParseLambdaReport(line string) (*LambdaReport, error) {
+	if !IsReportLine(line) {
+		return nil, fmt.Errorf("Not REPORT line of Lambda: %s", line)
+	}
+
+	report := &LambdaReport{}
+	for _, field := range strings.Split(strings.TrimPrefix(line, "REPORT "), "\t") {
+		kv := strings.SplitN(strings.TrimSpace(field), ": ", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key, value := kv[0], kv[1]
+
+		var err error
+		switch key {
+		case "RequestId":
+			report.RequestID = value
+		case "Duration":
+			report.Duration, err = parseReportDuration(value)
+		case "Billed Duration":
+			report.BilledDuration, err = parseReportDuration(value)
+		case "Init Duration":
+			report.InitDuration, err = parseReportDuration(value)
+		case "Memory Size":
+			report.MemorySize, err = strconv.Atoi(strings.TrimSuffix(value, " MB"))
+		case "Max Memory Used":
+			report.MaxMemoryUsed, err = strconv.Atoi(strings.TrimSuffix(value, " MB"))
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "Fail to parse %s of REPORT line: %s", key, line)
+		}
+	}
+
+	return report, nil
+}
+
+// parseReportDuration parses duration such as "1.23 ms".
+func parseReportDuration(value string) (time.Duration, error) {
+	ms, err := strconv.ParseFloat(strings.TrimSuffix(value, " ms"), 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(ms * float64(time.Millisecond)), nil
+}
+
+// newInvokeLambdaResult converts response of Invoke API.
+func newInvokeLambdaResult(resp *lambda.InvokeOutput) (*InvokeLambdaResult, error) {
+	result := &InvokeLambdaResult{
+		Payload:         resp.Payload,
+		StatusCode:      int(aws.Int64Value(resp.StatusCode)),
+		FunctionError:   aws.StringValue(resp.FunctionError),
+		ExecutedVersion: aws.StringValue(resp.ExecutedVersion),
+	}
+
+	if resp.LogResult != nil {
+		raw, err := base64.StdEncoding.DecodeString(*resp.LogResult)
+		if err != nil {
+			return nil, errors.Wrap(err, "Fail to decode LogResult of Lambda")
+		}
+		for _, line := range strings.Split(string(raw), "\n") {
+			if line == "" {
+				continue
+			}
+			result.LogTail = append(result.LogTail, line)
+			if IsReportLine(line) {
+				report, err := ParseLambdaReport(line)
+				if err != nil {
+					return nil, err
+				}
+				result.Report = report
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// LambdaFunctionError is returned by InvokeLambdaScene when the function
+// returned error. errors.Is(err, ErrLambdaFunctionError) is true for it.
+type LambdaFunctionError struct {
+	Result *InvokeLambdaResult
+	// ErrorType and ErrorMessage are from payload of the error.
+	ErrorType    string
+	ErrorMessage string
+}
+
+func newLambdaFunctionError(result *InvokeLambdaResult) *LambdaFunctionError {
+	err := &LambdaFunctionError{Result: result}
+	var payload struct {
+		ErrorType    string `json:"errorType"`
+		ErrorMessage string `json:"errorMessage"`
+	}
+	if json.Unmarshal(result.Payload, &payload) == nil {
+		err.ErrorType, err.ErrorMessage = payload.ErrorType, payload.ErrorMessage
+	}
+	return err
+}
+
+func (x *LambdaFunctionError) Error() string {
+	if x.ErrorMessage == "" && x.ErrorType == "" {
+		return fmt.Sprintf("Lambda function error (%s): %s", x.Result.FunctionError, string(x.Result.Payload))
+	}
+	return fmt.Sprintf("Lambda function error (%s): %s: %s", x.Result.FunctionError, x.ErrorType, x.ErrorMessage)
+}
+
+// Is returns true if target is ErrLambdaFunctionError.
+func (x *LambdaFunctionError) Is(target error) bool {
+	return target == ErrLambdaFunctionError
+}
@@ -0,0 +1,92 @@
+package generalprobe_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gp "github.com/m-mizutani/generalprobe"
+)
+
+func TestParseLambdaReport(t *testing.T) {
+	report, err := gp.ParseLambdaReport("REPORT RequestId: 3f5e7d3c-1111-2222-3333-444455556666\t" +
+		"Duration: 12.34 ms\tBilled Duration: 13 ms\tMemory Size: 128 MB\tMax Memory Used: 64 MB\t" +
+		"Init Duration: 150.50 ms\t")
+	require.NoError(t, err)
+	assert.Equal(t, "3f5e7d3c-1111-2222-3333-444455556666", report.RequestID)
+	assert.Equal(t, 12340*time.Microsecond, report.Duration)
+	assert.Equal(t, 13*time.Millisecond, report.BilledDuration)
+	assert.Equal(t, 150500*time.Microsecond, report.InitDuration)
+	assert.Equal(t, 128, report.MemorySize)
+	assert.Equal(t, 64, report.MaxMemoryUsed)
+
+	_, err = gp.ParseLambdaReport("START RequestId: x Version: $LATEST")
+	assert.Error(t, err)
+	_, err = gp.ParseLambdaReport("REPORT RequestId: x\tDuration: fast ms\t")
+	assert.Error(t, err)
+}
+
+func TestInvokeLambdaResult(t *testing.T) {
+	_, probe := newFakeStack(t)
+
+	var result *gp.InvokeLambdaResult
+	scene := gp.InvokeLambdaWithResult(gp.LogicalID("TestHandler"), func(r *gp.InvokeLambdaResult) error {
+		result = r
+		return nil
+	}).SnsEvent(map[string]string{"id": "r1"})
+	require.NoError(t, probe.Play([]gp.Scene{scene}))
+
+	require.NotNil(t, result)
+	assert.Equal(t, result, scene.Result())
+	assert.Equal(t, 200, result.StatusCode)
+	assert.Equal(t, "", result.FunctionError)
+	assert.Equal(t, "$LATEST", result.ExecutedVersion)
+	assert.Equal(t, `{"message":"ok"}`, string(result.Payload))
+	require.Equal(t, 4, len(result.LogTail))
+	assert.Contains(t, result.LogTail[1], `[INFO] {"id":"r1"}`)
+	require.NotNil(t, result.Report)
+	assert.True(t, result.Report.BilledDuration > 0)
+}
+
+func TestInvokeLambdaFunctionError(t *testing.T) {
+	t.Run("fail by default", func(t *testing.T) {
+		_, probe := newFakeStack(t)
+		called := false
+		err := probe.Play([]gp.Scene{
+			gp.InvokeLambda(gp.LogicalID("TestHandler"), func(response []byte) { called = true }).
+				SnsEvent("not JSON"),
+		})
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, gp.ErrLambdaFunctionError))
+		assert.False(t, called)
+
+		var funcErr *gp.LambdaFunctionError
+		require.True(t, errors.As(err, &funcErr))
+		assert.Equal(t, "Unhandled", funcErr.Result.FunctionError)
+		assert.Equal(t, "Error", funcErr.ErrorType)
+		assert.Contains(t, funcErr.ErrorMessage, "invalid character")
+	})
+
+	t.Run("expect error", func(t *testing.T) {
+		_, probe := newFakeStack(t)
+		require.NoError(t, probe.Play([]gp.Scene{
+			gp.InvokeLambda(gp.LogicalID("TestHandler"), nil).
+				SnsEvent("not JSON").
+				ExpectFunctionError().
+				Expect(gp.PathEquals("$.errorType", "Error")),
+		}))
+	})
+
+	t.Run("expect error but succeeded", func(t *testing.T) {
+		_, probe := newFakeStack(t)
+		err := probe.Play([]gp.Scene{
+			gp.InvokeLambda(gp.LogicalID("TestHandler"), nil).
+				SnsEvent(map[string]string{"id": "r1"}).
+				ExpectFunctionError(),
+		})
+		assert.True(t, errors.Is(err, gp.ErrUnexpectedResult))
+	})
+}
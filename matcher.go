@@ -0,0 +1,367 @@
+package generalprobe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// Matcher is an expectation of scene result such as Lambda response, Kinesis
+// record, log message and DynamoDB record (converted to JSON). Matchers can
+// be set to scenes by Expect.
+type Matcher interface {
+	// Match returns error (basically *MatchError) if data does not satisfy
+	// the expectation.
+	Match(data []byte) error
+}
+
+// MatcherFunc is an adapter to use a function as Matcher.
+type MatcherFunc func(data []byte) error
+
+// Match calls f(data).
+func (f MatcherFunc) Match(data []byte) error { return f(data) }
+
+// MatchError is returned by Matcher when data does not satisfy the
+// expectation. errors.Is(err, ErrUnexpectedResult) is true for the error.
+type MatchError struct {
+	// Matcher is text explanation of the matcher such as "$.status equals".
+	Matcher string
+	// Message is reason of the mismatch.
+	Message string
+	// Expected and Actual are compared values. They are shown as diff if
+	// both of them are not nil.
+	Expected interface{}
+	Actual   interface{}
+}
+
+func (x *MatchError) Error() string {
+	msg := fmt.Sprintf("%s: %s", x.Matcher, x.Message)
+	if diff := x.Diff(); diff != "" {
+		msg += "\n" + diff
+	}
+	return msg
+}
+
+// Is returns true if target is ErrUnexpectedResult.
+func (x *MatchError) Is(target error) bool {
+	return target == ErrUnexpectedResult
+}
+
+// Diff returns unified diff of indented JSON of Expected and Actual.
+func (x *MatchError) Diff() string {
+	if x.Expected == nil || x.Actual == nil {
+		return ""
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(indentJSON(x.Expected)),
+		B:        difflib.SplitLines(indentJSON(x.Actual)),
+		FromFile: "Expected",
+		ToFile:   "Actual",
+		Context:  3,
+	})
+	if err != nil {
+		return ""
+	}
+	return diff
+}
+
+func indentJSON(v interface{}) string {
+	raw, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("%v\n", v)
+	}
+	return string(raw) + "\n"
+}
+
+// matchAll returns the first error of matchers.
+func matchAll(matchers []Matcher, data []byte) error {
+	for _, matcher := range matchers {
+		if err := matcher.Match(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeResult decodes data as JSON for matchers.
+func decodeResult(name string, data []byte) (interface{}, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, &MatchError{Matcher: name, Message: fmt.Sprintf("result is not JSON: %s", string(data))}
+	}
+	return v, nil
+}
+
+// pathMatcher looks up path in JSON data and calls match with the value.
+func pathMatcher(path, op string, match func(name string, actual interface{}) error) Matcher {
+	name := path + " " + op
+	return MatcherFunc(func(data []byte) error {
+		doc, err := decodeResult(name, data)
+		if err != nil {
+			return err
+		}
+
+		actual, err := lookupJSONPath(doc, path)
+		if err != nil {
+			return &MatchError{Matcher: name, Message: err.Error()}
+		}
+		return match(name, actual)
+	})
+}
+
+// Contains expects that raw result contains substr.
+func Contains(substr string) Matcher {
+	return MatcherFunc(func(data []byte) error {
+		if !strings.Contains(string(data), substr) {
+			return &MatchError{
+				Matcher: "contains",
+				Message: fmt.Sprintf("'%s' is not contained in %s", substr, string(data)),
+			}
+		}
+		return nil
+	})
+}
+
+// PathEquals expects that value at JSONPath of the result equals expected.
+// expected is compared after conversion to JSON, so 1 (int) equals 1.0.
+func PathEquals(path string, expected interface{}) Matcher {
+	return pathMatcher(path, "equals", func(name string, actual interface{}) error {
+		normalized, err := normalizeJSON(expected)
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(normalized, actual) {
+			return &MatchError{Matcher: name, Message: "not equal", Expected: normalized, Actual: actual}
+		}
+		return nil
+	})
+}
+
+// PathContains expects that value at JSONPath contains expected. A string
+// value must contain expected as substring, and an array must have an
+// element that matches expected as PartialJSON.
+func PathContains(path string, expected interface{}) Matcher {
+	return pathMatcher(path, "contains", func(name string, actual interface{}) error {
+		switch v := actual.(type) {
+		case string:
+			if s, ok := expected.(string); ok && strings.Contains(v, s) {
+				return nil
+			}
+
+		case []interface{}:
+			normalized, err := normalizeJSON(expected)
+			if err != nil {
+				return err
+			}
+			for _, elem := range v {
+				if matchSubset(normalized, elem) {
+					return nil
+				}
+			}
+		}
+
+		return &MatchError{
+			Matcher: name,
+			Message: fmt.Sprintf("%v is not contained in %s", expected, indentJSON(actual)),
+		}
+	})
+}
+
+// PathMatches expects that value at JSONPath matches regular expression
+// pattern. A non-string value is converted to JSON text.
+func PathMatches(path, pattern string) Matcher {
+	ptn, err := regexp.Compile(pattern)
+	if err != nil {
+		// Matcher can not return error, so the error is reported by Match.
+		err = errors.Wrapf(err, "Invalid pattern of %s matches", path)
+		return MatcherFunc(func(data []byte) error { return err })
+	}
+
+	return pathMatcher(path, "matches", func(name string, actual interface{}) error {
+		text, ok := actual.(string)
+		if !ok {
+			raw, _ := json.Marshal(actual)
+			text = string(raw)
+		}
+		if !ptn.MatchString(text) {
+			return &MatchError{
+				Matcher: name,
+				Message: fmt.Sprintf("'%s' does not match /%s/", text, pattern),
+			}
+		}
+		return nil
+	})
+}
+
+// PathExists expects that JSONPath exists in the result. null value is
+// regarded as existing.
+func PathExists(path string) Matcher {
+	return pathMatcher(path, "exists", func(name string, actual interface{}) error {
+		return nil
+	})
+}
+
+// PathInRange expects that value at JSONPath is number between min and max
+// (inclusive).
+func PathInRange(path string, min, max float64) Matcher {
+	op := fmt.Sprintf("in range [%v, %v]", min, max)
+	return pathMatcher(path, op, func(name string, actual interface{}) error {
+		n, ok := actual.(float64)
+		if !ok {
+			return &MatchError{Matcher: name, Message: fmt.Sprintf("%v is not a number", actual)}
+		}
+		if n < min || max < n {
+			return &MatchError{Matcher: name, Message: fmt.Sprintf("%v is out of range", n)}
+		}
+		return nil
+	})
+}
+
+// PartialJSON expects that the result has all fields of expected. Fields
+// not in expected are ignored, and arrays must have same length. Diff of
+// mismatch shows only fields in expected.
+func PartialJSON(expected interface{}) Matcher {
+	return MatcherFunc(func(data []byte) error {
+		const name = "partial JSON"
+		normalized, err := normalizeJSON(expected)
+		if err != nil {
+			return err
+		}
+		actual, err := decodeResult(name, data)
+		if err != nil {
+			return err
+		}
+
+		if !matchSubset(normalized, actual) {
+			return &MatchError{
+				Matcher:  name,
+				Message:  "result does not match expected JSON",
+				Expected: normalized,
+				Actual:   projectSubset(normalized, actual),
+			}
+		}
+		return nil
+	})
+}
+
+// projectSubset returns actual that has only fields in expected.
+func projectSubset(expected, actual interface{}) interface{} {
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			return actual
+		}
+		projected := map[string]interface{}{}
+		for key, ev := range e {
+			if av, ok := a[key]; ok {
+				projected[key] = projectSubset(ev, av)
+			}
+		}
+		return projected
+
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok {
+			return actual
+		}
+		projected := make([]interface{}, len(a))
+		for i := range a {
+			if i < len(e) {
+				projected[i] = projectSubset(e[i], a[i])
+			} else {
+				projected[i] = a[i]
+			}
+		}
+		return projected
+	}
+
+	return actual
+}
+
+// JSONSchema expects that the result is valid for JSON Schema. schema can
+// be JSON text (string or []byte) or structured data.
+func JSONSchema(schema interface{}) Matcher {
+	var loader gojsonschema.JSONLoader
+	switch s := schema.(type) {
+	case string:
+		loader = gojsonschema.NewStringLoader(s)
+	case []byte:
+		loader = gojsonschema.NewBytesLoader(s)
+	default:
+		loader = gojsonschema.NewGoLoader(s)
+	}
+
+	compiled, err := gojsonschema.NewSchema(loader)
+	if err != nil {
+		// Matcher can not return error, so the error is reported by Match.
+		err = errors.Wrap(err, "Fail to load JSON schema")
+		return MatcherFunc(func(data []byte) error { return err })
+	}
+
+	return MatcherFunc(func(data []byte) error {
+		const name = "JSON schema"
+		if _, err := decodeResult(name, data); err != nil {
+			return err
+		}
+		result, err := compiled.Validate(gojsonschema.NewBytesLoader(data))
+		if err != nil {
+			return errors.Wrap(err, "Fail to validate result by JSON schema")
+		}
+
+		if !result.Valid() {
+			var msgs []string
+			for _, e := range result.Errors() {
+				msgs = append(msgs, e.String())
+			}
+			return &MatchError{Matcher: name, Message: strings.Join(msgs, "; ")}
+		}
+		return nil
+	})
+}
+
+// expectation is checks of scene result. check is set by declarative
+// playbook and matchers are set by Expect.
+type expectation struct {
+	check    func(ctx context.Context, data []byte) error
+	matchers []Matcher
+}
+
+func (x *expectation) expect(matchers []Matcher) {
+	x.matchers = append(x.matchers, matchers...)
+}
+
+func (x *expectation) expected() bool {
+	return x.check != nil || len(x.matchers) > 0
+}
+
+// verify returns nil if data satisfies check and all matchers.
+func (x *expectation) verify(ctx context.Context, data []byte) error {
+	if x.check != nil {
+		if err := x.check(ctx, data); err != nil {
+			return err
+		}
+	}
+	return matchAll(x.matchers, data)
+}
+
+// isMismatch returns true if err is *MatchError. Polling scenes retry only
+// for mismatch, and other errors of verify (e.g. invalid pattern and failure
+// of template rendering) stop the polling.
+func isMismatch(err error) bool {
+	var matchErr *MatchError
+	return errors.As(err, &matchErr)
+}
+
+// describeMismatch returns text of the last result for PollingTimeoutError.
+func describeMismatch(data []byte, err error) string {
+	return fmt.Sprintf("%s (%v)", string(data), err)
+}
@@ -0,0 +1,172 @@
+package generalprobe_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/guregu/dynamo"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gp "github.com/m-mizutani/generalprobe"
+)
+
+func TestMatchers(t *testing.T) {
+	data := []byte(`{"id":"abc-123","status":"done","count":3,"tags":["a","b"],
+		"items":[{"name":"x","size":1},{"name":"y","size":2}],"detail":{"user":"blue","level":1}}`)
+
+	testCases := []struct {
+		title   string
+		matcher gp.Matcher
+		match   bool
+	}{
+		{"contains", gp.Contains(`"status":"done"`), true},
+		{"not contains", gp.Contains("failed"), false},
+		{"equals string", gp.PathEquals("$.status", "done"), true},
+		{"equals number", gp.PathEquals("$.count", 3), true},
+		{"equals object", gp.PathEquals("$.detail", map[string]interface{}{"user": "blue", "level": 1}), true},
+		{"not equals", gp.PathEquals("$.status", "running"), false},
+		{"equals missing path", gp.PathEquals("$.nothing", "x"), false},
+		{"contains substring", gp.PathContains("$.id", "123"), true},
+		{"contains element", gp.PathContains("$.tags", "b"), true},
+		{"contains partial element", gp.PathContains("$.items", map[string]interface{}{"name": "y"}), true},
+		{"not contains element", gp.PathContains("$.tags", "c"), false},
+		{"matches", gp.PathMatches("$.id", `^[a-z]+-\d+$`), true},
+		{"matches number", gp.PathMatches("$.count", `^\d$`), true},
+		{"not matches", gp.PathMatches("$.id", `^\d+$`), false},
+		{"exists", gp.PathExists("$.items[1].size"), true},
+		{"not exists", gp.PathExists("$.items[2]"), false},
+		{"in range", gp.PathInRange("$.count", 1, 3), true},
+		{"out of range", gp.PathInRange("$.count", 4, 10), false},
+		{"range of string", gp.PathInRange("$.status", 0, 1), false},
+		{"partial", gp.PartialJSON(map[string]interface{}{"status": "done", "detail": map[string]interface{}{"user": "blue"}}), true},
+		{"partial mismatch", gp.PartialJSON(map[string]interface{}{"detail": map[string]interface{}{"user": "red"}}), false},
+		{"schema", gp.JSONSchema(`{"type":"object","required":["id","count"],"properties":{"count":{"type":"integer"}}}`), true},
+		{"schema violation", gp.JSONSchema(map[string]interface{}{"type": "object", "required": []string{"nothing"}}), false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.title, func(t *testing.T) {
+			err := tc.matcher.Match(data)
+			if tc.match {
+				assert.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.True(t, errors.Is(err, gp.ErrUnexpectedResult), err.Error())
+			}
+		})
+	}
+
+	t.Run("not JSON", func(t *testing.T) {
+		err := gp.PathExists("$.id").Match([]byte("plain text"))
+		assert.True(t, errors.Is(err, gp.ErrUnexpectedResult))
+		err = gp.JSONSchema(`{"type":"object"}`).Match([]byte("plain text"))
+		assert.True(t, errors.Is(err, gp.ErrUnexpectedResult))
+	})
+
+	t.Run("invalid matcher", func(t *testing.T) {
+		// Errors of matchers themselves are not mismatch.
+		err := gp.PathMatches("$.nothing", `(`).Match(data)
+		require.Error(t, err)
+		assert.False(t, errors.Is(err, gp.ErrUnexpectedResult))
+		assert.Contains(t, err.Error(), "Invalid pattern of $.nothing matches")
+
+		err = gp.JSONSchema(`{"type":"no-such-type"}`).Match(data)
+		require.Error(t, err)
+		assert.False(t, errors.Is(err, gp.ErrUnexpectedResult))
+		assert.Contains(t, err.Error(), "Fail to load JSON schema")
+	})
+}
+
+func TestMatchErrorDiff(t *testing.T) {
+	err := gp.PartialJSON(map[string]interface{}{
+		"status": "done",
+		"detail": map[string]interface{}{"user": "red"},
+	}).Match([]byte(`{"status":"done","detail":{"user":"blue","level":1},"other":true}`))
+
+	var matchErr *gp.MatchError
+	require.True(t, errors.As(err, &matchErr))
+	diff := matchErr.Diff()
+	assert.Contains(t, diff, `-    "user": "red"`)
+	assert.Contains(t, diff, `+    "user": "blue"`)
+	// Fields not in expected are not shown.
+	assert.NotContains(t, diff, "level")
+	assert.NotContains(t, diff, "other")
+	assert.Contains(t, err.Error(), diff)
+}
+
+func TestExpect(t *testing.T) {
+	backend, probe := newFakeStack(t)
+	group := "/aws/lambda/" + probe.LookupID("TestHandler")
+	backend.PutLog(group, "stream", `{"level":"info","count":5}`)
+
+	require.NoError(t, probe.Play([]gp.Scene{
+		gp.InvokeLambda(gp.LogicalID("TestHandler"), nil).
+			SnsEvent(map[string]string{"id": probe.RunID()}).
+			Expect(gp.PathEquals("$.message", "ok")),
+		gp.GetDynamoRecord(gp.LogicalID("ResultStore"), nil).
+			Key("result_id", "{{ runID }}").
+			Expect(gp.PathExists("$.report"), gp.PathContains("$.report", probe.RunID())),
+		gp.PutKinesisStreamRecord(gp.LogicalID("ResultStream"), []byte(`{"seq":1}`)),
+		gp.PutKinesisStreamRecord(gp.LogicalID("ResultStream"), []byte(`{"seq":2}`)),
+		gp.GetKinesisStreamRecord(gp.LogicalID("ResultStream"), nil).
+			Expect(gp.PathEquals("$.seq", 2)),
+		gp.GetLambdaLogs(gp.LogicalID("TestHandler"), nil).
+			Expect(gp.PathInRange("$.count", 1, 10)),
+	}))
+}
+
+func TestExpectFailure(t *testing.T) {
+	t.Run("lambda response", func(t *testing.T) {
+		_, probe := newFakeStack(t)
+		err := probe.Play([]gp.Scene{
+			gp.InvokeLambda(gp.LogicalID("TestHandler"), nil).
+				SnsEvent(map[string]string{"id": "x"}).
+				Expect(gp.PathEquals("$.message", "ng")),
+		})
+		assert.True(t, errors.Is(err, gp.ErrUnexpectedResult))
+		assert.Contains(t, err.Error(), `+"ok"`)
+	})
+
+	t.Run("dynamodb record", func(t *testing.T) {
+		backend, probe := newFakeStack(t)
+		require.NoError(t, backend.PutItem(probe.LookupID("ResultStore"), map[string]interface{}{
+			"result_id": "r1", "status": "running",
+		}))
+
+		err := probe.Play([]gp.Scene{
+			gp.GetDynamoRecord(gp.LogicalID("ResultStore"), nil).
+				Key("result_id", "r1").
+				Expect(gp.PartialJSON(map[string]string{"status": "done"})).
+				Wait(gp.WaitPolicy{Interval: time.Millisecond, MaxAttempts: 2}),
+		})
+
+		var timeoutErr *gp.PollingTimeoutError
+		require.True(t, errors.As(err, &timeoutErr))
+		assert.Contains(t, timeoutErr.LastResult, `-  "status": "done"`)
+		assert.Contains(t, timeoutErr.LastResult, `+  "status": "running"`)
+	})
+
+	t.Run("invalid matcher is not retried", func(t *testing.T) {
+		_, probe := newFakeStack(t)
+		err := probe.Play([]gp.Scene{
+			gp.PutKinesisStreamRecord(gp.LogicalID("ResultStream"), []byte(`{"seq":1}`)),
+			gp.GetKinesisStreamRecord(gp.LogicalID("ResultStream"), nil).
+				Expect(gp.PathMatches("$.seq", `[`)),
+		})
+		require.Error(t, err)
+		assert.False(t, errors.Is(err, gp.ErrPollingTimeout))
+		assert.Contains(t, err.Error(), "Invalid pattern of $.seq matches")
+		assert.Equal(t, 1, probe.LastReport().Scenes[1].Attempts)
+	})
+
+	t.Run("expect with callback", func(t *testing.T) {
+		_, probe := newFakeStack(t)
+		err := probe.Play([]gp.Scene{
+			gp.GetDynamoRecord(gp.LogicalID("ResultStore"), func(table dynamo.Table) bool { return true }).
+				Expect(gp.PathExists("$.id")),
+		})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,104 @@
+package generalprobe
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ParallelScene has scenes played concurrently.
+type ParallelScene struct {
+	scenes   []Scene
+	failFast bool
+	baseScene
+}
+
+// Parallel creates a scene that plays scenes concurrently and waits for
+// all of them. Errors of the scenes are aggregated into *ParallelError.
+// Scenes in Parallel must not depend on each other, e.g. a scene can not
+// refer a variable captured by another scene in the same Parallel.
+func Parallel(scenes ...Scene) *ParallelScene {
+	return &ParallelScene{scenes: scenes}
+}
+
+// FailFast makes the scene interrupt other scenes and return immediately
+// when one of the scenes fails.
+func (x *ParallelScene) FailFast() *ParallelScene {
+	x.failFast = true
+	return x
+}
+
+// String returns text explanation of the scene
+func (x *ParallelScene) string() string {
+	return fmt.Sprintf("Parallel (%d scenes)", len(x.scenes))
+}
+
+func (x *ParallelScene) play(ctx context.Context) error {
+	childCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	total := len(x.scenes)
+	errs := make([]error, total)
+
+	var wg sync.WaitGroup
+	for idx, scene := range x.scenes {
+		wg.Add(1)
+		go func(idx int, scene Scene) {
+			defer wg.Done()
+
+			err := x.playChild(childCtx, []int{idx}, scene)
+			if err == nil {
+				return
+			}
+			if childCtx.Err() != nil && ctx.Err() == nil {
+				// Interrupted by FailFast because another scene failed.
+				return
+			}
+
+			errs[idx] = err
+			if x.failFast {
+				cancel()
+			}
+		}(idx, scene)
+	}
+	wg.Wait()
+
+	parallelErr := &ParallelError{Total: total}
+	for _, err := range errs {
+		if err != nil {
+			parallelErr.Errors = append(parallelErr.Errors, err)
+		}
+	}
+	if len(parallelErr.Errors) > 0 {
+		return parallelErr
+	}
+	return nil
+}
+
+// ParallelError is returned by Parallel scene. Errors are *SceneError of
+// failed scenes and Step of them is index in the Parallel.
+type ParallelError struct {
+	Total  int
+	Errors []error
+}
+
+func (x *ParallelError) Error() string {
+	var msgs []string
+	for _, err := range x.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d of %d parallel scenes failed: %s", len(x.Errors), x.Total,
+		strings.Join(msgs, "; "))
+}
+
+// Unwrap returns errors of failed scenes for errors.Is and errors.As.
+func (x *ParallelError) Unwrap() []error {
+	return x.Errors
+}
+
+// Is returns true if an error of failed scenes matches target.
+func (x *ParallelError) Is(target error) bool { return isAny(x.Errors, target) }
+
+// As finds the first error that matches target in errors of failed scenes.
+func (x *ParallelError) As(target interface{}) bool { return asAny(x.Errors, target) }
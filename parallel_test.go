@@ -0,0 +1,89 @@
+package generalprobe_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gp "github.com/m-mizutani/generalprobe"
+)
+
+func TestParallel(t *testing.T) {
+	_, probe := newFakeStack(t)
+
+	playbook, err := gp.LoadPlaybook(writePlaybook(t, `
+scenes:
+  - type: publish_sns
+    target: { logical_id: Trigger }
+    message: { id: "{{ runID }}" }
+  - type: put_kinesis
+    target: { logical_id: ResultStream }
+    message: "{{ runID }}"
+  - type: parallel
+    scenes:
+      - type: get_dynamo_record
+        target: { logical_id: ResultStore }
+        hash_key: { name: result_id, value: "{{ runID }}" }
+      - type: get_kinesis_record
+        target: { logical_id: ResultStream }
+        expect: { contains: "{{ runID }}" }
+      - type: get_lambda_logs
+        target: { logical_id: TestHandler }
+        filter: "{{ runID }}"
+`))
+	require.NoError(t, err)
+	require.NoError(t, probe.Play(playbook))
+}
+
+func TestParallelErrors(t *testing.T) {
+	_, probe := newFakeStack(t)
+
+	var n int32
+	err := probe.Play([]gp.Scene{
+		gp.Parallel(
+			gp.PutKinesisStreamRecord(gp.LogicalID("NoSuchStream"), []byte("x")),
+			gp.AdLib(func() { atomic.AddInt32(&n, 1) }),
+			gp.PublishSnsMessage(gp.Arn("invalid-arn"), []byte("x")),
+		),
+	})
+
+	var parallelErr *gp.ParallelError
+	require.True(t, errors.As(err, &parallelErr))
+	assert.Equal(t, 3, parallelErr.Total)
+	require.Equal(t, 2, len(parallelErr.Errors))
+	assert.True(t, errors.Is(err, gp.ErrResourceNotFound))
+	assert.True(t, errors.Is(err, gp.ErrInvalidArn))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&n))
+
+	var sceneErr *gp.SceneError
+	require.True(t, errors.As(parallelErr.Errors[1], &sceneErr))
+	assert.Equal(t, 3, sceneErr.Step)
+
+	// Is and As do not depend on Unwrap() []error that requires Go 1.20.
+	assert.True(t, parallelErr.Is(gp.ErrInvalidArn))
+	assert.False(t, parallelErr.Is(gp.ErrPollingTimeout))
+	require.True(t, parallelErr.As(&sceneErr))
+	assert.Equal(t, 1, sceneErr.Step)
+}
+
+func TestParallelFailFast(t *testing.T) {
+	_, probe := newFakeStack(t)
+
+	start := time.Now()
+	err := probe.Play([]gp.Scene{
+		gp.Parallel(
+			gp.Pause(10),
+			gp.PutKinesisStreamRecord(gp.LogicalID("NoSuchStream"), []byte("x")),
+		).FailFast(),
+	})
+
+	var parallelErr *gp.ParallelError
+	require.True(t, errors.As(err, &parallelErr))
+	assert.Equal(t, 1, len(parallelErr.Errors))
+	assert.True(t, errors.Is(err, gp.ErrResourceNotFound))
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
@@ -1,6 +1,7 @@
 package generalprobe
 
 import (
+	"context"
 	"fmt"
 	"time"
 )
@@ -24,7 +25,6 @@ func (x *PauseScene) string() string {
 	return fmt.Sprintf("Pausing %d seconds", x.interval)
 }
 
-func (x *PauseScene) play() error {
-	time.Sleep(time.Second * time.Duration(x.interval))
-	return nil
+func (x *PauseScene) play(ctx context.Context) error {
+	return sleep(ctx, time.Second*time.Duration(x.interval))
 }
@@ -1 +1,808 @@
 package generalprobe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// playbookFile is root structure of declarative playbook written in YAML or JSON.
+//
+//	scenes:
+//	  - type: publish_sns
+//	    target: { logical_id: Trigger }
+//	    message: { id: "abc" }
+//	  - type: get_dynamo_record
+//	    target: { logical_id: ResultStore }
+//	    hash_key: { name: result_id, value: "abc" }
+//	    expect:
+//	      json: { result_id: "abc" }
+//	teardown:
+//	  - type: delete_dynamo_record
+//	    target: { logical_id: ResultStore }
+//	    hash_key: { name: result_id, value: "abc" }
+type playbookFile struct {
+	Scenes   []*sceneSpec `yaml:"scenes" json:"scenes"`
+	Teardown []*sceneSpec `yaml:"teardown" json:"teardown"`
+}
+
+type sceneSpec struct {
+	Type   string      `yaml:"type" json:"type"`
+	Target *targetSpec `yaml:"target" json:"target"`
+
+	// invoke_lambda
+	Event               interface{}            `yaml:"event" json:"event"`
+	SnsEvent            interface{}            `yaml:"sns_event" json:"sns_event"`
+	ExpectFunctionError bool                   `yaml:"expect_function_error" json:"expect_function_error"`
+	Async               bool                   `yaml:"async" json:"async"`
+	DryRun              bool                   `yaml:"dry_run" json:"dry_run"`
+	Qualifier           string                 `yaml:"qualifier" json:"qualifier"`
+	ClientContext       map[string]interface{} `yaml:"client_context" json:"client_context"`
+	CaptureRequestID    string                 `yaml:"capture_request_id" json:"capture_request_id"`
+
+	// publish_sns, put_kinesis
+	Message    interface{}       `yaml:"message" json:"message"`
+	Attributes map[string]string `yaml:"attributes" json:"attributes"`
+
+	// get_dynamo_record, delete_dynamo_record
+	HashKey  *keySpec `yaml:"hash_key" json:"hash_key"`
+	RangeKey *keySpec `yaml:"range_key" json:"range_key"`
+
+	// get_lambda_logs
+	Filter string `yaml:"filter" json:"filter"`
+
+	// query_logs_insights
+	Targets []*targetSpec `yaml:"targets" json:"targets"`
+	Query   string        `yaml:"query" json:"query"`
+
+	// delete_s3_objects
+	Prefix string `yaml:"prefix" json:"prefix"`
+
+	// polling scenes
+	Limit    int       `yaml:"limit" json:"limit"`
+	Interval int       `yaml:"interval" json:"interval"`
+	Wait     *waitSpec `yaml:"wait" json:"wait"`
+
+	// pause
+	Seconds int `yaml:"seconds" json:"seconds"`
+
+	// parallel, sequence, repeat
+	Scenes   []*sceneSpec `yaml:"scenes" json:"scenes"`
+	FailFast bool         `yaml:"fail_fast" json:"fail_fast"`
+	Name     string       `yaml:"name" json:"name"`
+	Count    int          `yaml:"count" json:"count"`
+
+	// if
+	Condition string       `yaml:"condition" json:"condition"`
+	Then      []*sceneSpec `yaml:"then" json:"then"`
+	Else      []*sceneSpec `yaml:"else" json:"else"`
+
+	// invoke_lambda, publish_sns, put_kinesis
+	CaptureAs   string            `yaml:"capture_as" json:"capture_as"`
+	CaptureJSON map[string]string `yaml:"capture_json" json:"capture_json"`
+
+	Expect *expectSpec `yaml:"expect" json:"expect"`
+}
+
+type targetSpec struct {
+	LogicalID string `yaml:"logical_id" json:"logical_id"`
+	Arn       string `yaml:"arn" json:"arn"`
+}
+
+// waitSpec is WaitPolicy of a polling scene. Durations are written in
+// format of time.ParseDuration such as "500ms" and "1m".
+type waitSpec struct {
+	InitialDelay string  `yaml:"initial_delay" json:"initial_delay"`
+	Interval     string  `yaml:"interval" json:"interval"`
+	Multiplier   float64 `yaml:"multiplier" json:"multiplier"`
+	MaxInterval  string  `yaml:"max_interval" json:"max_interval"`
+	Jitter       float64 `yaml:"jitter" json:"jitter"`
+	MaxAttempts  int     `yaml:"max_attempts" json:"max_attempts"`
+	Timeout      string  `yaml:"timeout" json:"timeout"`
+}
+
+func (x *waitSpec) toWaitPolicy() (WaitPolicy, error) {
+	policy := WaitPolicy{
+		Multiplier:  x.Multiplier,
+		Jitter:      x.Jitter,
+		MaxAttempts: x.MaxAttempts,
+	}
+
+	durations := []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{"initial_delay", x.InitialDelay, &policy.InitialDelay},
+		{"interval", x.Interval, &policy.Interval},
+		{"max_interval", x.MaxInterval, &policy.MaxInterval},
+		{"timeout", x.Timeout, &policy.Timeout},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil {
+			return policy, errors.Wrapf(err, "Invalid %s of wait", d.name)
+		}
+		*d.dst = v
+	}
+
+	return policy, nil
+}
+
+type keySpec struct {
+	Name  string      `yaml:"name" json:"name"`
+	Value interface{} `yaml:"value" json:"value"`
+}
+
+// expectSpec is expectation of scene result. Contains checks substring of
+// raw result, JSON checks that the result has all fields of JSON, Path has
+// matchers of JSONPath and Schema is JSON Schema of the result.
+type expectSpec struct {
+	Contains string      `yaml:"contains" json:"contains"`
+	JSON     interface{} `yaml:"json" json:"json"`
+	Path     []*pathSpec `yaml:"path" json:"path"`
+	Schema   interface{} `yaml:"schema" json:"schema"`
+}
+
+// pathSpec is a matcher of value at JSONPath. One of Equals, Contains,
+// Regex, Min/Max and Exists should be specified.
+type pathSpec struct {
+	Path     string      `yaml:"path" json:"path"`
+	Equals   interface{} `yaml:"equals" json:"equals"`
+	Contains interface{} `yaml:"contains" json:"contains"`
+	Regex    string      `yaml:"regex" json:"regex"`
+	Min      *float64    `yaml:"min" json:"min"`
+	Max      *float64    `yaml:"max" json:"max"`
+	Exists   bool        `yaml:"exists" json:"exists"`
+}
+
+// LoadPlaybook reads declarative playbook from YAML (.yml, .yaml) or
+// JSON (.json) file and converts it to scenes.
+func LoadPlaybook(path string) ([]Scene, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Fail to read playbook %s", path)
+	}
+
+	// Unknown fields are rejected because a typo of field (e.g. "expects")
+	// silently removes the check.
+	var file rawPlaybookFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&file)
+	case ".yml", ".yaml":
+		dec := yaml.NewDecoder(bytes.NewReader(raw))
+		dec.KnownFields(true)
+		if err = dec.Decode(&file); err == io.EOF {
+			err = nil
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported playbook format: %s", path)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Fail to parse playbook %s", path)
+	}
+
+	playbook, err := file.decode()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Fail to parse playbook %s", path)
+	}
+	return playbook.toScenes()
+}
+
+// rawPlaybookFile is playbookFile whose scenes are not decoded yet, so that
+// error of a scene can be reported with index of the scene.
+type rawPlaybookFile struct {
+	Scenes   []*rawSceneSpec `yaml:"scenes" json:"scenes"`
+	Teardown []*rawSceneSpec `yaml:"teardown" json:"teardown"`
+}
+
+func (x *rawPlaybookFile) decode() (*playbookFile, error) {
+	scenes, err := decodeSceneSpecs(x.Scenes)
+	if err != nil {
+		return nil, err
+	}
+	teardown, err := decodeSceneSpecs(x.Teardown)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid teardown")
+	}
+	return &playbookFile{Scenes: scenes, Teardown: teardown}, nil
+}
+
+func decodeSceneSpecs(raws []*rawSceneSpec) ([]*sceneSpec, error) {
+	var specs []*sceneSpec
+	for idx, raw := range raws {
+		var spec sceneSpec
+		if raw == nil || raw.decode == nil {
+			return nil, fmt.Errorf("Invalid scene #%d: scene is empty", idx+1)
+		}
+		if err := raw.decode(&spec); err != nil {
+			return nil, errors.Wrapf(err, "Invalid scene #%d", idx+1)
+		}
+		specs = append(specs, &spec)
+	}
+	return specs, nil
+}
+
+// rawSceneSpec keeps a scene of YAML or JSON and decodes it into sceneSpec
+// without unknown fields.
+type rawSceneSpec struct {
+	decode func(v interface{}) error
+}
+
+func (x *rawSceneSpec) UnmarshalYAML(node *yaml.Node) error {
+	// yaml.Node.Decode can not reject unknown fields, so the node is
+	// encoded again. Aliases are resolved because their anchors may be
+	// out of the node.
+	raw, err := yaml.Marshal(resolveYAMLAliases(node))
+	if err != nil {
+		return err
+	}
+	x.decode = func(v interface{}) error {
+		dec := yaml.NewDecoder(bytes.NewReader(raw))
+		dec.KnownFields(true)
+		return dec.Decode(v)
+	}
+	return nil
+}
+
+func (x *rawSceneSpec) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	raw := append([]byte{}, data...)
+	x.decode = func(v interface{}) error {
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		return dec.Decode(v)
+	}
+	return nil
+}
+
+// resolveYAMLAliases returns copy of node that has target nodes instead of
+// aliases.
+func resolveYAMLAliases(node *yaml.Node) *yaml.Node {
+	if node.Kind == yaml.AliasNode && node.Alias != nil {
+		return resolveYAMLAliases(node.Alias)
+	}
+
+	resolved := *node
+	resolved.Anchor = ""
+	resolved.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		resolved.Content[i] = resolveYAMLAliases(child)
+	}
+	return &resolved
+}
+
+func (x *playbookFile) toScenes() ([]Scene, error) {
+	scenes, err := toScenes(x.Scenes)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(x.Teardown) > 0 {
+		teardown, err := toScenes(x.Teardown)
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid teardown")
+		}
+		scenes = append(scenes, Teardown(teardown...))
+	}
+
+	return scenes, nil
+}
+
+func toScenes(specs []*sceneSpec) ([]Scene, error) {
+	var scenes []Scene
+	for idx, spec := range specs {
+		scene, err := spec.toScene()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid scene #%d (%s)", idx+1, spec.Type)
+		}
+		scenes = append(scenes, scene)
+	}
+
+	return scenes, nil
+}
+
+func (x *targetSpec) toTarget() (Target, error) {
+	switch {
+	case x == nil:
+		return nil, errors.New("target is required")
+	case x.LogicalID != "" && x.Arn != "":
+		return nil, errors.New("either of logical_id or arn should be specified")
+	case x.LogicalID != "":
+		return LogicalID(x.LogicalID), nil
+	case x.Arn != "":
+		return Arn(x.Arn), nil
+	}
+	return nil, errors.New("logical_id or arn is required in target")
+}
+
+func (x *sceneSpec) toScene() (Scene, error) {
+	switch x.Type {
+	case "pause":
+		return Pause(x.Seconds), nil
+	case "parallel":
+		return x.toParallel()
+	case "sequence":
+		return x.toSequence()
+	case "repeat":
+		return x.toRepeat()
+	case "if":
+		return x.toIf()
+	}
+
+	if x.Expect != nil {
+		if err := x.Expect.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if x.Type == "query_logs_insights" {
+		return x.toQueryLogsInsights()
+	}
+
+	target, err := x.Target.toTarget()
+	if err != nil {
+		return nil, err
+	}
+
+	switch x.Type {
+	case "invoke_lambda":
+		return x.toInvokeLambda(target)
+	case "publish_sns":
+		return x.toPublishSns(target)
+	case "put_kinesis":
+		return x.toPutKinesis(target)
+	case "get_kinesis_record":
+		return x.toGetKinesisRecord(target)
+	case "get_dynamo_record":
+		return x.toGetDynamoRecord(target)
+	case "get_lambda_logs":
+		return x.toGetLambdaLogs(target)
+	case "delete_dynamo_record":
+		return x.toDeleteDynamoRecord(target)
+	case "delete_s3_objects":
+		return x.toDeleteS3Objects(target)
+	}
+
+	return nil, fmt.Errorf("Unsupported scene type: '%s'", x.Type)
+}
+
+func (x *sceneSpec) setPolling(scene *pollingScene) error {
+	if x.Wait != nil {
+		policy, err := x.Wait.toWaitPolicy()
+		if err != nil {
+			return err
+		}
+		scene.setWait(policy)
+	}
+	if x.Limit > 0 {
+		scene.setLimit(x.Limit)
+	}
+	if x.Interval > 0 {
+		scene.setInterval(x.Interval)
+	}
+	return nil
+}
+
+func (x *sceneSpec) toParallel() (Scene, error) {
+	if len(x.Scenes) == 0 {
+		return nil, errors.New("scenes are required")
+	}
+	scenes, err := toScenes(x.Scenes)
+	if err != nil {
+		return nil, err
+	}
+
+	scene := Parallel(scenes...)
+	if x.FailFast {
+		scene.FailFast()
+	}
+	return scene, nil
+}
+
+func (x *sceneSpec) toSequence() (Scene, error) {
+	if len(x.Scenes) == 0 {
+		return nil, errors.New("scenes are required")
+	}
+	scenes, err := toScenes(x.Scenes)
+	if err != nil {
+		return nil, err
+	}
+	return Sequence(x.Name, scenes...), nil
+}
+
+func (x *sceneSpec) toRepeat() (Scene, error) {
+	if len(x.Scenes) == 0 {
+		return nil, errors.New("scenes are required")
+	}
+	if x.Count < 1 {
+		return nil, errors.New("count must be positive")
+	}
+	scenes, err := toScenes(x.Scenes)
+	if err != nil {
+		return nil, err
+	}
+	return Repeat(x.Count, scenes...), nil
+}
+
+func (x *sceneSpec) toIf() (Scene, error) {
+	if x.Condition == "" {
+		return nil, errors.New("condition is required")
+	}
+	if len(x.Then) == 0 {
+		return nil, errors.New("then is required")
+	}
+
+	then, err := toScenes(x.Then)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid then")
+	}
+	scene := &IfScene{condition: x.Condition, then: Sequence("then", then...)}
+
+	if len(x.Else) > 0 {
+		els, err := toScenes(x.Else)
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid else")
+		}
+		scene.els = Sequence("else", els...)
+	}
+	return scene, nil
+}
+
+func (x *sceneSpec) toInvokeLambda(target Target) (Scene, error) {
+	scene := InvokeLambda(target, nil).Template()
+	switch {
+	case x.Event != nil && x.SnsEvent != nil:
+		return nil, errors.New("either of event or sns_event should be specified")
+	case x.SnsEvent != nil:
+		scene.SnsEvent(x.SnsEvent)
+	default:
+		scene.Event(x.Event)
+	}
+	if x.ExpectFunctionError {
+		scene.ExpectFunctionError()
+	}
+	switch {
+	case x.Async && x.DryRun:
+		return nil, errors.New("either of async or dry_run should be specified")
+	case x.Async:
+		scene.Async()
+	case x.DryRun:
+		scene.DryRun()
+	}
+	if x.Qualifier != "" {
+		scene.Qualifier(x.Qualifier)
+	}
+	if x.ClientContext != nil {
+		scene.ClientContext(x.ClientContext)
+	}
+	if x.CaptureRequestID != "" {
+		scene.CaptureRequestID(x.CaptureRequestID)
+	}
+
+	scene.check = func(ctx context.Context, data []byte) error {
+		return x.Expect.check(ctx, scene.gp, data)
+	}
+
+	if x.CaptureAs != "" {
+		scene.Capture(x.CaptureAs)
+	}
+	for name, path := range x.CaptureJSON {
+		scene.CaptureJSONPath(name, path)
+	}
+	return scene, nil
+}
+
+func (x *sceneSpec) toPublishSns(target Target) (Scene, error) {
+	if x.Message == nil {
+		return nil, errors.New("message is required")
+	}
+
+	scene := PublishSnsData(target, x.Message).Template()
+	if len(x.Attributes) > 0 {
+		attrs := SnsMessageAttributes{}
+		for key, value := range x.Attributes {
+			attrs[key] = &sns.MessageAttributeValue{
+				DataType:    aws.String("String"),
+				StringValue: aws.String(value),
+			}
+		}
+		scene.MessageAttributes(attrs)
+	}
+	if x.CaptureAs != "" {
+		scene.Capture(x.CaptureAs)
+	}
+
+	return scene, nil
+}
+
+func (x *sceneSpec) toPutKinesis(target Target) (Scene, error) {
+	if x.Message == nil {
+		return nil, errors.New("message is required")
+	}
+	scene := PutKinesisStreamData(target, x.Message).Template()
+	if x.CaptureAs != "" {
+		scene.Capture(x.CaptureAs)
+	}
+	return scene, nil
+}
+
+func (x *sceneSpec) toGetKinesisRecord(target Target) (Scene, error) {
+	scene := GetKinesisStreamRecord(target, nil)
+	scene.check = func(ctx context.Context, data []byte) error {
+		return x.Expect.check(ctx, scene.gp, data)
+	}
+	if err := x.setPolling(&scene.pollingScene); err != nil {
+		return nil, err
+	}
+	return scene, nil
+}
+
+func (x *sceneSpec) toGetDynamoRecord(target Target) (Scene, error) {
+	if x.HashKey == nil || x.HashKey.Name == "" {
+		return nil, errors.New("hash_key is required")
+	}
+
+	scene := GetDynamoRecord(target, nil)
+	scene.hashKey = &dynamoKey{name: x.HashKey.Name, value: x.HashKey.Value}
+	if x.RangeKey != nil {
+		scene.rangeKey = &dynamoKey{name: x.RangeKey.Name, value: x.RangeKey.Value}
+	}
+	scene.check = func(ctx context.Context, data []byte) error {
+		return x.Expect.check(ctx, scene.gp, data)
+	}
+	if err := x.setPolling(&scene.pollingScene); err != nil {
+		return nil, err
+	}
+	return scene, nil
+}
+
+func (x *sceneSpec) toGetLambdaLogs(target Target) (Scene, error) {
+	scene := GetLambdaLogs(target, nil).Filter(x.Filter)
+	scene.check = func(ctx context.Context, data []byte) error {
+		return x.Expect.check(ctx, scene.gp, data)
+	}
+	if err := x.setPolling(&scene.pollingScene); err != nil {
+		return nil, err
+	}
+	return scene, nil
+}
+
+func (x *sceneSpec) toQueryLogsInsights() (Scene, error) {
+	if x.Query == "" {
+		return nil, errors.New("query is required")
+	}
+	specs := x.Targets
+	if x.Target != nil {
+		specs = append([]*targetSpec{x.Target}, specs...)
+	}
+	if len(specs) == 0 {
+		return nil, errors.New("targets are required")
+	}
+
+	var targets []Target
+	for _, spec := range specs {
+		target, err := spec.toTarget()
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+
+	scene := QueryLogsInsights(targets, x.Query, nil)
+	scene.check = func(ctx context.Context, data []byte) error {
+		return x.Expect.check(ctx, scene.gp, data)
+	}
+	if err := x.setPolling(&scene.pollingScene); err != nil {
+		return nil, err
+	}
+	return scene, nil
+}
+
+func (x *sceneSpec) toDeleteDynamoRecord(target Target) (Scene, error) {
+	if x.HashKey == nil || x.HashKey.Name == "" {
+		return nil, errors.New("hash_key is required")
+	}
+
+	scene := DeleteDynamoRecord(target, x.HashKey.Name, x.HashKey.Value)
+	if x.RangeKey != nil {
+		scene.Range(x.RangeKey.Name, x.RangeKey.Value)
+	}
+	return scene, nil
+}
+
+func (x *sceneSpec) toDeleteS3Objects(target Target) (Scene, error) {
+	if x.Prefix == "" {
+		return nil, errors.New("prefix is required")
+	}
+	return DeleteS3Objects(target, x.Prefix), nil
+}
+
+// check returns nil if data satisfies all expectations. Strings in the
+// expectations are rendered as template. It always returns nil if x is nil.
+func (x *expectSpec) check(ctx context.Context, gp *Generalprobe, data []byte) error {
+	if x == nil {
+		return nil
+	}
+
+	matchers, err := x.matchers(ctx, gp)
+	if err != nil {
+		return err
+	}
+	return matchAll(matchers, data)
+}
+
+// matchers converts the expectations to Matcher after rendering templates.
+func (x *expectSpec) matchers(ctx context.Context, gp *Generalprobe) ([]Matcher, error) {
+	var matchers []Matcher
+
+	if x.Contains != "" {
+		contains, err := gp.render(ctx, x.Contains)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, Contains(contains))
+	}
+
+	if x.JSON != nil {
+		expected, err := renderJSON(ctx, gp, x.JSON)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, PartialJSON(expected))
+	}
+
+	for _, path := range x.Path {
+		m, err := path.matcher(ctx, gp)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+	}
+
+	if x.Schema != nil {
+		schema, err := normalizeJSON(x.Schema)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, JSONSchema(schema))
+	}
+
+	return matchers, nil
+}
+
+// validate checks structure of the expectations when the playbook is loaded.
+func (x *expectSpec) validate() error {
+	for _, path := range x.Path {
+		if path.Path == "" {
+			return errors.New("path is required in expect.path")
+		}
+		if path.Equals == nil && path.Contains == nil && path.Regex == "" &&
+			path.Min == nil && path.Max == nil && !path.Exists {
+			return fmt.Errorf("No matcher for %s in expect.path", path.Path)
+		}
+	}
+	return nil
+}
+
+func (x *pathSpec) matcher(ctx context.Context, gp *Generalprobe) (Matcher, error) {
+	if x.Path == "" {
+		return nil, errors.New("path is required in expect.path")
+	}
+
+	switch {
+	case x.Equals != nil:
+		expected, err := renderJSON(ctx, gp, x.Equals)
+		if err != nil {
+			return nil, err
+		}
+		return PathEquals(x.Path, expected), nil
+
+	case x.Contains != nil:
+		expected, err := renderJSON(ctx, gp, x.Contains)
+		if err != nil {
+			return nil, err
+		}
+		return PathContains(x.Path, expected), nil
+
+	case x.Regex != "":
+		pattern, err := gp.render(ctx, x.Regex)
+		if err != nil {
+			return nil, err
+		}
+		return PathMatches(x.Path, pattern), nil
+
+	case x.Min != nil || x.Max != nil:
+		min, max := math.Inf(-1), math.Inf(1)
+		if x.Min != nil {
+			min = *x.Min
+		}
+		if x.Max != nil {
+			max = *x.Max
+		}
+		return PathInRange(x.Path, min, max), nil
+
+	case x.Exists:
+		return PathExists(x.Path), nil
+	}
+
+	return nil, fmt.Errorf("No matcher for %s in expect.path", x.Path)
+}
+
+// renderJSON normalizes v decoded from YAML or JSON and renders strings in it.
+func renderJSON(ctx context.Context, gp *Generalprobe, v interface{}) (interface{}, error) {
+	normalized, err := normalizeJSON(v)
+	if err != nil {
+		return nil, err
+	}
+	return gp.renderValue(ctx, normalized)
+}
+
+// normalizeJSON converts v to the same type as json.Unmarshal with
+// interface{} (e.g. int to float64) for comparison.
+func normalizeJSON(v interface{}) (interface{}, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Fail to marshal expected value: %v", v)
+	}
+
+	var normalized interface{}
+	if err := json.Unmarshal(raw, &normalized); err != nil {
+		return nil, errors.Wrapf(err, "Fail to unmarshal expected value: %v", v)
+	}
+	return normalized, nil
+}
+
+// matchSubset returns true if actual has all fields of expected. Arrays must
+// have same length and each element is compared as subset.
+func matchSubset(expected, actual interface{}) bool {
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for key, ev := range e {
+			av, ok := a[key]
+			if !ok || !matchSubset(ev, av) {
+				return false
+			}
+		}
+		return true
+
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok || len(a) != len(e) {
+			return false
+		}
+		for i := range e {
+			if !matchSubset(e[i], a[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return reflect.DeepEqual(expected, actual)
+}
@@ -0,0 +1,146 @@
+package generalprobe_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gp "github.com/m-mizutani/generalprobe"
+)
+
+func TestLoadPlaybook(t *testing.T) {
+	for _, path := range []string{"testdata/playbook.yml", "testdata/playbook.json"} {
+		t.Run(path, func(t *testing.T) {
+			_, probe := newFakeStack(t)
+
+			playbook, err := gp.LoadPlaybook(path)
+			require.NoError(t, err)
+			require.NoError(t, probe.Play(playbook))
+		})
+	}
+}
+
+func TestLoadPlaybookUnexpectedResult(t *testing.T) {
+	_, probe := newFakeStack(t)
+
+	path := writePlaybook(t, `
+scenes:
+  - type: invoke_lambda
+    target: { logical_id: TestHandler }
+    sns_event: { id: "x" }
+    expect:
+      json: { message: ng }
+`)
+	playbook, err := gp.LoadPlaybook(path)
+	require.NoError(t, err)
+	assert.Error(t, probe.Play(playbook))
+}
+
+func TestLoadPlaybookMatchers(t *testing.T) {
+	_, probe := newFakeStack(t)
+
+	playbook, err := gp.LoadPlaybook(writePlaybook(t, `
+scenes:
+  - type: invoke_lambda
+    target: { logical_id: TestHandler }
+    sns_event: { id: "{{ runID }}" }
+    expect:
+      path:
+        - { path: $.message, equals: ok }
+        - { path: $.message, regex: "^o" }
+        - { path: $.message, exists: true }
+      schema:
+        type: object
+        required: [message]
+  - type: get_dynamo_record
+    target: { logical_id: ResultStore }
+    hash_key: { name: result_id, value: "{{ runID }}" }
+    expect:
+      path:
+        - { path: $.report, contains: "{{ runID }}" }
+`))
+	require.NoError(t, err)
+	require.NoError(t, probe.Play(playbook))
+}
+
+func TestLoadPlaybookInvalid(t *testing.T) {
+	testCases := map[string]string{
+		"unknown type":      "scenes:\n  - type: no_such_scene\n    target: { logical_id: X }\n",
+		"no target":         "scenes:\n  - type: publish_sns\n    message: x\n",
+		"no message":        "scenes:\n  - type: publish_sns\n    target: { logical_id: X }\n",
+		"no hash key":       "scenes:\n  - type: get_dynamo_record\n    target: { logical_id: X }\n",
+		"ambiguous target":  "scenes:\n  - type: publish_sns\n    target: { logical_id: X, arn: Y }\n    message: x\n",
+		"broken yaml":       "scenes: [",
+		"no path matcher":   "scenes:\n  - type: get_lambda_logs\n    target: { logical_id: X }\n    expect: { path: [{ path: $.x }] }\n",
+		"invalid wait":      "scenes:\n  - type: get_lambda_logs\n    target: { logical_id: X }\n    wait: { interval: 3 }\n",
+		"async and dry run": "scenes:\n  - type: invoke_lambda\n    target: { logical_id: X }\n    async: true\n    dry_run: true\n",
+	}
+
+	for title, body := range testCases {
+		t.Run(title, func(t *testing.T) {
+			_, err := gp.LoadPlaybook(writePlaybook(t, body))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadPlaybookUnknownField(t *testing.T) {
+	testCases := map[string]struct {
+		name string
+		body string
+	}{
+		"yaml": {"playbook.yml", `
+scenes:
+  - type: pause
+    seconds: 1
+  - type: get_lambda_logs
+    target: { logical_id: TestHandler }
+    expects: { contains: done }
+`},
+		"json": {"playbook.json", `{"scenes": [
+  {"type": "pause", "seconds": 1},
+  {"type": "publish_sns", "target": {"logical_id": "Trigger"}, "paylod": "x"}
+]}`},
+	}
+
+	for title, tc := range testCases {
+		t.Run(title, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tc.name)
+			require.NoError(t, ioutil.WriteFile(path, []byte(tc.body), 0644))
+			_, err := gp.LoadPlaybook(path)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "Invalid scene #2")
+		})
+	}
+
+	t.Run("top level", func(t *testing.T) {
+		_, err := gp.LoadPlaybook(writePlaybook(t, "scene:\n  - type: pause\n"))
+		assert.Error(t, err)
+	})
+
+	t.Run("teardown", func(t *testing.T) {
+		_, err := gp.LoadPlaybook(writePlaybook(t, "teardown:\n  - type: pause\n    second: 1\n"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "Invalid teardown: Invalid scene #1")
+	})
+
+	t.Run("alias", func(t *testing.T) {
+		_, err := gp.LoadPlaybook(writePlaybook(t, `
+scenes:
+  - type: get_lambda_logs
+    target: &handler { logical_id: TestHandler }
+  - type: get_lambda_logs
+    target: *handler
+`))
+		assert.NoError(t, err)
+	})
+}
+
+func writePlaybook(t *testing.T, body string) string {
+	path := filepath.Join(t.TempDir(), "playbook.yml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(body), 0644))
+	return path
+}
@@ -0,0 +1,171 @@
+package generalprobe
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// WithLogger sets logger of the Generalprobe instead of the package logger
+// that is configured by GENERALPROBE_LOG_LEVEL and SetLoggerXxxLevel.
+func WithLogger(l *logrus.Logger) Option {
+	return func(gp *Generalprobe) {
+		gp.logger = l
+	}
+}
+
+// T returns testing.TB of the scene that is played by PlayT. Callbacks of
+// scenes can use it to fail only the subtest of the scene, e.g.
+// require.NoError(probe.T(), err). It returns nil outside of PlayT.
+//
+// FailNow (and require) must not be called from callbacks in Parallel
+// because they are called in other goroutines. Use Error (and assert)
+// instead.
+func (x *Generalprobe) T() testing.TB {
+	return x.testTB
+}
+
+// testLogWriter writes logs to testing.TB of the running scene.
+type testLogWriter struct {
+	mutex sync.Mutex
+	tb    testing.TB
+}
+
+func (x *testLogWriter) set(tb testing.TB) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.tb = tb
+}
+
+func (x *testLogWriter) Write(p []byte) (int, error) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	if x.tb != nil {
+		x.tb.Log(string(p))
+	}
+	return len(p), nil
+}
+
+// testLogFormatter formats a log entry in one line for t.Log such as
+// "[info] Step (1/3): AdLib key=value".
+type testLogFormatter struct{}
+
+func (x *testLogFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	line := fmt.Sprintf("[%s] %s", entry.Level, strings.TrimSpace(entry.Message))
+
+	keys := make([]string, 0, len(entry.Data))
+	for key := range entry.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		line += fmt.Sprintf(" %s=%v", key, entry.Data[key])
+	}
+
+	return []byte(line), nil
+}
+
+// subtestName returns name of subtest for the scene. Slash is replaced
+// because it separates subtests in -run pattern.
+func subtestName(prefix string, idx int, scene Scene) string {
+	name := fmt.Sprintf("%s%d %s", prefix, idx+1, scene.string())
+	return strings.ReplaceAll(name, "/", "_")
+}
+
+// PlayT executes scenes sequentially as subtests of t. Each scene is run by
+// t.Run with name like "2 Read DynamoDB of ResultStore", so a scene can be
+// targeted by go test -run. Logs of Generalprobe are written by t.Log of
+// the scene. Scenes after a failed scene are skipped and scenes in Teardown
+// are always run as subtests named like "teardown 1 ...".
+//
+// PlayT returns true if all scenes passed. Report of the run is passed to
+// reporters set by WithReporter, and t fails if a reporter returns error.
+func (x *Generalprobe) PlayT(t *testing.T, playbook []Scene) bool {
+	t.Helper()
+
+	writer := &testLogWriter{}
+	testLogger := logrus.New()
+	testLogger.SetOutput(writer)
+	testLogger.SetFormatter(&testLogFormatter{})
+	testLogger.SetLevel(x.logger.GetLevel())
+	if testLogger.GetLevel() < logrus.InfoLevel {
+		testLogger.SetLevel(logrus.InfoLevel)
+	}
+
+	origin := x.logger
+	x.logger = testLogger
+	defer func() {
+		x.logger = origin
+		x.testTB = nil
+	}()
+
+	scenes, teardown := splitTeardown(playbook)
+	x.startReport()
+
+	ctx := context.Background()
+	if x.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, x.timeout)
+		defer cancel()
+	}
+
+	var errs []error
+	run := func(ctx context.Context, prefix string, idx, total int, scene Scene, teardown, skip bool) bool {
+		return t.Run(subtestName(prefix, idx, scene), func(t *testing.T) {
+			if skip {
+				x.addSceneReport(step{path: strconv.Itoa(idx + 1), index: idx}, scene, ResultSkipped)
+				t.Skip("Skipped because a previous scene failed")
+			}
+
+			writer.set(t)
+			x.testTB = t
+			defer writer.set(nil)
+
+			if err := x.playScene(ctx, idx, total, scene, teardown); err != nil {
+				errs = append(errs, err)
+				t.Fatal(err)
+			}
+		})
+	}
+
+	passed := true
+	for idx, scene := range scenes {
+		if !run(ctx, "", idx, len(scenes), scene, false, !passed) {
+			passed = false
+		}
+	}
+
+	// Teardown must not be interrupted by timeout of the main scenes.
+	tctx := detachedContext{parent: ctx}
+	for idx, scene := range teardown {
+		if !run(tctx, "teardown ", idx, len(teardown), scene, true, false) {
+			passed = false
+		}
+	}
+
+	var err error
+	if len(errs) > 0 {
+		err = errs[0]
+	} else if !passed {
+		err = fmt.Errorf("%s failed", t.Name())
+	}
+	if err != nil {
+		err = x.diagnose(ctx, err)
+		var diagErr *DiagnosticsError
+		if errors.As(err, &diagErr) && diagErr.Diagnostics.Dir != "" {
+			t.Logf("Diagnostics are written to %s", diagErr.Diagnostics.Dir)
+		}
+	}
+	if rerr := x.finishReport(err, nil); rerr != nil {
+		t.Error(rerr)
+	}
+
+	return passed
+}
@@ -0,0 +1,114 @@
+package generalprobe_test
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gp "github.com/m-mizutani/generalprobe"
+)
+
+func TestPlayT(t *testing.T) {
+	_, probe := newFakeStack(t)
+
+	var received []byte
+	var teardown bool
+	passed := probe.PlayT(t, []gp.Scene{
+		gp.PutKinesisStreamRecord(gp.LogicalID("ResultStream"), []byte("{{ runID }}")).Template(),
+		gp.GetKinesisStreamRecord(gp.LogicalID("ResultStream"), func(data []byte) bool {
+			require.NotNil(probe.T(), data)
+			received = data
+			return true
+		}),
+		gp.Teardown(gp.AdLib(func() { teardown = true })),
+	})
+
+	assert.True(t, passed)
+	assert.Equal(t, probe.RunID(), string(received))
+	assert.True(t, teardown)
+	assert.Nil(t, probe.T())
+}
+
+// TestPlayTOutput checks subtests and logs of PlayT by running
+// TestPlayTFailure in another process because it fails intentionally.
+func TestPlayTOutput(t *testing.T) {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestPlayTFailure$", "-test.v")
+	cmd.Env = append(os.Environ(), "GENERALPROBE_TEST_PLAYT_FAILURE=1")
+	out, err := cmd.CombinedOutput()
+	require.Error(t, err)
+
+	output := string(out)
+	assert.Contains(t, output, "--- PASS: TestPlayTFailure/1_AdLib")
+	assert.Contains(t, output, "--- FAIL: TestPlayTFailure/2_Invoke_Lambda_TestHandler")
+	assert.Contains(t, output, "--- SKIP: TestPlayTFailure/3_AdLib")
+	assert.Contains(t, output, "--- PASS: TestPlayTFailure/teardown_1_AdLib")
+	assert.Contains(t, output, "Step (2/3): Invoke Lambda")
+	assert.Contains(t, output, "unexpected message")
+
+	// require.Equal calls FailNow that exits goroutine of the scene.
+	assert.Contains(t, output, "after scene 2: Scene is stopped by testing.T")
+	assert.Contains(t, output, "report 1 passed")
+	assert.Contains(t, output, "report 2 failed")
+	assert.Contains(t, output, "report 3 skipped")
+
+	// Nested scene stopped by FailNow is also reported.
+	cmd = exec.Command(os.Args[0], "-test.run=^TestPlayTNestedFailure$", "-test.v")
+	cmd.Env = append(os.Environ(), "GENERALPROBE_TEST_PLAYT_FAILURE=1")
+	out, err = cmd.CombinedOutput()
+	require.Error(t, err)
+
+	output = string(out)
+	assert.Contains(t, output, "after scene 1.1: Scene is stopped by testing.T")
+	assert.Contains(t, output, "after scene 1: Scene is stopped by testing.T")
+	assert.Contains(t, output, "report 1.1 failed: Scene is stopped by testing.T")
+}
+
+func TestPlayTFailure(t *testing.T) {
+	if os.Getenv("GENERALPROBE_TEST_PLAYT_FAILURE") == "" {
+		t.Skip("GENERALPROBE_TEST_PLAYT_FAILURE is not set")
+	}
+
+	_, probe := newFakeStack(t)
+	probe.AfterScene(func(ev gp.SceneEvent) {
+		t.Logf("after scene %s: %v", ev.Step, ev.Err)
+	})
+	defer func() {
+		for _, scene := range probe.LastReport().Scenes {
+			t.Logf("report %s %s", scene.Step, scene.Result)
+		}
+	}()
+
+	probe.PlayT(t, []gp.Scene{
+		gp.AdLib(func() {}),
+		gp.InvokeLambda(gp.LogicalID("TestHandler"), func(ret []byte) {
+			require.Equal(probe.T(), `{"message":"ng"}`, string(ret), "unexpected message")
+		}).SnsEvent(map[string]string{"id": "x"}),
+		gp.AdLib(func() {}),
+		gp.Teardown(gp.AdLib(func() {})),
+	})
+}
+
+func TestPlayTNestedFailure(t *testing.T) {
+	if os.Getenv("GENERALPROBE_TEST_PLAYT_FAILURE") == "" {
+		t.Skip("GENERALPROBE_TEST_PLAYT_FAILURE is not set")
+	}
+
+	_, probe := newFakeStack(t)
+	probe.AfterScene(func(ev gp.SceneEvent) {
+		t.Logf("after scene %s: %v", ev.Step, ev.Err)
+	})
+	defer func() {
+		for _, scene := range probe.LastReport().Scenes {
+			t.Logf("report %s %s: %s", scene.Step, scene.Result, scene.Error)
+		}
+	}()
+
+	probe.PlayT(t, []gp.Scene{
+		gp.Sequence("nested", gp.AdLib(func() {
+			require.True(probe.T(), false)
+		})),
+	})
+}
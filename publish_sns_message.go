@@ -1,12 +1,10 @@
 package generalprobe
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"log"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sns"
 
 	"github.com/pkg/errors"
@@ -17,9 +15,12 @@ type SnsMessageAttributes map[string]*sns.MessageAttributeValue
 
 // PublishSnsScene is a scene to publish SNS message.
 type PublishSnsScene struct {
-	target  Target
-	message []byte
+	target Target
+	// message is []byte or structure data to be marshaled to JSON.
+	message interface{}
 	attrs   SnsMessageAttributes
+	capture string
+	payloadTemplate
 	baseScene
 }
 
@@ -33,13 +34,13 @@ func PublishSnsMessage(target Target, message []byte) *PublishSnsScene {
 }
 
 // PublishSnsData creates a scene of SNS Publish with structure data.
+// An error of marshaling data is returned when the scene is played.
 func PublishSnsData(target Target, data interface{}) *PublishSnsScene {
-	msg, err := json.Marshal(data)
-	if err != nil {
-		log.Fatalf("Fail to marshal data for SNS publish: %v", data)
+	scene := PublishSnsScene{
+		target:  target,
+		message: data,
 	}
-
-	return PublishSnsMessage(target, msg)
+	return &scene
 }
 
 // MessageAttributes sets attribute of SNS MessageAttributes map
@@ -48,29 +49,55 @@ func (x *PublishSnsScene) MessageAttributes(attrs SnsMessageAttributes) *Publish
 	return x
 }
 
+// Template enables templates such as {{ runID }} and {{ .vars.name }} in
+// the message. Only string values of structure data are rendered, and
+// {{ toJSON .vars.name }} embeds a value into JSON text safely.
+func (x *PublishSnsScene) Template() *PublishSnsScene {
+	x.templated = true
+	return x
+}
+
+// Capture stores MessageId of published message as variable name.
+func (x *PublishSnsScene) Capture(name string) *PublishSnsScene {
+	x.capture = name
+	return x
+}
+
 // Strings return text explanation of the scene
 func (x *PublishSnsScene) string() string {
-	return fmt.Sprintf("SNS message to %s", x.target.arn(x.gp))
+	return fmt.Sprintf("SNS message to %s", targetString(x.target, x.gp))
 }
 
-func (x *PublishSnsScene) play() error {
-	ssn := session.Must(session.NewSession(&aws.Config{
-		Region: aws.String(x.region()),
-	}))
-	snsService := sns.New(ssn)
+func (x *PublishSnsScene) sceneTarget() Target { return x.target }
+
+func (x *PublishSnsScene) play(ctx context.Context) error {
+	snsService := x.clients().SNS
 
-	topicArn := x.target.arn(x.gp)
-	resp, err := snsService.Publish(&sns.PublishInput{
-		Message:           aws.String(string(x.message)),
+	topicArn, err := x.target.arn(x.gp)
+	if err != nil {
+		return err
+	}
+	message, err := x.renderPayload(ctx, x.gp, x.message)
+	if err != nil {
+		return err
+	}
+
+	x.gp.recordPayload(ctx, x.target, []byte(message))
+	resp, err := snsService.PublishWithContext(ctx, &sns.PublishInput{
+		Message:           aws.String(message),
 		TopicArn:          aws.String(topicArn),
 		MessageAttributes: x.attrs,
 	})
 
-	logger.WithField("result", resp).Debug("sns:Publish result")
+	x.log().WithField("result", resp).Debug("sns:Publish result")
 
 	if err != nil {
 		return errors.Wrap(err, "Fail to publish report")
 	}
 
+	if x.capture != "" {
+		x.vars().Set(x.capture, aws.StringValue(resp.MessageId))
+	}
+
 	return nil
 }
@@ -1,13 +1,13 @@
 package generalprobe
 
 import (
+	"context"
 	"crypto/sha256"
 	"fmt"
 
 	"github.com/pkg/errors"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/kinesis"
 )
 
@@ -15,7 +15,10 @@ import (
 type PutKinesisStreamRecordScene struct {
 	target Target
 	baseScene
-	message []byte
+	// message is []byte or structure data to be marshaled to JSON.
+	message interface{}
+	capture string
+	payloadTemplate
 }
 
 // PutKinesisStreamRecord is a constructor of Scene
@@ -27,32 +30,66 @@ func PutKinesisStreamRecord(target Target, message []byte) *PutKinesisStreamReco
 	return &scene
 }
 
+// PutKinesisStreamData is a constructor of Scene with structure data that
+// is marshaled to JSON.
+func PutKinesisStreamData(target Target, data interface{}) *PutKinesisStreamRecordScene {
+	scene := PutKinesisStreamRecordScene{
+		target:  target,
+		message: data,
+	}
+	return &scene
+}
+
+// Template enables templates such as {{ runID }} and {{ .vars.name }} in
+// the record. Without Template, the record is put as it is.
+func (x *PutKinesisStreamRecordScene) Template() *PutKinesisStreamRecordScene {
+	x.templated = true
+	return x
+}
+
+// Capture stores SequenceNumber of the put record as variable name.
+func (x *PutKinesisStreamRecordScene) Capture(name string) *PutKinesisStreamRecordScene {
+	x.capture = name
+	return x
+}
+
 // Strings return text explanation of the scene
 func (x *PutKinesisStreamRecordScene) string() string {
-	return fmt.Sprintf("Put a new kinesis record to %s", x.target.arn(x.gp))
+	return fmt.Sprintf("Put a new kinesis record to %s", targetString(x.target, x.gp))
 }
 
-func (x *PutKinesisStreamRecordScene) play() error {
-	const maxRetry = 20
+func (x *PutKinesisStreamRecordScene) sceneTarget() Target { return x.target }
+
+func (x *PutKinesisStreamRecordScene) play(ctx context.Context) error {
+	streamName, err := x.target.name(x.gp)
+	if err != nil {
+		return err
+	}
 
-	streamName := x.target.name(x.gp)
+	kinesisService := x.clients().Kinesis
 
-	ssn := session.Must(session.NewSession(&aws.Config{
-		Region: aws.String(x.region()),
-	}))
-	kinesisService := kinesis.New(ssn)
+	rendered, err := x.renderPayload(ctx, x.gp, x.message)
+	if err != nil {
+		return err
+	}
+	message := []byte(rendered)
 
 	kinesisInput := kinesis.PutRecordInput{
-		Data:         x.message,
-		PartitionKey: aws.String(fmt.Sprintf("%x", sha256.Sum256(x.message))),
+		Data:         message,
+		PartitionKey: aws.String(fmt.Sprintf("%x", sha256.Sum256(message))),
 		StreamName:   aws.String(streamName),
 	}
-	resp, err := kinesisService.PutRecord(&kinesisInput)
+	x.gp.recordPayload(ctx, x.target, message)
+	resp, err := kinesisService.PutRecordWithContext(ctx, &kinesisInput)
 
-	logger.WithField("resp", resp).Debug("Done Kinesis PutRecord")
+	x.log().WithField("resp", resp).Debug("Done Kinesis PutRecord")
 	if err != nil {
 		return errors.Wrap(err, "Fail to put kinesis record")
 	}
 
+	if x.capture != "" {
+		x.vars().Set(x.capture, aws.StringValue(resp.SequenceNumber))
+	}
+
 	return nil
 }
@@ -0,0 +1,413 @@
+package generalprobe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// LogsInsightsTimeFormat is format of @timestamp in results of CloudWatch
+// Logs Insights.
+const LogsInsightsTimeFormat = "2006-01-02 15:04:05.000"
+
+// QueryLogsInsightsCallback is a callback type of QueryLogsInsights. It
+// returns true if rows are expected one, false to run the query again, or
+// error to fail the scene immediately.
+type QueryLogsInsightsCallback func(rows []LogsInsightsRow) (bool, error)
+
+// QueryLogsInsightsScene is a scene to run CloudWatch Logs Insights query
+// across log groups until the expected result comes.
+type QueryLogsInsightsScene struct {
+	targets  []Target
+	query    string
+	callback QueryLogsInsightsCallback
+	expectation
+	pollingScene
+}
+
+// LogsInsightsRow is a row of result of Logs Insights query. Key is name of
+// field such as "@message" and "count(*)". All values are string in the
+// result, so Int, Float, Time and Bind convert them.
+type LogsInsightsRow map[string]string
+
+// Int returns value of field as integer.
+func (x LogsInsightsRow) Int(field string) (int64, error) {
+	v, ok := x[field]
+	if !ok {
+		return 0, fmt.Errorf("No such field in Logs Insights result: %s", field)
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Fail to parse %s of Logs Insights result as integer: %s", field, v)
+	}
+	return n, nil
+}
+
+// Float returns value of field as float.
+func (x LogsInsightsRow) Float(field string) (float64, error) {
+	v, ok := x[field]
+	if !ok {
+		return 0, fmt.Errorf("No such field in Logs Insights result: %s", field)
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Fail to parse %s of Logs Insights result as float: %s", field, v)
+	}
+	return f, nil
+}
+
+// Time returns value of field such as @timestamp as time in UTC.
+func (x LogsInsightsRow) Time(field string) (time.Time, error) {
+	v, ok := x[field]
+	if !ok {
+		return time.Time{}, fmt.Errorf("No such field in Logs Insights result: %s", field)
+	}
+	t, err := time.Parse(LogsInsightsTimeFormat, v)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "Fail to parse %s of Logs Insights result as time: %s", field, v)
+	}
+	return t, nil
+}
+
+// Bind sets fields of the row to struct that data points to. Name of field
+// is taken from json tag (e.g. `json:"count(*)"`) or name of the struct
+// field. string, bool, integer, float and time.Time fields are supported.
+// Fields that are not in the row are left as they are.
+func (x LogsInsightsRow) Bind(data interface{}) error {
+	ptr := reflect.ValueOf(data)
+	if ptr.Kind() != reflect.Ptr || ptr.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("Logs Insights row can be bound only to pointer of struct: %T", data)
+	}
+	dst := ptr.Elem()
+
+	for i := 0; i < dst.NumField(); i++ {
+		field := dst.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := field.Name
+		if tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		if _, ok := x[name]; !ok {
+			continue
+		}
+		if err := x.bindField(dst.Field(i), name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x LogsInsightsRow) bindField(v reflect.Value, name string) error {
+	if v.Type() == reflect.TypeOf(time.Time{}) {
+		t, err := x.Time(name)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(x[name])
+	case reflect.Bool:
+		b, err := strconv.ParseBool(x[name])
+		if err != nil {
+			return errors.Wrapf(err, "Fail to parse %s of Logs Insights result as bool: %s", name, x[name])
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := x.Int(name)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(x[name], 10, 64)
+		if err != nil {
+			return errors.Wrapf(err, "Fail to parse %s of Logs Insights result as integer: %s", name, x[name])
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := x.Float(name)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("Unsupported type of %s to bind Logs Insights result: %s", name, v.Type())
+	}
+	return nil
+}
+
+// QueryLogsInsights creates a new scene to run Logs Insights query across
+// log groups of targets. A target is a Lambda function (its log group
+// /aws/lambda/<name> is queried) or AWS::Logs::LogGroup. Logs since
+// StartTime of Generalprobe are queried. The query is run again according
+// to WaitPolicy until callback returns true. callback can be nil if
+// matchers are set by Expect, and then matchers receive JSON array of rows.
+// Without both of them, the scene ends when the query returns any row.
+func QueryLogsInsights(targets []Target, query string, callback QueryLogsInsightsCallback) *QueryLogsInsightsScene {
+	scene := QueryLogsInsightsScene{
+		targets:  targets,
+		query:    query,
+		callback: callback,
+	}
+	return &scene
+}
+
+// QueryLogsInsightsRows is a constructor of QueryLogsInsightsScene with
+// callback that receives rows bound to T by LogsInsightsRow.Bind.
+func QueryLogsInsightsRows[T any](targets []Target, query string, callback func(rows []T) (bool, error)) *QueryLogsInsightsScene {
+	return QueryLogsInsights(targets, query, func(rows []LogsInsightsRow) (bool, error) {
+		values := make([]T, len(rows))
+		for i, row := range rows {
+			if err := row.Bind(&values[i]); err != nil {
+				return false, err
+			}
+		}
+		return callback(values)
+	})
+}
+
+// Limit sets maximum number of attempts. If the limit exceeded, Play
+// returns error of ErrPollingTimeout.
+func (x *QueryLogsInsightsScene) Limit(limit int) *QueryLogsInsightsScene {
+	x.setLimit(limit)
+	return x
+}
+
+// Interval sets seconds of wait time between attempts.
+func (x *QueryLogsInsightsScene) Interval(seconds int) *QueryLogsInsightsScene {
+	x.setInterval(seconds)
+	return x
+}
+
+// Wait sets WaitPolicy of the scene instead of default policy of Generalprobe.
+func (x *QueryLogsInsightsScene) Wait(policy WaitPolicy) *QueryLogsInsightsScene {
+	x.setWait(policy)
+	return x
+}
+
+// Expect sets matchers to check JSON array of rows such as
+// [{"count(*)":"3"}]. The query is run again if rows do not satisfy them.
+func (x *QueryLogsInsightsScene) Expect(matchers ...Matcher) *QueryLogsInsightsScene {
+	x.expect(matchers)
+	return x
+}
+
+// Strings return text explanation of the scene
+func (x *QueryLogsInsightsScene) string() string {
+	var targets []string
+	for _, target := range x.targets {
+		targets = append(targets, targetString(target, x.gp))
+	}
+	return fmt.Sprintf("Query Logs Insights of %s", strings.Join(targets, ", "))
+}
+
+func (x *QueryLogsInsightsScene) sceneTarget() Target {
+	if len(x.targets) != 1 {
+		return nil
+	}
+	return x.targets[0]
+}
+
+// logGroupName returns name of log group of target.
+func logGroupName(target Target, gp *Generalprobe) (string, error) {
+	switch t := target.(type) {
+	case *LogicalIDTarget:
+		name, err := t.name(gp)
+		if err != nil {
+			return "", err
+		}
+		switch resourceType := gp.LookupType(t.LogicalID); resourceType {
+		case "AWS::Lambda::Function":
+			return "/aws/lambda/" + name, nil
+		case "AWS::Logs::LogGroup":
+			return name, nil
+		default:
+			return "", errors.Wrapf(ErrUnsupportedResourceType, "%s of %s for Logs Insights", resourceType, t.LogicalID)
+		}
+
+	case *ArnTarget:
+		arn, err := t.arn(gp)
+		if err != nil {
+			return "", err
+		}
+		// arn:aws:lambda:<region>:<account>:function:<name>
+		// arn:aws:logs:<region>:<account>:log-group:<name>:*
+		sec := strings.Split(arn, ":")
+		switch {
+		case len(sec) >= 7 && sec[2] == "lambda" && sec[5] == "function":
+			return "/aws/lambda/" + sec[6], nil
+		case len(sec) >= 7 && sec[2] == "logs" && sec[5] == "log-group":
+			return sec[6], nil
+		default:
+			return "", errors.Wrapf(ErrUnsupportedResourceType, "%s for Logs Insights", arn)
+		}
+	}
+
+	return "", errors.Wrapf(ErrUnsupportedResourceType, "%s for Logs Insights", target.string())
+}
+
+func (x *QueryLogsInsightsScene) play(ctx context.Context) error {
+	if len(x.targets) == 0 {
+		return errors.New("No target of Logs Insights query")
+	}
+
+	var groups []string
+	for _, target := range x.targets {
+		group, err := logGroupName(target, x.gp)
+		if err != nil {
+			return err
+		}
+		groups = append(groups, group)
+	}
+
+	query, err := x.render(ctx, x.query)
+	if err != nil {
+		return err
+	}
+
+	err = x.poll(ctx, func(ctx context.Context) (bool, string, error) {
+		rows, err := x.runQuery(ctx, groups, query)
+		if err != nil {
+			if aerr, ok := errors.Cause(err).(awserr.Error); ok &&
+				aerr.Code() == cloudwatchlogs.ErrCodeResourceNotFoundException {
+				// Log group is not created until the function writes logs.
+				return false, aerr.Message(), nil
+			}
+			return false, "", err
+		}
+		return x.match(ctx, rows)
+	})
+	if err != nil {
+		return errors.Wrap(err, "No expected result of Logs Insights query")
+	}
+	return nil
+}
+
+// runQuery starts query and waits for its completion.
+func (x *QueryLogsInsightsScene) runQuery(ctx context.Context, groups []string, query string) ([]LogsInsightsRow, error) {
+	client := x.clients().CloudWatchLogs
+	input := &cloudwatchlogs.StartQueryInput{
+		LogGroupNames: aws.StringSlice(groups),
+		QueryString:   aws.String(query),
+		StartTime:     aws.Int64(x.startTime().Add(time.Minute * -1).Unix()),
+		EndTime:       aws.Int64(time.Now().UTC().Add(time.Minute * 1).Unix()),
+	}
+
+	x.log().WithField("input", input).Debug("Call StartQuery")
+	started, err := client.StartQueryWithContext(ctx, input)
+	if err != nil {
+		return nil, errors.Wrap(err, "Fail to start Logs Insights query")
+	}
+	queryID := aws.StringValue(started.QueryId)
+
+	// The query is stopped on every exit before it finishes, e.g. cancel of
+	// ctx, error of GetQueryResults and t.FailNow in the scene.
+	finished := false
+	defer func() {
+		if !finished {
+			x.stopQuery(ctx, queryID)
+		}
+	}()
+
+	// GetQueryResults is polled by Interval of WaitPolicy up to 1 second.
+	interval := x.waitPolicy().Interval
+	if interval <= 0 || interval > time.Second {
+		interval = time.Second
+	}
+
+	for {
+		resp, err := client.GetQueryResultsWithContext(ctx, &cloudwatchlogs.GetQueryResultsInput{
+			QueryId: aws.String(queryID),
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "Fail to get results of Logs Insights query %s", queryID)
+		}
+
+		switch status := aws.StringValue(resp.Status); status {
+		case cloudwatchlogs.QueryStatusComplete:
+			finished = true
+			x.log().WithFields(logrus.Fields{
+				"queryID":    queryID,
+				"statistics": resp.Statistics,
+			}).Debug("Logs Insights query completed")
+			return toLogsInsightsRows(resp.Results), nil
+
+		case cloudwatchlogs.QueryStatusScheduled, cloudwatchlogs.QueryStatusRunning:
+			if err := sleep(ctx, interval); err != nil {
+				return nil, err
+			}
+
+		default:
+			finished = true
+			return nil, fmt.Errorf("Logs Insights query %s is %s", queryID, status)
+		}
+	}
+}
+
+// stopQuery stops running query after cancel of the run.
+func (x *QueryLogsInsightsScene) stopQuery(ctx context.Context, queryID string) {
+	sctx, cancel := context.WithTimeout(detachedContext{parent: ctx}, 5*time.Second)
+	defer cancel()
+	if _, err := x.clients().CloudWatchLogs.StopQueryWithContext(sctx, &cloudwatchlogs.StopQueryInput{
+		QueryId: aws.String(queryID),
+	}); err != nil {
+		x.log().WithError(err).Warn("Fail to stop Logs Insights query")
+	}
+}
+
+func toLogsInsightsRows(results [][]*cloudwatchlogs.ResultField) []LogsInsightsRow {
+	rows := []LogsInsightsRow{}
+	for _, fields := range results {
+		row := LogsInsightsRow{}
+		for _, field := range fields {
+			// @ptr is internal pointer to the log event.
+			if name := aws.StringValue(field.Field); name != "@ptr" {
+				row[name] = aws.StringValue(field.Value)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// match checks rows by expectations and callback. It also returns text of
+// the result for PollingTimeoutError.
+func (x *QueryLogsInsightsScene) match(ctx context.Context, rows []LogsInsightsRow) (bool, string, error) {
+	raw, err := json.Marshal(rows)
+	if err != nil {
+		return false, "", errors.Wrap(err, "Fail to marshal Logs Insights result")
+	}
+	if err := x.verify(ctx, raw); err != nil {
+		if !isMismatch(err) {
+			return false, "", err
+		}
+		return false, describeMismatch(raw, err), nil
+	}
+
+	if x.callback == nil {
+		return x.expected() || len(rows) > 0, string(raw), nil
+	}
+	ok, err := x.callback(rows)
+	if err != nil {
+		return false, string(raw), errors.Wrap(err, "Rejected by callback")
+	}
+	return ok, string(raw), nil
+}
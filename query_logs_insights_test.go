@@ -0,0 +1,216 @@
+package generalprobe_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs/cloudwatchlogsiface"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gp "github.com/m-mizutani/generalprobe"
+	"github.com/m-mizutani/generalprobe/fake"
+)
+
+func TestQueryLogsInsights(t *testing.T) {
+	backend, _ := newFakeStack(t)
+	group := backend.AddLogGroup("AppLogs")
+
+	var workers []gp.Target
+	for i := 0; i < 3; i++ {
+		logicalID := fmt.Sprintf("Worker%d", i)
+		backend.AddFunction(logicalID, func(ctx context.Context, payload []byte) ([]byte, error) {
+			var req struct {
+				ID string `json:"id"`
+			}
+			if err := json.Unmarshal(payload, &req); err != nil {
+				return nil, err
+			}
+			fake.Logf(ctx, `{"level":"info","run_id":"%s","event":"processed"}`, req.ID)
+			return []byte(`{}`), nil
+		})
+		workers = append(workers, gp.LogicalID(logicalID))
+	}
+
+	// Resources of the stack are loaded by New.
+	probe, err := gp.New(fakeRegion, fakeStackName, gp.WithClients(backend.Clients()),
+		gp.WithWaitPolicy(gp.WaitPolicy{Interval: 100 * time.Millisecond, MaxAttempts: 20}))
+	require.NoError(t, err)
+
+	var playbook []gp.Scene
+	for _, worker := range workers {
+		playbook = append(playbook, gp.InvokeLambda(worker, nil).Event(map[string]string{"id": "{{ runID }}"}).Template())
+	}
+
+	t.Run("aggregate across functions", func(t *testing.T) {
+		type result struct {
+			Processed int `json:"processed"`
+			Functions int `json:"functions"`
+		}
+		var results []result
+		scene := gp.QueryLogsInsightsRows(workers, `filter run_id = "{{ runID }}" and event = "processed"
+			| stats count(*) as processed, count_distinct(@log) as functions`,
+			func(rows []result) (bool, error) {
+				results = rows
+				return len(rows) > 0, nil
+			})
+
+		require.NoError(t, probe.Play(append(playbook, scene)))
+		assert.Equal(t, []result{{Processed: 3, Functions: 3}}, results)
+		assert.Equal(t, 1, probe.LastReport().Scenes[3].Attempts)
+	})
+
+	t.Run("REPORT metrics", func(t *testing.T) {
+		scene := gp.QueryLogsInsights(workers, `filter @type = "REPORT" | stats max(@duration) as max_duration`,
+			func(rows []gp.LogsInsightsRow) (bool, error) {
+				require.Equal(t, 1, len(rows))
+				d, err := rows[0].Float("max_duration")
+				require.NoError(t, err)
+				if d > 500 {
+					return false, fmt.Errorf("too slow: %f ms", d)
+				}
+				return true, nil
+			})
+		require.NoError(t, probe.Play(append(playbook, scene)))
+	})
+
+	t.Run("log group", func(t *testing.T) {
+		backend.PutLog(group, "app", "order-1 accepted")
+		backend.PutLog(group, "app", "order-2 accepted")
+		backend.PutLog(group, "app", "health check")
+
+		var timestamp time.Time
+		scene := gp.QueryLogsInsights([]gp.Target{gp.LogicalID("AppLogs")},
+			`fields @timestamp, @message | filter @message like /order-\d+/ | sort @message desc | limit 1`,
+			func(rows []gp.LogsInsightsRow) (bool, error) {
+				var err error
+				timestamp, err = rows[0].Time("@timestamp")
+				return true, err
+			}).Expect(gp.PathEquals("$[0]['@message']", "order-2 accepted"))
+		require.NoError(t, probe.Play([]gp.Scene{scene}))
+		assert.WithinDuration(t, time.Now().UTC(), timestamp, time.Minute)
+		assert.Contains(t, probe.LastReport().Scenes[0].Target, "arn:aws:logs:")
+	})
+
+	t.Run("no expected result", func(t *testing.T) {
+		err := probe.Play([]gp.Scene{
+			gp.QueryLogsInsights(workers, `filter run_id = "nothing"`, nil).
+				Wait(gp.WaitPolicy{Interval: time.Millisecond, MaxAttempts: 2}),
+		})
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, gp.ErrPollingTimeout))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		err := probe.Play([]gp.Scene{gp.QueryLogsInsights([]gp.Target{gp.LogicalID("ResultStore")}, "fields @message", nil)})
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, gp.ErrUnsupportedResourceType))
+
+		err = probe.Play([]gp.Scene{gp.QueryLogsInsights(workers, "parse @message 'x'", nil)})
+		require.Error(t, err)
+		assert.False(t, errors.Is(err, gp.ErrPollingTimeout))
+	})
+}
+
+// interruptedLogs calls interrupt instead of GetQueryResults if it is set
+// and records StopQuery calls.
+type interruptedLogs struct {
+	cloudwatchlogsiface.CloudWatchLogsAPI
+	interrupt func(ctx aws.Context) error
+	stopped   []string
+}
+
+func (x *interruptedLogs) GetQueryResultsWithContext(ctx aws.Context, input *cloudwatchlogs.GetQueryResultsInput, opts ...request.Option) (*cloudwatchlogs.GetQueryResultsOutput, error) {
+	if x.interrupt == nil {
+		return x.CloudWatchLogsAPI.GetQueryResultsWithContext(ctx, input, opts...)
+	}
+	return nil, x.interrupt(ctx)
+}
+
+func (x *interruptedLogs) StopQueryWithContext(ctx aws.Context, input *cloudwatchlogs.StopQueryInput, opts ...request.Option) (*cloudwatchlogs.StopQueryOutput, error) {
+	x.stopped = append(x.stopped, aws.StringValue(input.QueryId))
+	return x.CloudWatchLogsAPI.StopQueryWithContext(ctx, input, opts...)
+}
+
+// newInterruptedProbe returns a probe whose CloudWatch Logs client is
+// interruptedLogs. The log group of TestHandler is created for the query.
+func newInterruptedProbe(t *testing.T, interrupt func(ctx aws.Context) error) (*gp.Generalprobe, *interruptedLogs) {
+	backend, probe := newFakeStack(t)
+	backend.PutLog("/aws/lambda/"+probe.LookupID("TestHandler"), "app", "started")
+
+	client := &interruptedLogs{
+		CloudWatchLogsAPI: backend.Clients().CloudWatchLogs,
+		interrupt:         interrupt,
+	}
+	probe, err := gp.New(fakeRegion, fakeStackName, gp.WithClients(backend.Clients()),
+		gp.WithClients(gp.Clients{CloudWatchLogs: client}))
+	require.NoError(t, err)
+	return probe, client
+}
+
+func TestQueryLogsInsightsStop(t *testing.T) {
+	target := []gp.Target{gp.LogicalID("TestHandler")}
+
+	t.Run("error of GetQueryResults", func(t *testing.T) {
+		probe, client := newInterruptedProbe(t, func(ctx aws.Context) error {
+			return errors.New("throttled")
+		})
+		err := probe.Play([]gp.Scene{gp.QueryLogsInsights(target, "fields @message", nil)})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "throttled")
+		assert.Equal(t, 1, len(client.stopped))
+	})
+
+	t.Run("cancel during GetQueryResults", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		probe, client := newInterruptedProbe(t, func(ctx aws.Context) error {
+			cancel()
+			return ctx.Err()
+		})
+		err := probe.PlayContext(ctx, []gp.Scene{gp.QueryLogsInsights(target, "fields @message", nil)})
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, context.Canceled))
+		assert.Equal(t, 1, len(client.stopped))
+	})
+
+	t.Run("not stopped after completion", func(t *testing.T) {
+		probe, client := newInterruptedProbe(t, nil)
+		require.NoError(t, probe.Play([]gp.Scene{
+			gp.QueryLogsInsights(target, "fields @message", func(rows []gp.LogsInsightsRow) (bool, error) {
+				return true, nil
+			}),
+		}))
+		assert.Empty(t, client.stopped)
+	})
+}
+
+func TestLoadPlaybookLogsInsights(t *testing.T) {
+	_, probe := newFakeStack(t)
+
+	playbook, err := gp.LoadPlaybook(writePlaybook(t, `
+scenes:
+  - type: publish_sns
+    target: { logical_id: Trigger }
+    message: { id: "{{ runID }}" }
+  - type: query_logs_insights
+    targets:
+      - { logical_id: TestHandler }
+    query: 'filter @message like "{{ runID }}" | stats count(*) as n'
+    expect:
+      path:
+        - { path: "$[0].n", equals: "1" }
+`))
+	require.NoError(t, err)
+	require.NoError(t, probe.Play(playbook))
+
+	_, err = gp.LoadPlaybook(writePlaybook(t, "scenes:\n  - type: query_logs_insights\n    targets: [{ logical_id: X }]\n"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,185 @@
+package generalprobe
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Result of a scene or a whole playbook in Report.
+const (
+	ResultPassed  = "passed"
+	ResultFailed  = "failed"
+	ResultSkipped = "skipped"
+)
+
+// Report is a record of a run of playbook. It is passed to Reporter after
+// playing all scenes including teardown.
+type Report struct {
+	StackName string         `json:"stack_name"`
+	RunID     string         `json:"run_id"`
+	StartTime time.Time      `json:"start_time"`
+	EndTime   time.Time      `json:"end_time"`
+	Result    string         `json:"result"`
+	Error     string         `json:"error,omitempty"`
+	Scenes    []*SceneReport `json:"scenes"`
+}
+
+// Duration returns elapsed time of the run.
+func (x *Report) Duration() time.Duration { return x.EndTime.Sub(x.StartTime) }
+
+// Count returns number of scenes that have result.
+func (x *Report) Count(result string) int {
+	n := 0
+	for _, scene := range x.Scenes {
+		if scene.Result == result {
+			n++
+		}
+	}
+	return n
+}
+
+// SceneReport is a record of a scene. Scenes in composite scenes such as
+// Sequence and Parallel are also recorded with nested step like "2.1".
+type SceneReport struct {
+	SceneInfo
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	// Attempts is number of attempts of polling scenes. It is 0 for other
+	// scenes.
+	Attempts int    `json:"attempts,omitempty"`
+	Result   string `json:"result"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Duration returns elapsed time of the scene.
+func (x *SceneReport) Duration() time.Duration { return x.EndTime.Sub(x.StartTime) }
+
+// Reporter writes Report of a run, e.g. as JUnit XML, JSON and Markdown.
+// Reporters can be set by WithReporter or arguments of Play.
+type Reporter interface {
+	Report(report *Report) error
+}
+
+// ReporterFunc is an adapter to use a function as Reporter.
+type ReporterFunc func(report *Report) error
+
+// Report calls f(report).
+func (f ReporterFunc) Report(report *Report) error { return f(report) }
+
+// WithReporter adds reporters that are called after every Play,
+// PlayContext and PlayT.
+func WithReporter(reporters ...Reporter) Option {
+	return func(gp *Generalprobe) {
+		gp.reporters = append(gp.reporters, reporters...)
+	}
+}
+
+// LastReport returns Report of the last run. It returns nil before Play.
+func (x *Generalprobe) LastReport() *Report {
+	return x.report
+}
+
+// targetScene is a scene that accesses a resource of Target. sceneTarget
+// returns nil if the scene accesses multiple resources.
+type targetScene interface {
+	sceneTarget() Target
+}
+
+type sceneReportKey struct{}
+
+// sceneReport returns SceneReport of the playing scene, or nil.
+func sceneReport(ctx context.Context) *SceneReport {
+	r, _ := ctx.Value(sceneReportKey{}).(*SceneReport)
+	return r
+}
+
+// startReport begins a new Report.
+func (x *Generalprobe) startReport() {
+	x.report = &Report{
+		StackName: x.stackName,
+		RunID:     x.runID,
+		StartTime: time.Now().UTC(),
+	}
+
+	x.payloadMutex.Lock()
+	x.payloads = nil
+	x.payloadMutex.Unlock()
+
+	x.fireRunStart()
+}
+
+// addSceneReport appends a record of scene to Report. Scenes of Parallel
+// are added concurrently.
+func (x *Generalprobe) addSceneReport(s step, scene Scene, result string) *SceneReport {
+	r := &SceneReport{
+		SceneInfo: SceneInfo{
+			Step:     s.path,
+			Index:    s.index,
+			Teardown: s.teardown,
+			Name:     scene.string(),
+			Type:     reflect.TypeOf(scene).Elem().Name(),
+		},
+		StartTime: time.Now().UTC(),
+		Result:    result,
+	}
+	r.EndTime = r.StartTime
+
+	if ts, ok := scene.(targetScene); ok && ts.sceneTarget() != nil {
+		if arn, err := ts.sceneTarget().arn(x); err == nil {
+			r.Target = arn
+		}
+	}
+
+	x.reportMutex.Lock()
+	defer x.reportMutex.Unlock()
+	if x.report != nil {
+		x.report.Scenes = append(x.report.Scenes, r)
+	}
+	return r
+}
+
+// recordScene adds a record of the scene to be played and returns ctx that
+// carries it to count attempts of polling, and function to set result. The
+// record is failed until finish is called with nil.
+func (x *Generalprobe) recordScene(ctx context.Context, s step, scene Scene) (context.Context, func(err error)) {
+	r := x.addSceneReport(s, scene, ResultFailed)
+	x.fireBeforeScene(r)
+
+	finish := func(err error) {
+		r.EndTime = time.Now().UTC()
+		if err != nil {
+			r.Error = err.Error()
+		} else {
+			r.Result = ResultPassed
+		}
+		x.fireAfterScene(r, err)
+	}
+	return context.WithValue(ctx, sceneReportKey{}, r), finish
+}
+
+// finishReport completes Report by err of the run and passes it to
+// reporters of Generalprobe and additional reporters.
+func (x *Generalprobe) finishReport(err error, reporters []Reporter) error {
+	report := x.report
+	report.EndTime = time.Now().UTC()
+	report.Result = ResultPassed
+	if err != nil {
+		report.Result = ResultFailed
+		report.Error = err.Error()
+	}
+
+	var all []Reporter
+	all = append(all, x.reporters...)
+	all = append(all, reporters...)
+	defer x.fireRunEnd(err)
+
+	for _, reporter := range all {
+		if err := reporter.Report(report); err != nil {
+			return errors.Wrap(err, "Fail to write report")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package generalprobe_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gp "github.com/m-mizutani/generalprobe"
+)
+
+func TestReport(t *testing.T) {
+	backend, probe := newFakeStack(t)
+	require.NoError(t, backend.PutItem(probe.LookupID("ResultStore"), map[string]interface{}{
+		"result_id": "r1", "status": "done",
+	}))
+
+	err := probe.Play([]gp.Scene{
+		gp.GetDynamoRecord(gp.LogicalID("ResultStore"), nil).Key("result_id", "r1"),
+		gp.Sequence("check",
+			gp.AdLib(func() {}),
+			gp.AdLibE(func() error { return errors.New("broken") }),
+		),
+		gp.AdLib(func() {}),
+		gp.Teardown(gp.AdLib(func() {})),
+	})
+	require.Error(t, err)
+
+	report := probe.LastReport()
+	require.NotNil(t, report)
+	assert.Equal(t, gp.ResultFailed, report.Result)
+	assert.Equal(t, probe.RunID(), report.RunID)
+	assert.Contains(t, report.Error, "broken")
+
+	var steps, results []string
+	for _, scene := range report.Scenes {
+		steps = append(steps, scene.Step)
+		results = append(results, scene.Result)
+	}
+	assert.Equal(t, []string{"1", "2", "2.1", "2.2", "3", "1"}, steps)
+	assert.Equal(t, []string{"passed", "failed", "passed", "failed", "skipped", "passed"}, results)
+
+	dynamo := report.Scenes[0]
+	assert.Equal(t, "GetDynamoRecordScene", dynamo.Type)
+	assert.Contains(t, dynamo.Target, "arn:aws:dynamodb:")
+	assert.Equal(t, 1, dynamo.Attempts)
+	assert.False(t, dynamo.EndTime.Before(dynamo.StartTime))
+	assert.True(t, report.Scenes[5].Teardown)
+}
+
+func TestReporters(t *testing.T) {
+	_, probe := newFakeStack(t)
+
+	var junit, doc, md bytes.Buffer
+	err := probe.Play([]gp.Scene{
+		gp.InvokeLambda(gp.LogicalID("TestHandler"), nil).SnsEvent(map[string]string{"id": "x"}),
+		gp.AdLibE(func() error { return errors.New("broken | pipe") }),
+		gp.AdLib(func() {}),
+	}, gp.JUnitReporter(&junit), gp.JSONReporter(&doc), gp.MarkdownReporter(&md))
+	require.Error(t, err)
+
+	t.Run("JUnit", func(t *testing.T) {
+		var suites struct {
+			Suites []struct {
+				Tests     int `xml:"tests,attr"`
+				Failures  int `xml:"failures,attr"`
+				Skipped   int `xml:"skipped,attr"`
+				TestCases []struct {
+					Name    string    `xml:"name,attr"`
+					Failure *struct{} `xml:"failure"`
+				} `xml:"testcase"`
+			} `xml:"testsuite"`
+		}
+		require.NoError(t, xml.Unmarshal(junit.Bytes(), &suites))
+		require.Equal(t, 1, len(suites.Suites))
+		suite := suites.Suites[0]
+		assert.Equal(t, 3, suite.Tests)
+		assert.Equal(t, 1, suite.Failures)
+		assert.Equal(t, 1, suite.Skipped)
+		assert.Contains(t, suite.TestCases[0].Name, "1 Invoke Lambda")
+		assert.NotNil(t, suite.TestCases[1].Failure)
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		var report gp.Report
+		require.NoError(t, json.Unmarshal(doc.Bytes(), &report))
+		assert.Equal(t, gp.ResultFailed, report.Result)
+		require.Equal(t, 3, len(report.Scenes))
+		assert.Equal(t, "InvokeLambdaScene", report.Scenes[0].Type)
+		assert.Contains(t, report.Scenes[0].Target, "arn:aws:lambda:")
+	})
+
+	t.Run("Markdown", func(t *testing.T) {
+		assert.Contains(t, md.String(), "1 passed, 1 failed, 1 skipped")
+		assert.Contains(t, md.String(), "| **failed** |")
+		assert.Contains(t, md.String(), "broken | pipe")
+	})
+}
+
+func TestReporterError(t *testing.T) {
+	_, probe := newFakeStack(t)
+	failing := gp.ReporterFunc(func(report *gp.Report) error { return errors.New("disk full") })
+
+	err := probe.Play([]gp.Scene{gp.AdLib(func() {})}, failing)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "disk full")
+
+	// Failure of the playbook is prior to error of reporter.
+	err = probe.Play([]gp.Scene{gp.AdLibE(func() error { return errors.New("broken") })}, failing)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "broken")
+}
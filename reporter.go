@@ -0,0 +1,174 @@
+package generalprobe
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// JSONReporter writes Report as an indented JSON document to w.
+func JSONReporter(w io.Writer) Reporter {
+	return ReporterFunc(func(report *Report) error {
+		raw, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "Fail to marshal report to JSON")
+		}
+		if _, err := w.Write(append(raw, '\n')); err != nil {
+			return errors.Wrap(err, "Fail to write JSON report")
+		}
+		return nil
+	})
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	TestCases  []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *struct{}     `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// JUnitReporter writes Report as JUnit XML to w for CI. Each scene is a
+// testcase named like "2.1 Invoke Lambda ..." and the playbook is a
+// testsuite named by the stack.
+func JUnitReporter(w io.Writer) Reporter {
+	return ReporterFunc(func(report *Report) error {
+		suite := junitTestSuite{
+			Name:      report.StackName,
+			Tests:     len(report.Scenes),
+			Failures:  report.Count(ResultFailed),
+			Skipped:   report.Count(ResultSkipped),
+			Time:      junitSeconds(report.Duration()),
+			Timestamp: report.StartTime.Format(time.RFC3339),
+			Properties: []junitProperty{
+				{Name: "run_id", Value: report.RunID},
+			},
+		}
+
+		for _, scene := range report.Scenes {
+			tc := junitTestCase{
+				Name:      fmt.Sprintf("%s %s", sceneLabel(scene), scene.Name),
+				ClassName: "generalprobe." + scene.Type,
+				Time:      junitSeconds(scene.Duration()),
+			}
+			if scene.Target != "" {
+				tc.SystemOut = fmt.Sprintf("target: %s\n", scene.Target)
+			}
+			if scene.Attempts > 0 {
+				tc.SystemOut += fmt.Sprintf("attempts: %d\n", scene.Attempts)
+			}
+
+			switch scene.Result {
+			case ResultFailed:
+				tc.Failure = &junitFailure{Message: firstLine(scene.Error), Body: scene.Error}
+			case ResultSkipped:
+				tc.Skipped = &struct{}{}
+			}
+			suite.TestCases = append(suite.TestCases, tc)
+		}
+
+		raw, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "Fail to marshal report to JUnit XML")
+		}
+		if _, err := io.WriteString(w, xml.Header+string(raw)+"\n"); err != nil {
+			return errors.Wrap(err, "Fail to write JUnit XML report")
+		}
+		return nil
+	})
+}
+
+// MarkdownReporter writes summary of Report as Markdown to w, e.g. for
+// comment of pull request.
+func MarkdownReporter(w io.Writer) Reporter {
+	return ReporterFunc(func(report *Report) error {
+		var b strings.Builder
+		fmt.Fprintf(&b, "## Generalprobe: %s %s\n\n", report.StackName, report.Result)
+		fmt.Fprintf(&b, "Run ID `%s`, %d passed, %d failed, %d skipped in %s\n\n",
+			report.RunID, report.Count(ResultPassed), report.Count(ResultFailed),
+			report.Count(ResultSkipped), report.Duration().Round(time.Millisecond))
+
+		b.WriteString("| Step | Scene | Target | Attempts | Duration | Result |\n")
+		b.WriteString("|:-----|:------|:-------|---------:|---------:|:-------|\n")
+		for _, scene := range report.Scenes {
+			result := scene.Result
+			if result == ResultFailed {
+				result = "**" + result + "**"
+			}
+			attempts := ""
+			if scene.Attempts > 0 {
+				attempts = fmt.Sprint(scene.Attempts)
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %s |\n", sceneLabel(scene),
+				markdownCell(scene.Name), markdownCell(scene.Target), attempts,
+				scene.Duration().Round(time.Millisecond), result)
+		}
+
+		if report.Error != "" {
+			fmt.Fprintf(&b, "\n```\n%s\n```\n", report.Error)
+		}
+
+		if _, err := io.WriteString(w, b.String()); err != nil {
+			return errors.Wrap(err, "Fail to write Markdown report")
+		}
+		return nil
+	})
+}
+
+// sceneLabel returns step of the scene with prefix for teardown.
+func sceneLabel(scene *SceneReport) string {
+	if scene.Teardown {
+		return "teardown " + scene.Step
+	}
+	return scene.Step
+}
+
+func markdownCell(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "`" + strings.ReplaceAll(s, "|", "\\|") + "`"
+}
+
+func firstLine(s string) string {
+	if idx := strings.Index(s, "\n"); idx >= 0 {
+		return s[:idx]
+	}
+	return s
+}
@@ -12,7 +12,7 @@ import (
 )
 
 func TestSimplePlayBook(t *testing.T) {
-	params := loadTestParameters()
+	params := loadTestParameters(t)
 
 	id := uuid.New().String()
 	request := struct {
@@ -43,6 +43,8 @@ func TestSimplePlayBook(t *testing.T) {
 		}),
 	}
 
-	err := gp.New(params.Region, params.StackName).Play(scenario)
+	probe, err := gp.New(params.Region, params.StackName)
+	require.NoError(t, err)
+	err = probe.Play(scenario)
 	require.NoError(t, err)
 }
@@ -1,15 +1,17 @@
 package generalprobe
 
 import (
+	"context"
+	"encoding/json"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
 // Scene is a part of playbook of test.
 type Scene interface {
-	play() error
+	play(ctx context.Context) error
 	setGeneralprobe(gp *Generalprobe)
 	string() string
 }
@@ -18,38 +20,97 @@ type baseScene struct {
 	gp *Generalprobe
 }
 
+// pollingScene is a mixin of scenes that retry until the expected result
+// comes. WaitPolicy of Generalprobe is used unless it is overridden by
+// policy, limit and interval.
 type pollingScene struct {
 	baseScene
+	policy   *WaitPolicy
 	limit    int
-	interval int
+	interval time.Duration
 }
 
-// Limit sets maximum retry number of the scene. Basically if the limit
-// exceeded, the test will be fail by returning error from generalprobe.Run()
-func (x *pollingScene) Limit(limit int) Scene {
-	x.limit = limit
-	return x
+func (x *pollingScene) setWait(policy WaitPolicy) { x.policy = &policy }
+func (x *pollingScene) setLimit(limit int)        { x.limit = limit }
+func (x *pollingScene) setInterval(seconds int) {
+	x.interval = time.Second * time.Duration(seconds)
 }
 
-// Interval sets seconds of query interval.
-func (x *pollingScene) Interval(limit int) Scene {
-	x.limit = limit
-	return x
-}
-
-func (x *pollingScene) play() error {
-	return errors.New("pollingScene without mixin can no be used")
-}
+func (x *pollingScene) waitPolicy() WaitPolicy {
+	policy := x.gp.waitPolicy
+	if x.policy != nil {
+		policy = *x.policy
+	}
+	if x.limit > 0 {
+		policy.MaxAttempts = x.limit
+	}
+	if x.interval > 0 {
+		policy.Interval = x.interval
+	}
 
-// String returns explain text
-func (x *pollingScene) string() string {
-	return "pollingScene"
+	// Zero Interval causes tight loop against AWS and no limit of attempts
+	// and time causes endless polling.
+	def := DefaultWaitPolicy()
+	if policy.Interval <= 0 {
+		policy.Interval = def.Interval
+	}
+	if policy.MaxAttempts <= 0 && policy.Timeout <= 0 {
+		policy.MaxAttempts = def.MaxAttempts
+	}
+	return policy
 }
 
 func (x *baseScene) setGeneralprobe(gp *Generalprobe) { x.gp = gp }
+func (x *baseScene) log() *logrus.Logger              { return x.gp.logger }
 func (x *baseScene) region() string                   { return x.gp.awsRegion }
-func (x *baseScene) awsSession() *session.Session     { return x.gp.awsSession }
+func (x *baseScene) clients() *Clients                { return &x.gp.clients }
 func (x *baseScene) startTime() time.Time             { return x.gp.StartTime }
+func (x *baseScene) vars() *Vars                      { return x.gp.vars }
+func (x *baseScene) render(ctx context.Context, text string) (string, error) {
+	return x.gp.render(ctx, text)
+}
 func (x *baseScene) lookupPhysicalID(logicalID string) string {
 	return x.gp.LookupID(logicalID)
 }
+
+// payloadTemplate is a mixin of scenes that send payload. Templates in the
+// payload are rendered only if Template is called because the payload may
+// have "{{" as data.
+type payloadTemplate struct {
+	templated bool
+}
+
+// renderPayload converts msg to string by toMessage. If templated, templates
+// in msg are rendered by Generalprobe.renderMessage.
+func (x *payloadTemplate) renderPayload(ctx context.Context, gp *Generalprobe, msg interface{}) (string, error) {
+	if !x.templated {
+		return toMessage(msg)
+	}
+	return gp.renderMessage(ctx, msg)
+}
+
+// renderPayloadData marshals v to JSON. If templated, string values in v are
+// rendered.
+func (x *payloadTemplate) renderPayloadData(ctx context.Context, gp *Generalprobe, v interface{}) ([]byte, error) {
+	if !x.templated {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Fail to marshal message: %v", v)
+		}
+		return raw, nil
+	}
+	return gp.renderData(ctx, v)
+}
+
+// sleep waits for the duration or returns error if ctx is done before that.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
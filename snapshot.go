@@ -0,0 +1,152 @@
+package generalprobe
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// SnapshotDir is directory of golden files of Snapshot. It is relative to
+// working directory of the test, i.e. the package directory in go test.
+const SnapshotDir = "testdata/snapshots"
+
+// SnapshotIgnored replaces values of ignore paths in snapshots.
+const SnapshotIgnored = "<ignored>"
+
+// snapshotUpdateEnv is environment variable to enable update mode of
+// snapshots without -update flag.
+const snapshotUpdateEnv = "GENERALPROBE_UPDATE_SNAPSHOTS"
+
+// updateSnapshots returns true if -update flag is defined and set by the
+// test, or GENERALPROBE_UPDATE_SNAPSHOTS is not empty.
+func updateSnapshots() bool {
+	if os.Getenv(snapshotUpdateEnv) != "" {
+		return true
+	}
+	if f := flag.Lookup("update"); f != nil {
+		if getter, ok := f.Value.(flag.Getter); ok {
+			if v, ok := getter.Get().(bool); ok {
+				return v
+			}
+		}
+	}
+	return false
+}
+
+// Snapshot expects that the result equals golden file
+// testdata/snapshots/<name>.json. Values at ignorePaths (JSONPath, * is
+// available as wildcard such as $.items[*].id) are replaced with
+// "<ignored>" before comparison. In update mode (-update flag or
+// GENERALPROBE_UPDATE_SNAPSHOTS), the golden file is written with the
+// result instead of comparison. A result that is not JSON is stored as
+// JSON string.
+func Snapshot(name string, ignorePaths ...string) Matcher {
+	matcherName := fmt.Sprintf("snapshot %s", name)
+	path := filepath.Join(SnapshotDir, filepath.FromSlash(name)+".json")
+
+	return MatcherFunc(func(data []byte) error {
+		var actual interface{}
+		if err := json.Unmarshal(data, &actual); err != nil {
+			actual = string(data)
+		}
+		for _, ignorePath := range ignorePaths {
+			keys, err := parseJSONPath(ignorePath)
+			if err != nil {
+				return errors.Wrapf(err, "Invalid ignore path of %s", matcherName)
+			}
+			actual = replaceJSONPath(actual, keys, SnapshotIgnored)
+		}
+
+		if updateSnapshots() {
+			return writeSnapshot(path, actual)
+		}
+
+		raw, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			return &MatchError{
+				Matcher: matcherName,
+				Message: fmt.Sprintf("%s does not exist, run test with -update to create it", path),
+			}
+		} else if err != nil {
+			return errors.Wrapf(err, "Fail to read snapshot: %s", path)
+		}
+
+		var expected interface{}
+		if err := json.Unmarshal(raw, &expected); err != nil {
+			return errors.Wrapf(err, "Fail to parse snapshot: %s", path)
+		}
+
+		if !reflect.DeepEqual(expected, actual) {
+			return &MatchError{
+				Matcher:  matcherName,
+				Message:  fmt.Sprintf("result does not match %s", path),
+				Expected: expected,
+				Actual:   actual,
+			}
+		}
+		return nil
+	})
+}
+
+func writeSnapshot(path string, v interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrapf(err, "Fail to create snapshot directory: %s", path)
+	}
+	// Disable HTML escape to keep "<ignored>" readable in golden file.
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return errors.Wrapf(err, "Fail to marshal snapshot: %s", path)
+	}
+
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return errors.Wrapf(err, "Fail to write snapshot: %s", path)
+	}
+	logger.WithField("path", path).Info("Updated snapshot")
+	return nil
+}
+
+// replaceJSONPath returns data that values at keys are replaced with value.
+// Missing fields and indices are ignored.
+func replaceJSONPath(data interface{}, keys []interface{}, value interface{}) interface{} {
+	if len(keys) == 0 {
+		return value
+	}
+
+	switch v := data.(type) {
+	case map[string]interface{}:
+		switch key := keys[0].(type) {
+		case string:
+			if child, ok := v[key]; ok {
+				v[key] = replaceJSONPath(child, keys[1:], value)
+			}
+		case jsonPathWildcard:
+			for name, child := range v {
+				v[name] = replaceJSONPath(child, keys[1:], value)
+			}
+		}
+
+	case []interface{}:
+		switch key := keys[0].(type) {
+		case int:
+			if 0 <= key && key < len(v) {
+				v[key] = replaceJSONPath(v[key], keys[1:], value)
+			}
+		case jsonPathWildcard:
+			for i := range v {
+				v[i] = replaceJSONPath(v[i], keys[1:], value)
+			}
+		}
+	}
+
+	return data
+}
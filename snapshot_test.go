@@ -0,0 +1,103 @@
+package generalprobe_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gp "github.com/m-mizutani/generalprobe"
+)
+
+// chdirTemp changes working directory to a temporary directory to write
+// snapshots.
+func chdirTemp(t *testing.T) string {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+func TestSnapshot(t *testing.T) {
+	dir := chdirTemp(t)
+	data := []byte(`{"id":"abc","ts":1700000000,"items":[{"id":"x","size":1},{"id":"y","size":2}]}`)
+	matcher := gp.Snapshot("sample/record", "$.ts", "$.items[*].id")
+
+	err := matcher.Match(data)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, gp.ErrUnexpectedResult))
+	assert.Contains(t, err.Error(), "-update")
+
+	t.Setenv("GENERALPROBE_UPDATE_SNAPSHOTS", "1")
+	require.NoError(t, matcher.Match(data))
+	raw, err := ioutil.ReadFile(filepath.Join(dir, "testdata", "snapshots", "sample", "record.json"))
+	require.NoError(t, err)
+	assert.Contains(t, string(raw), `"ts": "<ignored>"`)
+	assert.Contains(t, string(raw), `"id": "abc"`)
+	assert.NotContains(t, string(raw), `"id": "x"`)
+
+	t.Setenv("GENERALPROBE_UPDATE_SNAPSHOTS", "")
+	// Ignored fields can be changed.
+	assert.NoError(t, matcher.Match([]byte(`{"id":"abc","ts":1800000000,"items":[{"id":"z","size":1},{"id":"w","size":2}]}`)))
+
+	err = matcher.Match([]byte(`{"id":"abc","ts":1,"items":[{"id":"x","size":1},{"id":"y","size":3}]}`))
+	var matchErr *gp.MatchError
+	require.True(t, errors.As(err, &matchErr))
+	assert.Contains(t, matchErr.Diff(), `-      "size": 2`)
+	assert.Contains(t, matchErr.Diff(), `+      "size": 3`)
+
+	t.Run("not JSON", func(t *testing.T) {
+		t.Setenv("GENERALPROBE_UPDATE_SNAPSHOTS", "1")
+		require.NoError(t, gp.Snapshot("text").Match([]byte("plain text")))
+		t.Setenv("GENERALPROBE_UPDATE_SNAPSHOTS", "")
+		assert.NoError(t, gp.Snapshot("text").Match([]byte("plain text")))
+		assert.Error(t, gp.Snapshot("text").Match([]byte("other text")))
+	})
+}
+
+func TestMatchSnapshot(t *testing.T) {
+	chdirTemp(t)
+	backend, probe := newFakeStack(t)
+	require.NoError(t, backend.PutItem(probe.LookupID("ResultStore"), map[string]interface{}{
+		"result_id": "r1", "status": "done", "updated_at": "2018-01-01T00:00:00Z",
+	}))
+
+	playbook := []gp.Scene{
+		gp.InvokeLambda(gp.LogicalID("TestHandler"), nil).
+			SnsEvent(map[string]string{"id": "x"}).
+			MatchSnapshot("lambda"),
+		gp.GetDynamoRecord(gp.LogicalID("ResultStore"), nil).
+			Key("result_id", "r1").
+			MatchSnapshot("dynamo", "$.updated_at"),
+		gp.PutKinesisStreamRecord(gp.LogicalID("ResultStream"), []byte(`{"seq":1}`)),
+		gp.GetKinesisStreamRecord(gp.LogicalID("ResultStream"), nil).
+			MatchSnapshot("kinesis"),
+	}
+
+	t.Setenv("GENERALPROBE_UPDATE_SNAPSHOTS", "1")
+	require.NoError(t, probe.Play(playbook))
+	for _, name := range []string{"lambda", "dynamo", "kinesis"} {
+		assert.FileExists(t, filepath.Join("testdata", "snapshots", name+".json"))
+	}
+
+	t.Setenv("GENERALPROBE_UPDATE_SNAPSHOTS", "")
+	_, probe = newFakeStack(t)
+	err := probe.Play([]gp.Scene{
+		gp.InvokeLambda(gp.LogicalID("TestHandler"), nil).
+			SnsEvent(map[string]string{"id": "x"}).
+			MatchSnapshot("lambda"),
+		gp.InvokeLambda(gp.LogicalID("TestHandler"), nil).
+			SnsEvent(map[string]string{"id": "x"}).
+			MatchSnapshot("dynamo"),
+	})
+	var sceneErr *gp.SceneError
+	require.True(t, errors.As(err, &sceneErr))
+	assert.Equal(t, 2, sceneErr.Step)
+	assert.True(t, errors.Is(err, gp.ErrUnexpectedResult))
+}
@@ -4,14 +4,15 @@ import (
 	"fmt"
 	"strings"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/pkg/errors"
 )
 
 // Target is resource identity interface. LogicalID and Arn can be used
 // to specify a resource on CloudFormation or not.
 type Target interface {
-	arn(gp *Generalprobe) string
-	name(gp *Generalprobe) string
+	arn(gp *Generalprobe) (string, error)
+	name(gp *Generalprobe) (string, error)
+	string() string
 }
 
 type baseTarget struct{}
@@ -28,9 +29,9 @@ func newLogicalID(name string) *LogicalIDTarget {
 	return &LogicalIDTarget{LogicalID: name}
 }
 
-func (x *LogicalIDTarget) toArn(physicalID string, gp *Generalprobe) string {
+func (x *LogicalIDTarget) toArn(physicalID string, gp *Generalprobe) (string, error) {
 	if len(strings.Split(physicalID, ":")) == 6 {
-		return physicalID
+		return physicalID, nil
 	}
 
 	type serviceHint struct {
@@ -42,29 +43,52 @@ func (x *LogicalIDTarget) toArn(physicalID string, gp *Generalprobe) string {
 		"AWS::SNS::Topic":       serviceHint{"sns", ""},
 		"AWS::DynamoDB::Table":  serviceHint{"dynamodb", "table/"},
 		"AWS::Kinesis::Stream":  serviceHint{"kinesis", "stream/"},
+
+		"AWS::Cognito::UserPool": serviceHint{"cognito-idp", "userpool/"},
+		"AWS::Events::Rule":      serviceHint{"events", "rule/"},
+		"AWS::Logs::LogGroup":    serviceHint{"logs", "log-group:"},
 	}
 
 	resourceType := gp.LookupType(x.LogicalID)
+	switch resourceType {
+	case "AWS::S3::Bucket":
+		// ARN of S3 bucket has neither region nor account.
+		return fmt.Sprintf("arn:aws:s3:::%s", physicalID), nil
+
+	case "AWS::SQS::Queue":
+		// PhysicalID of SQS queue is URL such as
+		// https://sqs.<region>.amazonaws.com/<account>/<name>
+		sec := strings.Split(physicalID, "/")
+		return fmt.Sprintf("arn:aws:sqs:%s:%s:%s", gp.awsRegion, gp.awsAccount, sec[len(sec)-1]), nil
+	}
+
 	service, ok := serviceMap[resourceType]
 	if !ok {
-		log.WithFields(log.Fields{
-			"logicalID":    x.LogicalID,
-			"resourceType": resourceType,
-		}).Fatal("The resource type is not supported")
+		return "", errors.Wrapf(ErrUnsupportedResourceType, "%s of %s", resourceType, x.LogicalID)
 	}
 
 	return fmt.Sprintf("arn:aws:%s:%s:%s:%s%s", service.name, gp.awsRegion,
-		gp.awsAccount, service.prefix, physicalID)
+		gp.awsAccount, service.prefix, physicalID), nil
 }
 
-func (x *LogicalIDTarget) arn(gp *Generalprobe) string {
-	pID := gp.LookupID(x.LogicalID)
+func (x *LogicalIDTarget) arn(gp *Generalprobe) (string, error) {
+	pID, err := x.name(gp)
+	if err != nil {
+		return "", err
+	}
 	return x.toArn(pID, gp)
 }
 
-func (x *LogicalIDTarget) name(gp *Generalprobe) string {
+func (x *LogicalIDTarget) name(gp *Generalprobe) (string, error) {
 	pID := gp.LookupID(x.LogicalID)
-	return pID
+	if pID == "" {
+		return "", errors.Wrapf(ErrResourceNotFound, "LogicalID %s in stack %s", x.LogicalID, gp.stackName)
+	}
+	return pID, nil
+}
+
+func (x *LogicalIDTarget) string() string {
+	return x.LogicalID
 }
 
 // ArnTarget is not expected to be controlled outside of generalprobe package.
@@ -72,31 +96,55 @@ func (x *LogicalIDTarget) name(gp *Generalprobe) string {
 type ArnTarget struct {
 	baseTarget
 	arnData string
+	err     error
 }
 
 // Arn should be used to specify AWS resource out of CloudFormation template.
 func newArn(arn string) *ArnTarget {
+	target := &ArnTarget{arnData: arn}
 	sec := strings.Split(arn, ":")
 	if len(sec) < 6 || 8 < len(sec) {
-		log.WithField("arn", arn).Error("Invalid ARN format")
+		target.err = errors.Wrap(ErrInvalidArn, arn)
 	}
-	return &ArnTarget{arnData: arn}
+	return target
 }
 
-func (x *ArnTarget) arn(gp *Generalprobe) string {
-	return x.arnData
+func (x *ArnTarget) arn(gp *Generalprobe) (string, error) {
+	if x.err != nil {
+		return "", x.err
+	}
+	return x.arnData, nil
 }
 
-func (x *ArnTarget) name(gp *Generalprobe) string {
+func (x *ArnTarget) name(gp *Generalprobe) (string, error) {
+	if x.err != nil {
+		return "", x.err
+	}
+
 	// arn:partition:service:region:account-id:resource
 	sec := strings.Split(x.arnData, ":")
 	last := sec[len(sec)-1]
 	resName := strings.Split(last, "/")
 	if len(resName) == 2 {
-		return resName[1]
+		return resName[1], nil
 	}
 
-	return last
+	return last, nil
+}
+
+func (x *ArnTarget) string() string {
+	return x.arnData
+}
+
+// targetString returns ARN of the target for explanation text of scenes.
+// If the ARN can not be resolved, it returns identity of the target instead.
+func targetString(target Target, gp *Generalprobe) string {
+	if gp != nil {
+		if arn, err := target.arn(gp); err == nil {
+			return arn
+		}
+	}
+	return target.string()
 }
 
 // LogicalID is one of target type. LogicalID requires name of resource
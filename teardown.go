@@ -0,0 +1,60 @@
+package generalprobe
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TeardownScene has scenes to clean up resources created by the playbook.
+type TeardownScene struct {
+	scenes []Scene
+	baseScene
+}
+
+// Teardown creates a scene that has cleanup scenes. Scenes in Teardown are
+// played after all other scenes of the playbook regardless of the position
+// in the playbook, even if a scene fails or the playbook is interrupted.
+// All teardown scenes are played even if one of them fails.
+func Teardown(scenes ...Scene) *TeardownScene {
+	return &TeardownScene{scenes: scenes}
+}
+
+// String returns text explanation of the scene
+func (x *TeardownScene) string() string {
+	return fmt.Sprintf("Teardown (%d scenes)", len(x.scenes))
+}
+
+// play is called only if TeardownScene is not at top level of a playbook.
+// It plays scenes sequentially as usual.
+func (x *TeardownScene) play(ctx context.Context) error {
+	for idx, scene := range x.scenes {
+		if err := x.playChild(ctx, []int{idx}, scene); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitTeardown separates scenes in top level Teardown from other scenes.
+func splitTeardown(playbook []Scene) (scenes, teardown []Scene) {
+	for _, scene := range playbook {
+		if t, ok := scene.(*TeardownScene); ok {
+			teardown = append(teardown, t.scenes...)
+		} else {
+			scenes = append(scenes, scene)
+		}
+	}
+	return scenes, teardown
+}
+
+// detachedContext has values of parent but is never canceled. It is used
+// to play teardown scenes after the parent is canceled.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (x detachedContext) Deadline() (time.Time, bool)       { return time.Time{}, false }
+func (x detachedContext) Done() <-chan struct{}             { return nil }
+func (x detachedContext) Err() error                        { return nil }
+func (x detachedContext) Value(key interface{}) interface{} { return x.parent.Value(key) }
@@ -0,0 +1,157 @@
+package generalprobe_test
+
+import (
+	"context"
+	"runtime"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gp "github.com/m-mizutani/generalprobe"
+)
+
+func TestTeardownAfterFailure(t *testing.T) {
+	backend, probe := newFakeStack(t)
+	bucketName := probe.LookupID("ResultBucket")
+	tableName := probe.LookupID("ResultStore")
+	backend.PutObject(bucketName, probe.RunID()+"/record.json", []byte("{}"))
+	backend.PutObject(bucketName, "others/record.json", []byte("{}"))
+
+	n := 0
+	playbook := []gp.Scene{
+		gp.Teardown(
+			gp.DeleteDynamoRecord(gp.LogicalID("ResultStore"), "result_id", "{{ runID }}"),
+			gp.DeleteS3Objects(gp.LogicalID("ResultBucket"), "{{ runID }}/"),
+		),
+		gp.PublishSnsData(gp.LogicalID("Trigger"), map[string]string{"id": "{{ runID }}"}).Template(),
+		gp.PutKinesisStreamRecord(gp.LogicalID("NoSuchStream"), []byte("x")),
+		gp.AdLib(func() { n++ }),
+	}
+
+	err := probe.Play(playbook)
+	require.Error(t, err)
+
+	var sceneErr *gp.SceneError
+	require.True(t, errors.As(err, &sceneErr))
+	assert.Equal(t, 2, sceneErr.Step)
+	assert.Equal(t, 3, sceneErr.Total)
+
+	assert.Equal(t, 0, n)
+	assert.Equal(t, 0, backend.TableItems(tableName))
+	assert.Equal(t, []string{"others/record.json"}, backend.ObjectKeys(bucketName))
+}
+
+func TestTeardownErrors(t *testing.T) {
+	_, probe := newFakeStack(t)
+
+	n := 0
+	err := probe.Play([]gp.Scene{
+		gp.AdLib(func() { n++ }),
+		gp.Teardown(
+			gp.DeleteS3Objects(gp.LogicalID("NoSuchBucket"), "x/"),
+			gp.AdLib(func() { n++ }),
+		),
+	})
+	require.Error(t, err)
+
+	var teardownErr *gp.TeardownError
+	require.True(t, errors.As(err, &teardownErr))
+	assert.Nil(t, teardownErr.Err)
+	assert.Equal(t, 1, len(teardownErr.TeardownErrors))
+	assert.True(t, errors.Is(err, gp.ErrResourceNotFound))
+	assert.Equal(t, 2, n)
+
+	// Is and As do not depend on Unwrap() []error that requires Go 1.20.
+	assert.True(t, teardownErr.Is(gp.ErrResourceNotFound))
+	assert.False(t, teardownErr.Is(gp.ErrPollingTimeout))
+	var sceneErr *gp.SceneError
+	require.True(t, teardownErr.As(&sceneErr))
+	assert.True(t, sceneErr.Teardown)
+}
+
+func TestTeardownAfterCancel(t *testing.T) {
+	_, probe := newFakeStack(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	n := 0
+	err := probe.PlayContext(ctx, []gp.Scene{
+		gp.AdLib(func() { n += 1 }),
+		gp.Teardown(gp.AdLib(func() { n += 10 })),
+	})
+
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, 10, n)
+}
+
+// goexitT exits the goroutine by FailNow like testing.T.
+type goexitT struct{ failed bool }
+
+func (x *goexitT) Errorf(format string, args ...interface{}) {}
+func (x *goexitT) FailNow() {
+	x.failed = true
+	runtime.Goexit()
+}
+
+func TestTeardownAfterExit(t *testing.T) {
+	// play runs Play in another goroutine because the scene exits it.
+	play := func(probe *gp.Generalprobe, playbook []gp.Scene) (recovered interface{}) {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			defer func() { recovered = recover() }()
+			probe.Play(playbook)
+		}()
+		<-done
+		return recovered
+	}
+
+	t.Run("FailNow", func(t *testing.T) {
+		_, probe := newFakeStack(t)
+		st := &goexitT{}
+		ran := false
+		r := play(probe, []gp.Scene{
+			gp.AdLib(func() { require.True(st, false) }),
+			gp.Teardown(gp.AdLib(func() { ran = true })),
+		})
+		assert.Nil(t, r)
+		assert.True(t, st.failed)
+		assert.True(t, ran)
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		_, probe := newFakeStack(t)
+		ran := false
+		r := play(probe, []gp.Scene{
+			gp.AdLib(func() { panic("boom") }),
+			gp.Teardown(gp.AdLib(func() { ran = true })),
+		})
+		assert.Equal(t, "boom", r)
+		assert.True(t, ran)
+	})
+}
+
+func TestTeardownPlaybook(t *testing.T) {
+	backend, probe := newFakeStack(t)
+	tableName := probe.LookupID("ResultStore")
+
+	playbook, err := gp.LoadPlaybook(writePlaybook(t, `
+scenes:
+  - type: publish_sns
+    target: { logical_id: Trigger }
+    message: { id: "{{ runID }}" }
+  - type: get_dynamo_record
+    target: { logical_id: ResultStore }
+    hash_key: { name: result_id, value: "{{ runID }}" }
+teardown:
+  - type: delete_dynamo_record
+    target: { logical_id: ResultStore }
+    hash_key: { name: result_id, value: "{{ runID }}" }
+`))
+	require.NoError(t, err)
+	require.NoError(t, probe.Play(playbook))
+	assert.Equal(t, 0, backend.TableItems(tableName))
+}
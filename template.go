@@ -0,0 +1,220 @@
+package generalprobe
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const randomStringLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+func randomString(n int) (string, error) {
+	buf := make([]byte, n)
+	max := big.NewInt(int64(len(randomStringLetters)))
+	for i := range buf {
+		idx, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", errors.Wrap(err, "Fail to generate random string")
+		}
+		buf[i] = randomStringLetters[idx.Int64()]
+	}
+	return string(buf), nil
+}
+
+// templateFuncs returns functions available in templates of scenes.
+//
+//	{{ runID }}             run ID of the Generalprobe
+//	{{ uuid }}              new UUID v4
+//	{{ now | rfc3339 }}     current time in RFC3339 format
+//	{{ now | unix }}        current time as UNIX timestamp
+//	{{ randomString 16 }}   random alphanumeric string of length 16
+//	{{ toJSON .vars.name }} value encoded as JSON, e.g. quoted and escaped string
+func (x *Generalprobe) templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"runID":        func() string { return x.runID },
+		"uuid":         func() string { return uuid.New().String() },
+		"now":          func() time.Time { return time.Now().UTC() },
+		"rfc3339":      func(t time.Time) string { return t.Format(time.RFC3339) },
+		"unix":         func(t time.Time) int64 { return t.Unix() },
+		"randomString": randomString,
+		"toJSON":       toJSON,
+	}
+}
+
+func toJSON(v interface{}) (string, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return "", errors.Wrapf(err, "Fail to marshal to JSON: %v", v)
+	}
+	return string(raw), nil
+}
+
+// render applies text/template to text. Captured variables are available
+// as {{ .vars.name }} and functions in templateFuncs can be used. In Repeat,
+// 0-origin iteration index is available as {{ .index }}.
+// Referring undefined variable is an error.
+func (x *Generalprobe) render(ctx context.Context, text string) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	tmpl, err := template.New("scene").Option("missingkey=error").
+		Funcs(x.templateFuncs()).Parse(text)
+	if err != nil {
+		return "", errors.Wrapf(err, "Fail to parse template: %s", text)
+	}
+
+	data := map[string]interface{}{
+		"vars": x.vars.snapshot(),
+	}
+	if index, ok := repeatIndex(ctx); ok {
+		data["index"] = index
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", errors.Wrapf(err, "Fail to render template: %s", text)
+	}
+
+	return buf.String(), nil
+}
+
+// renderValue renders v if it is string. Strings in map and slice decoded
+// from JSON or YAML are rendered recursively. Other values are returned as
+// they are.
+func (x *Generalprobe) renderValue(ctx context.Context, v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case string:
+		return x.render(ctx, t)
+
+	case map[string]interface{}:
+		rendered := make(map[string]interface{}, len(t))
+		for key, value := range t {
+			r, err := x.renderValue(ctx, value)
+			if err != nil {
+				return nil, err
+			}
+			rendered[key] = r
+		}
+		return rendered, nil
+
+	case []interface{}:
+		rendered := make([]interface{}, len(t))
+		for i, value := range t {
+			r, err := x.renderValue(ctx, value)
+			if err != nil {
+				return nil, err
+			}
+			rendered[i] = r
+		}
+		return rendered, nil
+	}
+
+	return v, nil
+}
+
+// renderMessage converts msg to string like toMessage and renders templates
+// in it. A string or []byte is rendered as text. Other values are converted
+// to JSON after rendering only string values in them, so that rendered
+// values are escaped properly.
+func (x *Generalprobe) renderMessage(ctx context.Context, msg interface{}) (string, error) {
+	switch v := msg.(type) {
+	case string:
+		return x.render(ctx, v)
+	case []byte:
+		return x.render(ctx, string(v))
+	}
+
+	raw, err := x.renderData(ctx, msg)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+// renderData marshals v to JSON after rendering string values in v. JSON is
+// rewritten token by token, so that order of keys, e.g. declaration order of
+// struct fields, and numbers are kept as they are.
+func (x *Generalprobe) renderData(ctx context.Context, v interface{}) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Fail to marshal message: %v", v)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var buf bytes.Buffer
+	if err := x.renderJSON(ctx, decoder, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renderJSON copies a JSON value from decoder to buf, rendering string
+// values. Keys of objects are copied without rendering.
+func (x *Generalprobe) renderJSON(ctx context.Context, decoder *json.Decoder, buf *bytes.Buffer) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return errors.Wrap(err, "Fail to decode message")
+	}
+
+	switch t := token.(type) {
+	case json.Delim:
+		buf.WriteString(t.String())
+		for i := 0; decoder.More(); i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if t == '{' {
+				key, err := decoder.Token()
+				if err != nil {
+					return errors.Wrap(err, "Fail to decode message")
+				}
+				if err := writeJSON(buf, key); err != nil {
+					return err
+				}
+				buf.WriteByte(':')
+			}
+			if err := x.renderJSON(ctx, decoder, buf); err != nil {
+				return err
+			}
+		}
+		// Closing delimiter
+		end, err := decoder.Token()
+		if err != nil {
+			return errors.Wrap(err, "Fail to decode message")
+		}
+		buf.WriteString(end.(json.Delim).String())
+		return nil
+
+	case string:
+		rendered, err := x.render(ctx, t)
+		if err != nil {
+			return err
+		}
+		return writeJSON(buf, rendered)
+
+	case json.Number:
+		buf.WriteString(t.String())
+		return nil
+	}
+
+	return writeJSON(buf, token)
+}
+
+func writeJSON(buf *bytes.Buffer, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrapf(err, "Fail to marshal message: %v", v)
+	}
+	buf.Write(raw)
+	return nil
+}
@@ -0,0 +1,41 @@
+package generalprobe
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderTemplateFuncs(t *testing.T) {
+	gp := &Generalprobe{vars: newVars(), runID: "test-run"}
+	gp.vars.Set("name", "blue")
+
+	testCases := map[string]*regexp.Regexp{
+		"{{ runID }}-{{ .vars.name }}": regexp.MustCompile(`^test-run-blue$`),
+		"{{ uuid }}":                   regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[0-9a-f]{4}-[0-9a-f]{12}$`),
+		"{{ randomString 16 }}":        regexp.MustCompile(`^[a-zA-Z0-9]{16}$`),
+		"{{ now | unix }}":             regexp.MustCompile(`^[0-9]+$`),
+		"{{ toJSON .vars.name }}":      regexp.MustCompile(`^"blue"$`),
+		"no template":                  regexp.MustCompile(`^no template$`),
+	}
+	for text, expected := range testCases {
+		actual, err := gp.render(context.Background(), text)
+		require.NoError(t, err, text)
+		assert.Regexp(t, expected, actual, text)
+	}
+
+	ts, err := gp.render(context.Background(), "{{ now | rfc3339 }}")
+	require.NoError(t, err)
+	parsed, err := time.Parse(time.RFC3339, ts)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), parsed, time.Minute)
+
+	for _, text := range []string{"{{ .vars.nothing }}", "{{ noSuchFunc }}", "{{ runID"} {
+		_, err := gp.render(context.Background(), text)
+		assert.Error(t, err, text)
+	}
+}
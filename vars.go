@@ -0,0 +1,83 @@
+package generalprobe
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Vars is a variable store shared by scenes of Generalprobe. Scenes can
+// capture values into Vars and later scenes refer them by template
+// {{ .vars.name }} in payloads, filters and keys.
+type Vars struct {
+	mutex sync.RWMutex
+	data  map[string]interface{}
+}
+
+func newVars() *Vars {
+	return &Vars{data: map[string]interface{}{}}
+}
+
+// Set stores value as name. Existing value is overwritten.
+func (x *Vars) Set(name string, value interface{}) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	x.data[name] = value
+}
+
+// Get returns value of name. ok is false if name does not exist.
+func (x *Vars) Get(name string) (value interface{}, ok bool) {
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+	value, ok = x.data[name]
+	return
+}
+
+// String returns value of name as string. It returns empty string if name
+// does not exist.
+func (x *Vars) String(name string) string {
+	value, ok := x.Get(name)
+	if !ok {
+		return ""
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+func (x *Vars) snapshot() map[string]interface{} {
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+
+	data := make(map[string]interface{}, len(x.data))
+	for k, v := range x.data {
+		data[k] = v
+	}
+	return data
+}
+
+// jsonCapture is a rule to store a value of JSON data as a variable. Whole
+// data is stored as string if path is empty.
+type jsonCapture struct {
+	name string
+	path string
+}
+
+func captureJSON(vars *Vars, captures []jsonCapture, raw []byte) error {
+	for _, c := range captures {
+		if c.path == "" {
+			vars.Set(c.name, string(raw))
+			continue
+		}
+
+		value, err := lookupJSONPathBytes(raw, c.path)
+		if err != nil {
+			return errors.Wrapf(err, "Fail to capture %s", c.name)
+		}
+		vars.Set(c.name, value)
+	}
+
+	return nil
+}
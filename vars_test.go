@@ -0,0 +1,135 @@
+package generalprobe_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/guregu/dynamo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gp "github.com/m-mizutani/generalprobe"
+	"github.com/m-mizutani/generalprobe/fake"
+)
+
+func TestCaptureVars(t *testing.T) {
+	backend, probe := newFakeStack(t)
+	probe.Vars().Set("id", "captured-id")
+
+	playbook := []gp.Scene{
+		gp.InvokeLambda(gp.LogicalID("TestHandler"), func(ret []byte) {}).
+			SnsEvent(`{"id":"{{ .vars.id }}"}`).Template().
+			Capture("response").
+			CaptureJSONPath("message", "$.message"),
+		gp.PublishSnsMessage(gp.LogicalID("Trigger"), []byte(`{"id":"{{ .vars.message }}-sns"}`)).
+			Template().Capture("message_id"),
+		gp.PutKinesisStreamRecord(gp.LogicalID("ResultStream"), []byte("{{ .vars.message }}-kinesis")).
+			Template().Capture("seq"),
+		gp.GetLambdaLogs(gp.LogicalID("TestHandler"), func(log gp.CloudWatchLog) bool {
+			return log.Contains("ok-sns")
+		}).Filter("{{ .vars.message }}-sns"),
+	}
+
+	require.NoError(t, probe.Play(playbook))
+	assert.Equal(t, `{"message":"ok"}`, probe.Vars().String("response"))
+	assert.Equal(t, "ok", probe.Vars().String("message"))
+	assert.NotEmpty(t, probe.Vars().String("message_id"))
+	assert.NotEmpty(t, probe.Vars().String("seq"))
+	assert.Equal(t, 2, backend.TableItems(backend.StackName+"-ResultStore"))
+	assert.Equal(t, [][]byte{[]byte("ok-kinesis")}, backend.StreamRecords(backend.StackName+"-ResultStream"))
+}
+
+func TestCaptureVarsUndefined(t *testing.T) {
+	_, probe := newFakeStack(t)
+
+	err := probe.Play([]gp.Scene{
+		gp.PublishSnsMessage(gp.LogicalID("Trigger"), []byte(`{"id":"{{ .vars.nothing }}"}`)).Template(),
+	})
+	assert.Error(t, err)
+}
+
+func TestPayloadTemplate(t *testing.T) {
+	backend, probe := newFakeStack(t)
+	probe.Vars().Set("quote", `say "hi" \ bye`)
+	stream := probe.LookupID("ResultStream")
+
+	binary := append([]byte{0xff, 0x00}, []byte("{{ not a template")...)
+	require.NoError(t, probe.Play([]gp.Scene{
+		gp.PutKinesisStreamRecord(gp.LogicalID("ResultStream"), binary),
+		gp.PutKinesisStreamData(gp.LogicalID("ResultStream"), map[string]string{"text": "{{ .vars.quote }}"}).Template(),
+		gp.PutKinesisStreamRecord(gp.LogicalID("ResultStream"), []byte(`{"text":{{ toJSON .vars.quote }}}`)).Template(),
+		gp.PublishSnsMessage(gp.LogicalID("Trigger"), []byte(`{"id":"{{ .vars.nothing }}"}`)),
+	}))
+
+	records := backend.StreamRecords(stream)
+	require.Equal(t, 3, len(records))
+	assert.Equal(t, binary, records[0])
+	for _, record := range records[1:] {
+		var data map[string]string
+		require.NoError(t, json.Unmarshal(record, &data))
+		assert.Equal(t, `say "hi" \ bye`, data["text"])
+	}
+
+	var item map[string]interface{}
+	require.NoError(t, probe.Play([]gp.Scene{
+		gp.GetDynamoRecord(gp.LogicalID("ResultStore"), func(table dynamo.Table) bool {
+			return table.Get("result_id", "{{ .vars.nothing }}").One(&item) == nil
+		}),
+	}))
+}
+
+func TestCaptureVarsPlaybook(t *testing.T) {
+	_, probe := newFakeStack(t)
+
+	playbook, err := gp.LoadPlaybook(writePlaybook(t, `
+scenes:
+  - type: invoke_lambda
+    target: { logical_id: TestHandler }
+    sns_event: { id: "first" }
+    capture_json: { msg: "$.message" }
+  - type: publish_sns
+    target: { logical_id: Trigger }
+    message: { id: "{{ .vars.msg }}-second" }
+    capture_as: message_id
+  - type: get_dynamo_record
+    target: { logical_id: ResultStore }
+    hash_key: { name: result_id, value: "{{ .vars.msg }}-second" }
+    expect:
+      json: { result_id: "{{ .vars.msg }}-second" }
+`))
+	require.NoError(t, err)
+	require.NoError(t, probe.Play(playbook))
+	assert.NotEmpty(t, probe.Vars().String("message_id"))
+}
+
+func TestRunIDTemplate(t *testing.T) {
+	backend := fake.New(fakeRegion, fakeAccount, fakeStackName)
+	tableName := backend.AddTable("ResultStore", "result_id", "")
+	topicArn := backend.AddTopic("Trigger")
+	backend.Subscribe(topicArn, func(ctx context.Context, entity events.SNSEntity) error {
+		var msg map[string]string
+		if err := json.Unmarshal([]byte(entity.Message), &msg); err != nil {
+			return err
+		}
+		return backend.PutItem(tableName, map[string]string{"result_id": msg["id"]})
+	})
+
+	probe, err := gp.New(fakeRegion, fakeStackName,
+		gp.WithClients(backend.Clients()), gp.WithRunID("run-0001"))
+	require.NoError(t, err)
+	assert.Equal(t, "run-0001", probe.RunID())
+
+	var item map[string]interface{}
+	playbook := []gp.Scene{
+		gp.PublishSnsData(gp.LogicalID("Trigger"), map[string]string{"id": "{{ runID }}"}).Template(),
+		gp.GetDynamoRecord(gp.LogicalID("ResultStore"), func(table dynamo.Table) bool {
+			return table.Get("result_id", probe.RunID()).One(&item) == nil
+		}),
+	}
+
+	require.NoError(t, probe.Play(playbook))
+	assert.Equal(t, "run-0001", item["result_id"])
+	assert.Empty(t, backend.DeliveryErrors())
+}
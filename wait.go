@@ -0,0 +1,180 @@
+package generalprobe
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// WaitPolicy controls how polling scenes (GetDynamoRecord, GetLambdaLogs
+// and GetKinesisStreamRecord) retry until the expected result comes.
+// Zero value of a field means no limit or no effect, except that zero
+// Interval and MaxAttempts without Timeout are filled by DefaultWaitPolicy.
+type WaitPolicy struct {
+	// InitialDelay is waited before the first attempt.
+	InitialDelay time.Duration
+	// Interval is wait time between the first and the second attempt.
+	Interval time.Duration
+	// Multiplier grows the interval for each attempt (exponential backoff).
+	// Values less than 1 mean fixed interval.
+	Multiplier float64
+	// MaxInterval is upper bound of the interval.
+	MaxInterval time.Duration
+	// Jitter randomizes each interval by the ratio. E.g. 0.1 means ±10%.
+	Jitter float64
+	// MaxAttempts is maximum number of attempts.
+	MaxAttempts int
+	// Timeout is overall deadline of the polling from start of the scene.
+	// Each attempt is also interrupted at the deadline.
+	Timeout time.Duration
+}
+
+// DefaultWaitPolicy returns the default policy of polling scenes: 20
+// attempts with 3 seconds interval.
+func DefaultWaitPolicy() WaitPolicy {
+	return WaitPolicy{
+		Interval:    3 * time.Second,
+		MaxAttempts: 20,
+	}
+}
+
+// nextInterval returns wait time after the attempt (1-origin).
+func (x WaitPolicy) nextInterval(attempt int) time.Duration {
+	d := float64(x.Interval)
+	for i := 1; i < attempt && x.Multiplier > 1; i++ {
+		d *= x.Multiplier
+		if x.MaxInterval > 0 && d > float64(x.MaxInterval) {
+			break
+		}
+	}
+	if x.Jitter > 0 {
+		d += d * x.Jitter * (rand.Float64()*2 - 1)
+	}
+	if x.MaxInterval > 0 && d > float64(x.MaxInterval) {
+		d = float64(x.MaxInterval)
+	}
+	if d < 0 {
+		d = 0
+	}
+	return time.Duration(d)
+}
+
+// WithWaitPolicy sets default WaitPolicy of polling scenes. Limit, Interval
+// and Wait of each scene override it.
+func WithWaitPolicy(policy WaitPolicy) Option {
+	return func(gp *Generalprobe) {
+		gp.waitPolicy = policy
+	}
+}
+
+// PollingTimeoutError is returned by a polling scene when the expected
+// result does not come within WaitPolicy. errors.Is(err, ErrPollingTimeout)
+// is true for the error.
+type PollingTimeoutError struct {
+	// Attempts is number of attempts.
+	Attempts int
+	// Waited is elapsed time from start of the polling.
+	Waited time.Duration
+	// LastResult is text of the last result given to callback, or error
+	// of the last attempt. It is empty if nothing was retrieved.
+	LastResult string
+}
+
+func (x *PollingTimeoutError) Error() string {
+	unit := "attempts"
+	if x.Attempts == 1 {
+		unit = "attempt"
+	}
+	msg := fmt.Sprintf("%v after %d %s in %s", ErrPollingTimeout, x.Attempts, unit,
+		x.Waited.Round(time.Millisecond))
+	if x.LastResult != "" {
+		msg += ", last result: " + x.LastResult
+	}
+	return msg
+}
+
+// Is returns true if target is ErrPollingTimeout.
+func (x *PollingTimeoutError) Is(target error) bool {
+	return target == ErrPollingTimeout
+}
+
+// pollFunc is an attempt of polling. It returns true if the expected result
+// is retrieved, and text of the last result for PollingTimeoutError.
+// Returning error stops the polling immediately. ctx is canceled at the
+// deadline of WaitPolicy.
+type pollFunc func(ctx context.Context) (done bool, last string, err error)
+
+// poll calls fn according to WaitPolicy of the scene until fn returns true.
+func (x *pollingScene) poll(ctx context.Context, fn pollFunc) error {
+	policy := x.waitPolicy()
+	start := time.Now()
+
+	var deadline time.Time
+	if policy.Timeout > 0 {
+		deadline = start.Add(policy.Timeout)
+	}
+
+	timeout := func(attempts int, last string) error {
+		return &PollingTimeoutError{
+			Attempts:   attempts,
+			Waited:     time.Since(start),
+			LastResult: last,
+		}
+	}
+
+	// Attempts are bounded by the deadline, so that a slow attempt does not
+	// overrun Timeout.
+	actx := ctx
+	if !deadline.IsZero() {
+		var cancel context.CancelFunc
+		actx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	wait := policy.InitialDelay
+	var last string
+	for attempt := 1; ; attempt++ {
+		// No attempt is made after the deadline except the first one.
+		if !deadline.IsZero() && attempt > 1 && wait >= time.Until(deadline) {
+			return timeout(attempt-1, last)
+		}
+		if wait > 0 {
+			if err := sleep(ctx, wait); err != nil {
+				return err
+			}
+		}
+
+		if r := sceneReport(ctx); r != nil {
+			r.Attempts = attempt
+		}
+		done, result, err := fn(actx)
+		x.gp.firePollAttempt(ctx, PollAttemptEvent{
+			Attempt:    attempt,
+			Elapsed:    time.Since(start),
+			Done:       done,
+			LastResult: result,
+			Err:        err,
+		})
+		if err != nil {
+			if ctx.Err() == nil && actx.Err() != nil {
+				if result == "" {
+					result = err.Error()
+				}
+				return timeout(attempt, result)
+			}
+			return err
+		}
+		if done {
+			return nil
+		}
+		if result != "" {
+			last = result
+		}
+
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			return timeout(attempt, last)
+		}
+		wait = policy.nextInterval(attempt)
+	}
+}
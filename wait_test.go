@@ -0,0 +1,141 @@
+package generalprobe
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitPolicyNextInterval(t *testing.T) {
+	policy := WaitPolicy{
+		Interval:    time.Second,
+		Multiplier:  2,
+		MaxInterval: 5 * time.Second,
+	}
+	assert.Equal(t, time.Second, policy.nextInterval(1))
+	assert.Equal(t, 2*time.Second, policy.nextInterval(2))
+	assert.Equal(t, 4*time.Second, policy.nextInterval(3))
+	assert.Equal(t, 5*time.Second, policy.nextInterval(4))
+	assert.Equal(t, 5*time.Second, policy.nextInterval(100))
+
+	policy = WaitPolicy{Interval: time.Second, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		d := policy.nextInterval(1)
+		assert.True(t, 500*time.Millisecond <= d && d <= 1500*time.Millisecond, d)
+	}
+}
+
+func TestPollingSceneOverride(t *testing.T) {
+	gp := &Generalprobe{waitPolicy: DefaultWaitPolicy()}
+	scene := GetLambdaLogs(LogicalID("Handler"), nil)
+	scene.setGeneralprobe(gp)
+	assert.Equal(t, DefaultWaitPolicy(), scene.waitPolicy())
+
+	scene.Interval(5)
+	policy := scene.waitPolicy()
+	assert.Equal(t, 5*time.Second, policy.Interval)
+	assert.Equal(t, 20, policy.MaxAttempts)
+
+	scene.Wait(WaitPolicy{Timeout: time.Minute}).Limit(3)
+	policy = scene.waitPolicy()
+	assert.Equal(t, WaitPolicy{Interval: 5 * time.Second, MaxAttempts: 3, Timeout: time.Minute}, policy)
+
+	// Zero Interval and no limit are filled by DefaultWaitPolicy.
+	scene = GetLambdaLogs(LogicalID("Handler"), nil)
+	scene.setGeneralprobe(gp)
+	scene.Wait(WaitPolicy{Timeout: time.Minute})
+	assert.Equal(t, WaitPolicy{Interval: 3 * time.Second, Timeout: time.Minute}, scene.waitPolicy())
+	scene.Wait(WaitPolicy{Multiplier: 2})
+	assert.Equal(t, WaitPolicy{Interval: 3 * time.Second, Multiplier: 2, MaxAttempts: 20}, scene.waitPolicy())
+}
+
+func TestPoll(t *testing.T) {
+	newScene := func(policy WaitPolicy) *pollingScene {
+		scene := &pollingScene{}
+		scene.setGeneralprobe(&Generalprobe{waitPolicy: policy})
+		return scene
+	}
+
+	t.Run("max attempts", func(t *testing.T) {
+		scene := newScene(WaitPolicy{Interval: time.Millisecond, MaxAttempts: 3})
+		n := 0
+		err := scene.poll(context.Background(), func(ctx context.Context) (bool, string, error) {
+			n++
+			return false, "not yet", nil
+		})
+
+		var timeoutErr *PollingTimeoutError
+		require.True(t, errors.As(err, &timeoutErr))
+		assert.True(t, errors.Is(err, ErrPollingTimeout))
+		assert.Equal(t, 3, n)
+		assert.Equal(t, 3, timeoutErr.Attempts)
+		assert.Equal(t, "not yet", timeoutErr.LastResult)
+		assert.Contains(t, err.Error(), "after 3 attempts")
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		scene := newScene(WaitPolicy{Interval: 20 * time.Millisecond, Timeout: 100 * time.Millisecond})
+		start := time.Now()
+		err := scene.poll(context.Background(), func(ctx context.Context) (bool, string, error) {
+			return false, "", nil
+		})
+
+		var timeoutErr *PollingTimeoutError
+		require.True(t, errors.As(err, &timeoutErr))
+		assert.True(t, timeoutErr.Attempts > 1)
+		assert.True(t, time.Since(start) < time.Second)
+	})
+
+	t.Run("slow attempt", func(t *testing.T) {
+		scene := newScene(WaitPolicy{Interval: time.Millisecond, Timeout: 50 * time.Millisecond})
+		start := time.Now()
+		err := scene.poll(context.Background(), func(ctx context.Context) (bool, string, error) {
+			select {
+			case <-ctx.Done():
+				return false, "", ctx.Err()
+			case <-time.After(time.Minute):
+				return true, "", nil
+			}
+		})
+
+		var timeoutErr *PollingTimeoutError
+		require.True(t, errors.As(err, &timeoutErr))
+		assert.Equal(t, 1, timeoutErr.Attempts)
+		assert.Contains(t, timeoutErr.LastResult, "deadline exceeded")
+		assert.True(t, time.Since(start) < time.Second)
+	})
+
+	t.Run("done", func(t *testing.T) {
+		scene := newScene(WaitPolicy{Interval: time.Millisecond, MaxAttempts: 5})
+		n := 0
+		err := scene.poll(context.Background(), func(ctx context.Context) (bool, string, error) {
+			n++
+			return n == 2, "", nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		scene := newScene(WaitPolicy{Interval: time.Millisecond, MaxAttempts: 5})
+		err := scene.poll(context.Background(), func(ctx context.Context) (bool, string, error) {
+			return false, "", errors.New("broken")
+		})
+		require.Error(t, err)
+		assert.False(t, errors.Is(err, ErrPollingTimeout))
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		scene := newScene(WaitPolicy{Interval: time.Hour})
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		err := scene.poll(ctx, func(ctx context.Context) (bool, string, error) {
+			return false, "", nil
+		})
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	})
+}